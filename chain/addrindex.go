@@ -0,0 +1,286 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/utils"
+	"XianfengChain04/wallet"
+	"bytes"
+	"encoding/binary"
+)
+
+const ADDRINDEX = "addrindex"
+
+/**
+ * 地址索引桶中的value：与地址有关的一笔交易，以及该交易中地址收到和花掉的金额
+ */
+type addrIndexEntry struct {
+	TxId     [32]byte
+	Received transaction.Amount
+	Sent     transaction.Amount
+}
+
+/**
+ * 地址的一笔交易记录
+ */
+type AddressTx struct {
+	TxId          [32]byte
+	BlockHash     [32]byte           //交易所在区块的hash，交易还在交易池中时为空
+	Height        int64              //交易所在区块的高度
+	Received      transaction.Amount //地址在该交易中收到的金额
+	Sent          transaction.Amount //地址在该交易中花掉的金额
+	Net           transaction.Amount //收到的金额减去花掉的金额
+	Confirmations int64              //确认数，交易还在交易池中时为0
+}
+
+/**
+ * 地址索引桶中的key：锁定脚本的长度(1字节) | 锁定脚本 | 区块高度(8字节) | 交易在区块中的位置(4字节)
+ * 同一个地址的记录按照区块高度和交易位置排列在一起
+ */
+func addrIndexPrefix(scriptPub []byte) []byte {
+	return append([]byte{byte(len(scriptPub))}, scriptPub...)
+}
+
+func addrIndexKey(scriptPub []byte, height int64, index int) []byte {
+	key := addrIndexPrefix(scriptPub)
+	var pos [12]byte
+	binary.BigEndian.PutUint64(pos[:8], uint64(height))
+	binary.BigEndian.PutUint32(pos[8:], uint32(index))
+	return append(key, pos[:]...)
+}
+
+/**
+ * 计算一笔交易中各个地址(以锁定脚本表示)收到和花掉的金额，spents为交易花掉的交易输出
+ */
+func addressDeltas(blockTx transaction.Transaction, spents []transaction.TxOutput) map[string]*addrIndexEntry {
+	deltas := make(map[string]*addrIndexEntry)
+	delta := func(scriptPub []byte) *addrIndexEntry {
+		entry, ok := deltas[string(scriptPub)]
+		if !ok {
+			entry = &addrIndexEntry{TxId: blockTx.TxHash}
+			deltas[string(scriptPub)] = entry
+		}
+		return entry
+	}
+	for _, spent := range spents {
+		delta(spent.ScriptPub).Sent += spent.Value
+	}
+	for _, output := range blockTx.Outputs {
+		delta(output.ScriptPub).Received += output.Value
+	}
+	return deltas
+}
+
+/**
+ * 根据区块的撤销数据计算区块中每笔交易涉及的地址，对每条地址索引的key调用fn
+ */
+func forEachAddrIndex(tx storage.Tx, block Block, fn func(key []byte, entry *addrIndexEntry) error) error {
+	undo, err := getUndo(tx, block)
+	if err != nil {
+		return err
+	}
+	for index, blockTx := range block.Transactions {
+		spents := make([]transaction.TxOutput, 0)
+		for _, spent := range undo[index] {
+			spents = append(spents, spent.Entry.output())
+		}
+		for scriptPub, entry := range addressDeltas(blockTx, spents) {
+			err = fn(addrIndexKey([]byte(scriptPub), block.Height, index), entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/**
+ * 连接区块时把区块中的交易加入地址索引，需要在updateUTXOSet保存了区块的撤销数据之后调用
+ */
+func indexAddresses(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(ADDRINDEX))
+	if err != nil {
+		return err
+	}
+	return forEachAddrIndex(tx, block, func(key []byte, entry *addrIndexEntry) error {
+		entryBytes, err := utils.Encode(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, entryBytes)
+	})
+}
+
+/**
+ * 断开区块时从地址索引中删除区块中的交易，需要在disconnectUTXOSet删除区块的撤销数据之前调用
+ */
+func unindexAddresses(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(ADDRINDEX))
+	if err != nil {
+		return err
+	}
+	return forEachAddrIndex(tx, block, func(key []byte, entry *addrIndexEntry) error {
+		return bucket.Delete(key)
+	})
+}
+
+/**
+ * 使用blocks(从最新区块到创世区块的顺序)重建地址索引，区块的撤销数据必须已经存在
+ */
+func reindexAddresses(tx storage.Tx, blocks []Block) error {
+	if tx.Bucket([]byte(ADDRINDEX)) != nil {
+		err := tx.DeleteBucket([]byte(ADDRINDEX))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.CreateBucket([]byte(ADDRINDEX))
+	if err != nil {
+		return err
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err = indexAddresses(tx, blocks[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 根据主链上的区块重建地址索引
+ */
+func (chain *BlockChain) ReindexAddresses() error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	blocks, err := chain.getAllBlocks()
+	if err != nil {
+		return err
+	}
+	return chain.DB.Update(func(tx storage.Tx) error {
+		return reindexAddresses(tx, blocks)
+	})
+}
+
+/**
+ * 查询地址的交易记录，按照从新到旧的顺序排列，交易池中还未被打包的交易排在最前面
+ * offset为跳过的记录数，limit为最多返回的记录数，limit小于等于0时不限制数量
+ */
+func (chain *BlockChain) GetAddressHistory(addr string, offset int, limit int) ([]AddressTx, error) {
+	pubHash, err := wallet.GetPubHashByAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.getAddressHistory(pubHash, offset, limit)
+}
+
+func (chain *BlockChain) getAddressHistory(pubHash []byte, offset int, limit int) ([]AddressTx, error) {
+	history := make([]AddressTx, 0)
+	//记录一条交易记录，返回false时说明已经达到limit
+	skipped := 0
+	add := func(record AddressTx) bool {
+		if skipped < offset {
+			skipped++
+			return true
+		}
+		history = append(history, record)
+		return limit <= 0 || len(history) < limit
+	}
+
+	err := chain.DB.View(func(tx storage.Tx) error {
+		//1、交易池中的交易，从新到旧
+		poolTxs := chain.Mempool.GetTransactions()
+		for i := len(poolTxs) - 1; i >= 0; i-- {
+			poolTx := poolTxs[i]
+			spents := make([]transaction.TxOutput, 0)
+			for _, input := range poolTx.Inputs {
+				output := chain.findUnspentOutput(tx, input.TxId, input.Vout)
+				if output != nil {
+					spents = append(spents, *output)
+				}
+			}
+			entry, ok := addressDeltas(poolTx, spents)[string(pubHash)]
+			if !ok {
+				continue
+			}
+			if !add(AddressTx{
+				TxId:     poolTx.TxHash,
+				Received: entry.Received,
+				Sent:     entry.Sent,
+				Net:      entry.Received - entry.Sent,
+			}) {
+				return nil
+			}
+		}
+
+		//2、主链上的交易，从最新区块开始
+		bucket := tx.Bucket([]byte(ADDRINDEX))
+		if bucket == nil {
+			return nil
+		}
+		prefix := addrIndexPrefix(pubHash)
+		end := append(append([]byte{}, prefix...), bytes.Repeat([]byte{0xff}, 12)...)
+		cursor := bucket.Cursor()
+		k, v := cursor.Seek(end)
+		if k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+			var entry addrIndexEntry
+			_, err := utils.Decode(v, &entry)
+			if err != nil {
+				return err
+			}
+			height := int64(binary.BigEndian.Uint64(k[len(prefix) : len(prefix)+8]))
+			blockHash, _ := getHashByHeight(tx, height)
+			if !add(AddressTx{
+				TxId:          entry.TxId,
+				BlockHash:     blockHash,
+				Height:        height,
+				Received:      entry.Received,
+				Sent:          entry.Sent,
+				Net:           entry.Received - entry.Sent,
+				Confirmations: chain.LastBlock.Height - height + 1,
+			}) {
+				return nil
+			}
+		}
+		return nil
+	})
+	return history, err
+}
+
+/**
+ * 在UTXO集合和交易池中查找尚未被打包的交易所花费的交易输出，找不到时返回nil
+ */
+func (chain *BlockChain) findUnspentOutput(tx storage.Tx, txId [32]byte, vout int) *transaction.TxOutput {
+	entry, err := getUTXO(tx, txId, vout)
+	if err == nil && entry != nil {
+		output := entry.output()
+		return &output
+	}
+	poolEntry, ok := chain.Mempool.Entries[txId]
+	if !ok || vout < 0 || vout >= len(poolEntry.Tx.Outputs) {
+		return nil
+	}
+	return &poolEntry.Tx.Outputs[vout]
+}
+
+/**
+ * 地址在主链或者交易池中是否有交易记录
+ */
+func (chain *BlockChain) addressUsed(addr string) (bool, error) {
+	pubHash, err := wallet.GetPubHashByAddress(addr)
+	if err != nil {
+		return false, err
+	}
+	history, err := chain.getAddressHistory(pubHash, 0, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(history) > 0, nil
+}
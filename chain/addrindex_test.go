@@ -0,0 +1,144 @@
+package chain
+
+import (
+	"XianfengChain04/transaction"
+	"testing"
+)
+
+/**
+ * 地址交易记录中需要检查的字段
+ */
+type testAddressTx struct {
+	txId     [32]byte
+	height   int64
+	received transaction.Amount
+	sent     transaction.Amount
+}
+
+/**
+ * 检查地址的交易记录依次为expects，height为-1的记录为交易池中的交易
+ */
+func checkAddressHistory(t *testing.T, chain *BlockChain, addr string, offset int, limit int, expects []testAddressTx) {
+	history, err := chain.GetAddressHistory(addr, offset, limit)
+	if err != nil {
+		t.Fatalf("查询地址的交易记录失败：%v", err)
+	}
+	if len(history) != len(expects) {
+		t.Fatalf("offset为%d、limit为%d时期望有%d条交易记录，实际为%d条", offset, limit, len(expects), len(history))
+	}
+	tip := chain.GetLastBlock()
+	for i, expect := range expects {
+		record := history[i]
+		if record.TxId != expect.txId || record.Received != expect.received || record.Sent != expect.sent {
+			t.Fatalf("第%d条交易记录不正确：%x 收到%d 花掉%d", offset+i, record.TxId, record.Received, record.Sent)
+		}
+		if record.Net != record.Received-record.Sent {
+			t.Fatalf("第%d条交易记录的净额不正确：%d", offset+i, record.Net)
+		}
+		if expect.height < 0 {
+			if record.BlockHash != [32]byte{} || record.Confirmations != 0 {
+				t.Fatalf("第%d条交易记录应该是交易池中的交易", offset+i)
+			}
+			continue
+		}
+		block, err := chain.GetBlockByHeight(expect.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Height != expect.height || record.BlockHash != block.Hash || record.Confirmations != tip.Height-expect.height+1 {
+			t.Fatalf("第%d条交易记录的区块信息不正确：高度%d 确认数%d", offset+i, record.Height, record.Confirmations)
+		}
+	}
+}
+
+func TestAddressHistory(t *testing.T) {
+	chain := newTestChain(t, nil)
+	alice, alicePriv := newTestAddress(t, chain)
+	bob, bobPriv := newTestAddress(t, chain)
+	miner, _ := newTestAddress(t, chain)
+	forkMiner, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(alice)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	genesis := chain.GetLastBlock()
+	coinbase := genesis.Transactions[0]
+	value := coinbase.Outputs[0].Value
+
+	//高度1：alice转给bob，高度2：bob转回给alice，交易池中：alice再转给bob
+	tx1 := newTestTx(t, coinbase.TxHash, 0, bob, alicePriv, value)
+	main1 := newTestBlockOn(t, chain, genesis, miner, chain.GetSubsidy(1), []transaction.Transaction{tx1})
+	processTestBlock(t, chain, main1)
+	tx2 := newTestTx(t, tx1.TxHash, 0, alice, bobPriv, value)
+	main2 := newTestBlockOn(t, chain, main1, miner, chain.GetSubsidy(2), []transaction.Transaction{tx2})
+	processTestBlock(t, chain, main2)
+	tx3 := newTestTx(t, tx2.TxHash, 0, bob, alicePriv, value)
+	err = chain.AcceptTransaction(tx3)
+	if err != nil {
+		t.Fatalf("交易加入交易池失败：%v", err)
+	}
+
+	//从新到旧排列，交易池中的交易排在最前面
+	history := []testAddressTx{
+		{tx3.TxHash, -1, 0, value},
+		{tx2.TxHash, 2, value, 0},
+		{tx1.TxHash, 1, 0, value},
+		{coinbase.TxHash, 0, value, 0},
+	}
+	checkAddressHistory(t, chain, alice, 0, 0, history)
+	checkAddressHistory(t, chain, bob, 0, 0, []testAddressTx{
+		{tx3.TxHash, -1, value, 0},
+		{tx2.TxHash, 2, 0, value},
+		{tx1.TxHash, 1, value, 0},
+	})
+	checkAddressHistory(t, chain, miner, 0, 0, []testAddressTx{
+		{main2.Transactions[0].TxHash, 2, chain.GetSubsidy(2), 0},
+		{main1.Transactions[0].TxHash, 1, chain.GetSubsidy(1), 0},
+	})
+
+	//分页：offset跳过的记录包括交易池中的交易
+	tests := []struct {
+		offset int
+		limit  int
+		expect []testAddressTx
+	}{
+		{0, 2, history[:2]},
+		{1, 2, history[1:3]},
+		{2, 2, history[2:]},
+		{3, 5, history[3:]},
+		{4, 1, []testAddressTx{}},
+		{1, 0, history[1:]},
+	}
+	for _, test := range tests {
+		checkAddressHistory(t, chain, alice, test.offset, test.limit, test.expect)
+	}
+
+	//切换分叉之后被断开的区块中的记录从地址索引中删除，其中的交易重新加入交易池
+	fork := []Block{genesis}
+	for height := int64(1); height <= 3; height++ {
+		block := newTestBlockOn(t, chain, fork[height-1], forkMiner, chain.GetSubsidy(height), nil)
+		processTestBlock(t, chain, block)
+		fork = append(fork, block)
+	}
+	checkAddressHistory(t, chain, alice, 0, 0, []testAddressTx{
+		{tx3.TxHash, -1, 0, value},
+		{tx2.TxHash, -1, value, 0},
+		{tx1.TxHash, -1, 0, value},
+		{coinbase.TxHash, 0, value, 0},
+	})
+	checkAddressHistory(t, chain, miner, 0, 0, []testAddressTx{})
+	checkAddressHistory(t, chain, forkMiner, 0, 2, []testAddressTx{
+		{fork[3].Transactions[0].TxHash, 3, chain.GetSubsidy(3), 0},
+		{fork[2].Transactions[0].TxHash, 2, chain.GetSubsidy(2), 0},
+	})
+
+	//重建的地址索引与切换分叉之后的地址索引一致
+	err = chain.ReindexAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAddressHistory(t, chain, miner, 0, 0, []testAddressTx{})
+	checkAddressHistory(t, chain, forkMiner, 2, 0, []testAddressTx{
+		{fork[1].Transactions[0].TxHash, 1, chain.GetSubsidy(1), 0},
+	})
+}
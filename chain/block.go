@@ -1,11 +1,11 @@
 package chain
 
 import (
+	"context"
 	"time"
 	"XianfengChain04/consensus"
-	"encoding/gob"
-	"bytes"
 	"XianfengChain04/transaction"
+	"XianfengChain04/merkle"
 )
 
 const VERSION = 0x00
@@ -19,9 +19,13 @@ type Block struct {
 	PrevHash [32]byte
 	Hash     [32]byte
 	//默克尔根
-	TimeStamp int64
-	//Difficulty int64
+	MerkleRoot [32]byte
+	TimeStamp  int64
+	//难度目标，紧凑格式
+	Bits  uint32
 	Nonce int64
+	//共识引擎的附加数据，如PoA的签名者和签名
+	Extra []byte
 	//区块体
 	//Data []byte
 	Transactions []transaction.Transaction
@@ -43,10 +47,41 @@ func (block Block) GetPrevHash() [32]byte {
 	return block.PrevHash
 }
 
+func (block Block) GetMerkleRoot() [32]byte {
+	return block.MerkleRoot
+}
+
+func (block Block) GetBits() uint32 {
+	return block.Bits
+}
+
+func (block Block) GetHash() [32]byte {
+	return block.Hash
+}
+
+func (block Block) GetNonce() int64 {
+	return block.Nonce
+}
+
+func (block Block) GetExtra() []byte {
+	return block.Extra
+}
+
 func (block Block) GetTransactions() []transaction.Transaction {
 	return block.Transactions
 }
 
+/**
+ * 根据区块中所有交易的hash计算默克尔根
+ */
+func CalculateMerkleRoot(txs []transaction.Transaction) [32]byte {
+	txHashes := make([][32]byte, 0)
+	for _, tx := range txs {
+		txHashes = append(txHashes, tx.TxHash)
+	}
+	return merkle.GetMerkleRoot(txHashes)
+}
+
 /**
  * 计算希值并进行赋值
  */
@@ -62,61 +97,70 @@ func (block Block) GetTransactions() []transaction.Transaction {
 //}
 
 /**
- * 区块的序列化方法
+ * 区块的序列化方法，使用确定性的二进制编码
  */
 func (block *Block) Serialize() ([]byte, error) {
-	//缓冲区
-	buff := new(bytes.Buffer)
-	encoder := gob.NewEncoder(buff)
-	err := encoder.Encode(&block)
-	return buff.Bytes(), err
+	return block.MarshalBinary()
 }
 
 /**
- * 反序列化函数
+ * 反序列化函数：既可以读取二进制编码的区块，也可以读取旧版本gob编码的区块
  */
 func Deserialize(data []byte) (Block, error) {
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&block)
-	return block, err
+	if hasBlockMagic(data) {
+		var block Block
+		err := block.UnmarshalBinary(data)
+		return block, err
+	}
+	//兼容旧版本gob编码的区块数据
+	return deserializeLegacy(data)
 }
 
 /**
- * 生成创世区块的函数
+ * 生成创世区块的函数，bits为创世区块的难度目标，生成的区块需要经过共识引擎封装
  */
-func CreateGenesis(txs []transaction.Transaction) Block {
+func CreateGenesis(bits uint32, txs []transaction.Transaction) Block {
 	genesis := Block{
 		Height:       0,
 		Version:      VERSION,
 		PrevHash:     [32]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		MerkleRoot:   CalculateMerkleRoot(txs),
 		TimeStamp:    time.Now().Unix(),
+		Bits:         bits,
 		Transactions: txs,
 	}
-	//调用PoW，实现hash计算和寻找nonce
-	proof := consensus.NewPoW(genesis)
-	hash, nonce := proof.FindNonce()
-	genesis.Hash = hash
-	genesis.Nonce = nonce
 	return genesis
 }
 
 /**
- * 生成新区块的功能函数
+ * 生成新区块的功能函数，bits为新区块的难度目标，生成的区块需要经过共识引擎封装
  */
-func NewBlock(height int64, prev [32]byte, txs []transaction.Transaction) Block {
+func NewBlock(height int64, prev [32]byte, bits uint32, txs []transaction.Transaction) Block {
 
 	newBlock := Block{
 		Height:       height + 1,
 		Version:      VERSION,
 		PrevHash:     prev,
+		MerkleRoot:   CalculateMerkleRoot(txs),
 		TimeStamp:    time.Now().Unix(),
+		Bits:         bits,
 		Transactions: txs,
 	}
-	proof := consensus.NewPoW(newBlock)
-	hash, nonce := proof.FindNonce()
-	newBlock.Hash = hash
-	newBlock.Nonce = nonce
-
 	return newBlock
 }
+
+/**
+ * 使用共识引擎封装区块(如PoW寻找nonce、PoA签名)，并把结果赋值给区块，ctx被取消时停止
+ * 封装过程中可能会调整区块的时间戳，chain用于读取区块之前的区块
+ */
+func (block *Block) Seal(ctx context.Context, engine consensus.Consensus, chain consensus.ChainReader) error {
+	result, err := engine.Seal(ctx, chain, *block)
+	if err != nil {
+		return err
+	}
+	block.TimeStamp = result.TimeStamp
+	block.Hash = result.Hash
+	block.Nonce = result.Nonce
+	block.Extra = result.Extra
+	return nil
+}
@@ -1,12 +1,18 @@
 package chain
 
 import (
+	"XianfengChain04/config"
+	"XianfengChain04/consensus"
+	"XianfengChain04/mempool"
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/wallet"
+	"context"
 	"crypto/ecdsa"
-	"github.com/bolt"
 	"errors"
 	"math/big"
-	"XianfengChain04/transaction"
-	"XianfengChain04/wallet"
+	"sync"
+	"time"
 )
 
 const BLOCKS = "blocks"
@@ -19,40 +25,105 @@ type BlockChain struct {
 	//切片
 	//[block1,block2,block3]
 	//Blocks []Block
-	DB        *bolt.DB
+	DB        storage.DB
 	LastBlock Block
-	//cursor游标
-	//current
-	IteratorBlockHash [32]byte      //表示当前迭代到了那个区块，该变量用于记录迭代到的区块hash
-	Wallet            wallet.Wallet //引入wallet字段作为BlockChain的一个属性
+	Wallet    *wallet.Wallet      //引入wallet字段作为BlockChain的一个属性
+	Config    *config.Config      //节点的配置信息
+	Mempool   *mempool.Mempool    //交易池，保存等待被打包的交易
+	Engine    consensus.Consensus //共识引擎
+	mining    *miningState        //正在进行的挖矿，有新的最新区块时取消
+	//保护LastBlock、交易池和钱包：查询可以并发进行，添加区块和交易时独占
+	//导出的方法负责加锁，小写开头的方法假定调用者已经持有锁
+	mutex sync.RWMutex
 }
 
-func CreateChain(db *bolt.DB) (*BlockChain, error) {
+func CreateChain(db storage.DB, cfg *config.Config) (*BlockChain, error) {
+	//根据配置创建共识引擎
+	engine, err := consensus.NewEngine(cfg.Consensus, cfg)
+	if err != nil {
+		return nil, err
+	}
 	var lastBlock Block
-	db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx storage.Tx) error {
 		bucket := tx.Bucket([]byte(BLOCKS))
 		if bucket == nil {
-			bucket, _ = tx.CreateBucket([]byte(BLOCKS))
+			var err error
+			bucket, err = tx.CreateBucket([]byte(BLOCKS))
+			if err != nil {
+				return err
+			}
 		}
 		lastHash := bucket.Get([]byte(LASTHASH))
 		if len(lastHash) <= 0 {
 			return nil
 		}
 		lastBlockBytes := bucket.Get(lastHash)
-		lastBlock, _ = Deserialize(lastBlockBytes)
+		block, err := Deserialize(lastBlockBytes)
+		if err != nil {
+			return err
+		}
+		lastBlock = block
 		return nil
 	})
-	//创建或者加载wallet结构体对象
-	walet, err := wallet.LoadAddrAndKeyPairsFromDB(db)
 	if err != nil {
 		return nil, err
 	}
 	blockChain := BlockChain{
-		DB:                db,
-		LastBlock:         lastBlock,
-		IteratorBlockHash: lastBlock.Hash,
-		Wallet:            *walet,
+		DB:        db,
+		LastBlock: lastBlock,
+		Config:    cfg,
+		Engine:    engine,
+		mining:    new(miningState),
+	}
+	//已有区块数据但还没有UTXO集合、撤销数据或区块索引时（旧版本的区块文件），先重建
+	var hasUTXOSet, hasUndo, hasIndex, hasAddrIndex bool
+	db.View(func(tx storage.Tx) error {
+		hasUTXOSet = tx.Bucket([]byte(UTXOSET)) != nil
+		hasUndo = tx.Bucket([]byte(UNDO)) != nil
+		hasIndex = tx.Bucket([]byte(BLOCKINDEX)) != nil && tx.Bucket([]byte(HEIGHTINDEX)) != nil
+		hasAddrIndex = tx.Bucket([]byte(ADDRINDEX)) != nil
+		return nil
+	})
+	if !(hasUTXOSet && hasUndo) && lastBlock.Hash != [32]byte{} {
+		err := blockChain.ReindexUTXO()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasIndex && lastBlock.Hash != [32]byte{} {
+		err := blockChain.ReindexBlockIndex()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasAddrIndex && lastBlock.Hash != [32]byte{} {
+		err := blockChain.ReindexAddresses()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = blockChain.initTxIndex()
+	if err != nil {
+		return nil, err
+	}
+	//创建或者加载wallet结构体对象
+	walet, err := wallet.LoadAddrAndKeyPairsFromDB(db, cfg.WalletCurve)
+	if err != nil {
+		return nil, err
+	}
+	blockChain.Wallet = walet
+	//钱包锁定后私钥从内存中清除，共识引擎也不能再使用签名者的私钥
+	walet.OnLock = blockChain.deauthorizeEngine
+	err = blockChain.authorizeEngine()
+	if err != nil {
+		return nil, err
+	}
+	//加载交易池
+	pool, err := mempool.LoadMempool(db)
+	if err != nil {
+		return nil, err
 	}
+	blockChain.Mempool = pool
 	return &blockChain, nil
 }
 
@@ -67,7 +138,7 @@ func (chain *BlockChain) CreateCoinBase(addr string) error {
 	}
 
 	//2、创建一笔coinbase交易
-	coinbase, err := transaction.CreateCoinBase(addr)
+	coinbase, err := transaction.CreateCoinBase(addr, chain.GetSubsidy(0), 0)
 	if err != nil {
 		return err
 	}
@@ -76,10 +147,19 @@ func (chain *BlockChain) CreateCoinBase(addr string) error {
 	return err
 }
 
+/**
+ * 根据区块高度和配置的减半周期，计算该高度的区块奖励
+ */
+func (chain *BlockChain) GetSubsidy(height int64) transaction.Amount {
+	return transaction.GetSubsidy(height, chain.Config.HalvingInterval)
+}
+
 /**
  * 创建一个区块链对象，包含一个创世区块
  */
 func (chain *BlockChain) CreateGensis(txs []transaction.Transaction) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
 	hashBig := new(big.Int)
 	hashBig.SetBytes(chain.LastBlock.Hash[:])
 	//最新区块hash有值，则说明区块文件中创世区块已经存在了
@@ -87,10 +167,11 @@ func (chain *BlockChain) CreateGensis(txs []transaction.Transaction) error {
 		return nil
 	}
 
-	var err error
 	//gensis持久化到db中去
+	var reorg *Reorg
 	engine := chain.DB
-	engine.Update(func(tx *bolt.Tx) error {
+	err := engine.Update(func(tx storage.Tx) error {
+		var err error
 		bucket := tx.Bucket([]byte(BLOCKS))
 		if bucket == nil { //没有桶
 			bucket, err = tx.CreateBucket([]byte(BLOCKS))
@@ -102,210 +183,365 @@ func (chain *BlockChain) CreateGensis(txs []transaction.Transaction) error {
 		//先查看
 		lastHash := bucket.Get([]byte(LASTHASH))
 		if len(lastHash) == 0 { //第一次
-			gensis := CreateGenesis(txs)
-			genSerBytes, _ := gensis.Serialize()
-			//bucket已经存在
-			// key -> value
-			// blockHash -> 区块序列化以后的数据
-			bucket.Put(gensis.Hash[:], genSerBytes) //把创世区块保存到boltdb中去
-			//使用一个标志，用来记录最新区块的hash，以标明当前文件中存储到了最新的哪个区块
-			bucket.Put([]byte(LASTHASH), gensis.Hash[:])
-			//把geneis赋值给chain的lastblock
-			chain.LastBlock = gensis
-			chain.IteratorBlockHash = gensis.Hash
+			bits, err := chain.calcTarget(tx, Block{})
+			if err != nil {
+				return err
+			}
+			gensis := CreateGenesis(bits, txs)
+			err = gensis.Seal(context.Background(), chain.Engine, blockReader{bucket})
+			if err != nil {
+				return err
+			}
+			//验证并把创世区块保存到boltdb中去
+			reorg, err = chain.processBlock(tx, gensis)
+			return err
+		}
+		return nil
+	})
+	if err != nil || reorg == nil {
+		return err
+	}
+	return chain.afterReorg(reorg)
+}
+
+/**
+ * 挖矿：按照手续费率从交易池中选择交易打包成一个新区块，miner为矿工的地址
+ * 为空时使用配置文件中的矿工地址，ctx被取消或者有了新的最新区块时停止挖矿
+ */
+func (chain *BlockChain) MineBlock(ctx context.Context, miner string) (Block, error) {
+	if miner == "" {
+		miner = chain.Config.Miner
+	}
+	if miner == "" {
+		return Block{}, errors.New("请指定矿工地址，或者在配置文件中设置矿工地址")
+	}
+	if !chain.Wallet.CheckAddress(miner) {
+		return Block{}, errors.New("矿工地址不合法，请检查后重试")
+	}
+	chain.mutex.Lock()
+	txs, err := chain.selectTransactions()
+	chain.mutex.Unlock()
+	if err != nil {
+		return Block{}, err
+	}
+	return chain.mineBlock(ctx, txs, miner)
+}
+
+/**
+ * 从交易池中选择要打包的交易，并在当前的UTXO集合上重新验证
+ * 交易池中的交易可能因为切换分支或者重启之前的状态变化而失效，失效的交易及其子交易从交易池中删除，不会打包到区块中
+ */
+func (chain *BlockChain) selectTransactions() ([]transaction.Transaction, error) {
+	selected := chain.Mempool.SelectTransactions(chain.Config.MaxBlockSize)
+	txs := make([]transaction.Transaction, 0)
+	invalid := make([][32]byte, 0)
+	err := chain.DB.View(func(tx storage.Tx) error {
+		memOutputs := make(map[string]transaction.TxOutput)
+		memSpends := make(map[string]bool)
+		for _, poolTx := range selected {
+			//验证失败时不会修改memOutputs和memSpends，依赖它的子交易会因为找不到输入而失效
+			_, err := chain.validateTransaction(tx, poolTx, chain.LastBlock.Height+1, memOutputs, memSpends)
+			if err != nil {
+				invalid = append(invalid, poolTx.TxHash)
+				continue
+			}
+			txs = append(txs, poolTx)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	err = chain.Mempool.Remove(invalid)
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+/**
+ * 生成一个新区块，miner为矿工的地址，用于领取区块奖励和区块中交易的手续费
+ * ctx被取消或者挖矿过程中有了新的最新区块时，放弃正在挖的区块
+ */
+func (chain *BlockChain) CreateNewBlock(ctx context.Context, txs []transaction.Transaction, miner string) error {
+	_, err := chain.mineBlock(ctx, txs, miner)
 	return err
 }
 
 /**
- * 生成一个新区块
+ * 生成新区块并添加到区块链中，返回生成的区块
+ * 寻找nonce等封装区块的过程不持有锁，其他的查询和添加区块不需要等待挖矿结束
  */
-func (chain *BlockChain) CreateNewBlock(txs []transaction.Transaction) error {
+func (chain *BlockChain) mineBlock(ctx context.Context, txs []transaction.Transaction, miner string) (Block, error) {
 	//目的：生成一个新区块，并存到bolt.DB文件中去(持久化）
 	//手段（步骤）：
+	chain.mutex.RLock()
 	//1、从文件中查到当前存储的最新区块数据
 	lastBlock := chain.LastBlock
-	//3、根据获取的最新区块生成一个新区块
-	newBlock := NewBlock(lastBlock.Height, lastBlock.Hash, txs)
-	//4、将最新区块序列化，得到序列化数据
-	var err error
-	newBlockSerBytes, err := newBlock.Serialize()
+	//2、先对交易进行验证，避免为无效的交易白白寻找nonce，同时得到手续费总额
+	fees, err := chain.verifyTransactions(txs)
 	if err != nil {
-		return err
+		chain.mutex.RUnlock()
+		return Block{}, err
 	}
-	//5、将序列化数据存储到文件、同时更新最新区块的标记lasthash，更新为最新区块的hash
-	db := chain.DB
-	db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(BLOCKS))
-		if bucket == nil {
-			err = errors.New("区块数据库操作失败，请重试!")
-		}
-		//将新生成的区块保存到文件中
-		bucket.Put(newBlock.Hash[:], newBlockSerBytes)
-		//更新最新区块的标记lasthash，更新为最新区块的hash
-		bucket.Put([]byte(LASTHASH), newBlock.Hash[:])
-		//更新内存中的blockchain的LastBlock
-		chain.LastBlock = newBlock
-		chain.IteratorBlockHash = newBlock.Hash
-		return nil
+	//3、构建矿工的coinbase交易，领取区块奖励和手续费，作为区块的第一笔交易
+	coinbase, err := transaction.CreateCoinBase(miner, chain.GetSubsidy(lastBlock.Height+1)+fees, lastBlock.Height+1)
+	if err != nil {
+		chain.mutex.RUnlock()
+		return Block{}, err
+	}
+	blockTxs := append([]transaction.Transaction{*coinbase}, txs...)
+	//4、根据难度调整规则计算新区块的难度目标，生成一个新区块
+	bits, err := chain.nextBits()
+	if err != nil {
+		chain.mutex.RUnlock()
+		return Block{}, err
+	}
+	//新区块的时间戳必须晚于之前区块时间戳的中位数
+	var medianTime int64
+	err = chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		medianTime, err = chain.medianTimePast(tx, lastBlock)
+		return err
 	})
+	if err != nil {
+		chain.mutex.RUnlock()
+		return Block{}, err
+	}
+	//在释放锁之前开始挖矿，之后添加的新区块一定会取消这次挖矿
+	ctx, stop := chain.startMining(ctx)
+	defer stop()
+	chain.mutex.RUnlock()
+
+	newBlock := NewBlock(lastBlock.Height, lastBlock.Hash, bits, blockTxs)
+	if newBlock.TimeStamp <= medianTime {
+		newBlock.TimeStamp = medianTime + 1
+	}
+	err = newBlock.Seal(ctx, chain.Engine, dbReader{chain.DB})
+	if err != nil {
+		return Block{}, err
+	}
+	//5、验证新区块并存储到文件中
+	err = chain.AddBlock(newBlock)
+	if err != nil {
+		return Block{}, err
+	}
+	return newBlock, nil
+}
+
+/**
+ * 添加一个区块到区块链中，区块需要先通过验证才会被保存
+ * 本地生成的区块和从外部接收到的区块都通过该方法添加，区块所在的分支累计工作量更大时切换到该分支
+ */
+func (chain *BlockChain) AddBlock(block Block) error {
+	_, err := chain.ProcessBlock(block)
 	return err
 }
 
-//获取最新的区块数据
+/**
+ * 对即将打包的交易进行验证：交易输入引用的输出必须未被花费，签名必须有效
+ * coinbase交易无需验证签名，交易可以引用同一批交易中排在其之前的交易的输出
+ * 验证通过时返回这批交易的手续费总额
+ */
+func (chain *BlockChain) VerifyTransactions(txs []transaction.Transaction) (transaction.Amount, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.verifyTransactions(txs)
+}
+
+func (chain *BlockChain) verifyTransactions(txs []transaction.Transaction) (transaction.Amount, error) {
+	var fees transaction.Amount
+	err := chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		fees, err = chain.validateTransactions(tx, txs, chain.LastBlock.Height+1)
+		return err
+	})
+	return fees, err
+}
+
+/**
+ * 验证交易并加入交易池：交易可以花费UTXO集合中的输出，也可以花费交易池中其他交易的输出，
+ * 但不能与交易池中的交易花费同一个输出
+ */
+func (chain *BlockChain) AcceptTransaction(newTx transaction.Transaction) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.acceptTransaction(newTx)
+}
+
+func (chain *BlockChain) acceptTransaction(newTx transaction.Transaction) error {
+	if newTx.IsCoinBase() {
+		return errors.New("coinbase交易不能单独发送")
+	}
+	if chain.Mempool.Has(newTx.TxHash) {
+		return mempool.ErrTxExists
+	}
+	var fee transaction.Amount
+	err := chain.DB.View(func(tx storage.Tx) error {
+		//交易池中的交易产生和花费的输出
+		memOutputs := make(map[string]transaction.TxOutput)
+		memSpends := make(map[string]bool)
+		for _, poolTx := range chain.Mempool.GetTransactions() {
+			for _, input := range poolTx.Inputs {
+				memSpends[string(utxoKey(input.TxId, input.Vout))] = true
+			}
+			for index, output := range poolTx.Outputs {
+				memOutputs[string(utxoKey(poolTx.TxHash, index))] = output
+			}
+		}
+		var err error
+		fee, err = chain.validateTransaction(tx, newTx, chain.LastBlock.Height+1, memOutputs, memSpends)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return chain.Mempool.Add(newTx, fee)
+}
+
+// 获取最新的区块数据
 func (chain *BlockChain) GetLastBlock() Block {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
 	return chain.LastBlock
 }
 
-//获取所有的区块数据
+// 获取所有的区块数据
 func (chain *BlockChain) GetAllBlocks() ([]Block, error) {
-	//目的：获取所有的区块
-	//手段（步骤）：
-	//1、找到最后一个区块
-	db := chain.DB
-	var err error
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.getAllBlocks()
+}
+
+func (chain *BlockChain) getAllBlocks() ([]Block, error) {
+	//目的：获取所有的区块，从最新区块开始依次往前找，直到创世区块
 	blocks := make([]Block, 0)
-	db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(BLOCKS))
-		if bucket == nil {
-			err = errors.New("区块数据库操作失败,请重试！")
-			return err
+	//还没有区块时NewIterator会重新获取最新区块，调用者已经持有锁，不能再加锁
+	if chain.LastBlock.Hash == [32]byte{} {
+		return blocks, nil
+	}
+	iterator := chain.NewIterator(chain.LastBlock.Hash)
+	for iterator.HasNext() {
+		block, err := iterator.Next()
+		if err != nil {
+			return nil, err
 		}
-		var currentHash []byte
-		currentHash = bucket.Get([]byte(LASTHASH))
-		//2、根据最后一个区块依次往前找
-		for {
-			currentBlockBytes := bucket.Get(currentHash)
-			currentBlock, err := Deserialize(currentBlockBytes)
-			if err != nil {
-				break
-			}
-			//3、每次找到的区块放入到一个[]Block容器中
-			blocks = append(blocks, currentBlock)
-			//4、找到最开始的创世区块时，就结束了，不再找了
-			if currentBlock.Height == 0 {
-				break
-			}
-			currentHash = currentBlock.PrevHash[:]
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+var ErrBlockNotFound = errors.New("找不到该区块")
+
+/**
+ * 根据区块hash查找区块，分叉上的区块也可以查到
+ */
+func (chain *BlockChain) GetBlockByHash(hash [32]byte) (Block, error) {
+	var block Block
+	err := chain.DB.View(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(BLOCKS))
+		if bucket == nil || len(bucket.Get(hash[:])) == 0 {
+			return ErrBlockNotFound
 		}
-		return nil
+		var err error
+		block, err = loadBlock(bucket, hash)
+		return err
 	})
-	return blocks, err
+	return block, err
 }
 
 /**
- * 该方法用于实现迭代器Iterator的HasNext方法,用于判断是否还有数据
- * 如果有数据，返回true，否则返回false
+ * 根据高度查找主链上的区块
  */
-func (chain *BlockChain) HasNext() bool {
-	//区块0 -> 区块1 -> 区块2 -> 区块3
-	//最新区块: 区块3
-	//步骤: 当前区块在哪 ->  preHash -> db
-	db := chain.DB
-	var hasNext bool
-	db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(BLOCKS))
-		if bucket == nil {
-			return errors.New("区块数据文件操作失败，请重试！")
+func (chain *BlockChain) GetBlockByHeight(height int64) (Block, error) {
+	var block Block
+	err := chain.DB.View(func(tx storage.Tx) error {
+		hash, ok := getHashByHeight(tx, height)
+		if !ok {
+			return ErrBlockNotFound
 		}
-		//获取前一个区块的区块数据
-		blockBytes := bucket.Get(chain.IteratorBlockHash[:])
-		//如果获取不到前一个区块的数据，说明前面没有区块了
-		hasNext = len(blockBytes) != 0
-		return nil
+		var err error
+		block, err = loadBlock(tx.Bucket([]byte(BLOCKS)), hash)
+		return err
 	})
-	return hasNext
+	return block, err
 }
 
 /**
- * 该方法用于实现迭代器Iterator的Next方法，用于取出一个数据
- * 此处，因为是区块链数据集合，因此返回的数据类型是Block
+ * 根据高度查找主链上区块的hash
  */
-func (chain *BlockChain) Next() Block {
-	//1、知道当前在哪个区块
-	//2、找当前区块的前一个区块
-	//3、找到的区块返回
-	db := chain.DB
-	var iteratorBlock Block
-	db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(BLOCKS))
-		if bucket == nil {
-			return errors.New("区块数据文件操作失败,请重试！")
+func (chain *BlockChain) GetBlockHash(height int64) ([32]byte, error) {
+	var hash [32]byte
+	err := chain.DB.View(func(tx storage.Tx) error {
+		var ok bool
+		hash, ok = getHashByHeight(tx, height)
+		if !ok {
+			return ErrBlockNotFound
 		}
-		//前一个区块的数据
-		blockBytes := bucket.Get(chain.IteratorBlockHash[:])
-		iteratorBlock, _ = Deserialize(blockBytes)
-		//迭代到当前区块后，更新游标的区块内容
-		chain.IteratorBlockHash = iteratorBlock.PrevHash
 		return nil
 	})
-	return iteratorBlock
+	return hash, err
 }
 
 /**
- * 该方法用于查询出指定地址的UTXOs集合并返回
+ * 分页查询主链上的区块：从高度为from的区块开始往创世区块的方向最多返回limit个区块
+ * from小于0时从最新区块开始，limit小于等于0时不限制数量
  */
-func (chain *BlockChain) SearchUTXOsFromDB(addr string) ([]transaction.UTXO) {
-
-	//花费记录的容器
-	spend := make([]transaction.TxInput, 0)
-
-	//收入记录的容器
-	inCome := make([]transaction.UTXO, 0)
-
-	//迭代遍历每一个区块
-	for chain.HasNext() {
-		block := chain.Next()
-		//遍历区块中的交易
-		for _, tx := range block.Transactions {
-			//a、遍历每个交易的交易输入
-			for _, input := range tx.Inputs {
-				//找到了花费记录
-				if string(input.ScriptSig) != addr {
-					continue
-				}
-				spend = append(spend, input)
-			}
-			//b、遍历每个交易的交易输出:收入
-			for index, output := range tx.Outputs {
-				if string(output.ScriptPub) != addr {
-					continue
-				}
-				utxo := transaction.UTXO{
-					TxId:     tx.TxHash,
-					Vout:     index,
-					TxOutput: output,
-				}
-				inCome = append(inCome, utxo)
-			}
-		}
+func (chain *BlockChain) GetBlocks(from int64, limit int) ([]Block, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	blocks := make([]Block, 0)
+	if from < 0 {
+		from = chain.LastBlock.Height
 	}
-
-	//遍历收入集合和花费集合，把已花的剔除，找出未花费的记录
-	utxos := make([]transaction.UTXO, 0)
-	var isComeSpent bool
-	for _, come := range inCome {
-		isComeSpent = false
-		for _, spen := range spend {
-			if come.TxId == spen.TxId && come.Vout == spen.Vout {
-				//该笔收入已被花费
-				isComeSpent = true
+	err := chain.DB.View(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(BLOCKS))
+		if bucket == nil {
+			return errors.New("区块数据库操作失败,请重试！")
+		}
+		for height := from; height >= 0; height-- {
+			if limit > 0 && len(blocks) >= limit {
 				break
 			}
+			hash, ok := getHashByHeight(tx, height)
+			if !ok {
+				break
+			}
+			block, err := loadBlock(bucket, hash)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
 		}
-		if !isComeSpent { //当前遍历到的come没有被消费
-			utxos = append(utxos, come)
+		return nil
+	})
+	return blocks, err
+}
+
+/**
+ * 从区块桶中按照从最新区块到创世区块的顺序读取所有的区块
+ */
+func getAllBlocksFromBucket(bucket storage.Bucket) ([]Block, error) {
+	blocks := make([]Block, 0)
+	//1、找到最后一个区块，根据最后一个区块依次往前找
+	var lastHash [32]byte
+	copy(lastHash[:], bucket.Get([]byte(LASTHASH)))
+	iterator := newBucketIterator(bucket, lastHash)
+	//2、找到最开始的创世区块时，它的前一个区块不存在，就结束了
+	for iterator.HasNext() {
+		block, err := iterator.Next()
+		if err != nil {
+			return nil, err
 		}
+		blocks = append(blocks, block)
 	}
-	return utxos
+	return blocks, nil
 }
 
 /**
  * 该方法用于实现地址余额的统计
  */
-func (chain *BlockChain) GetBalance(addr string) (float64, error) {
+func (chain *BlockChain) GetBalance(addr string) (transaction.Amount, error) {
 	//1、检查地址的合法性
 	isAddrValid := chain.Wallet.CheckAddress(addr)
 	if !isAddrValid {
@@ -313,31 +549,50 @@ func (chain *BlockChain) GetBalance(addr string) (float64, error) {
 	}
 
 	//2、获取地址的余额
-	_, totalBalance := chain.GetUTXOsWithBalance(addr, []transaction.Transaction{})
-	return totalBalance, nil
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	_, totalBalance, err := chain.getUTXOsWithBalance(addr, []transaction.Transaction{})
+	return totalBalance, err
 }
 
 /**
  * 该方法用于实现地址余额统计和地址所可以花费的utxo集合
+ * 交易池中还未被打包的交易以及txs中的交易所花费和产生的输出都会被计算在内
  */
-func (chain BlockChain) GetUTXOsWithBalance(addr string, txs []transaction.Transaction) ([]transaction.UTXO, float64) {
-	//1、遍历bolt.DB文件，找区块中的可用的utxo的集合
-	dbUtxos := chain.SearchUTXOsFromDB(addr)
+func (chain *BlockChain) GetUTXOsWithBalance(addr string, txs []transaction.Transaction) ([]transaction.UTXO, transaction.Amount, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.getUTXOsWithBalance(addr, txs)
+}
+
+func (chain *BlockChain) getUTXOsWithBalance(addr string, txs []transaction.Transaction) ([]transaction.UTXO, transaction.Amount, error) {
+	//0、地址转换为公钥哈希，交易输出锁定在公钥哈希上
+	pubHash, err := wallet.GetPubHashByAddress(addr)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	//2、找一遍内存中已经存在但还未存到文件中的交易
-	// 看一看是否已经花了某个bolt.DB文件中的utxo, 如果某个utxo被花掉了，应该剔除掉
-	memSpends := make([]transaction.TxInput, 0)
+	//1、从bolt.DB文件的UTXO集合中，找到可用的utxo的集合
+	dbUtxos, err := chain.searchUTXOsFromDB(pubHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//2、找一遍交易池和内存中已经存在但还未存到文件中的交易
+	// 看一看是否已经花了某个utxo, 如果某个utxo被花掉了，应该剔除掉
+	pendingTxs := append(chain.Mempool.GetTransactions(), txs...)
+	memSpends := make(map[string]bool)
 	memInComes := make([]transaction.UTXO, 0)
-	for _, tx := range txs {
+	for _, tx := range pendingTxs {
 		//a、遍历交易输入，把花的钱记录下来
 		for _, input := range tx.Inputs {
-			if string(input.ScriptSig) == addr {
-				memSpends = append(memSpends, input)
+			if input.UsesKey(pubHash) {
+				memSpends[string(utxoKey(input.TxId, input.Vout))] = true
 			}
 		}
 		//b、遍历交易输出，把收入的钱记录下来
 		for outIndex, output := range tx.Outputs {
-			if string(output.ScriptPub) == addr {
+			if output.IsLockedWithKey(pubHash) {
 				utxo := transaction.UTXO{
 					TxId:     tx.TxHash,
 					Vout:     outIndex,
@@ -349,42 +604,76 @@ func (chain BlockChain) GetUTXOsWithBalance(addr string, txs []transaction.Trans
 	}
 
 	//3、经过内存中的交易的遍历以后，剩下的才是最终可用的utxo集合
+	// 文件中的utxo和内存中的收入都可能已经被内存中的交易花掉了
 	utxos := make([]transaction.UTXO, 0)
-	var isUTXOSpend bool
-	for _, utxo := range dbUtxos {
-		isUTXOSpend = false
-		for _, spend := range memSpends {
-			if string(utxo.TxId[:]) == string(spend.TxId[:]) &&
-				utxo.Vout == spend.Vout &&
-				string(utxo.ScriptPub) == string(spend.ScriptSig) {
-				isUTXOSpend = true
-			}
-		}
-		if !isUTXOSpend {
+	for _, utxo := range append(dbUtxos, memInComes...) {
+		if !memSpends[string(utxoKey(utxo.TxId, utxo.Vout))] {
 			utxos = append(utxos, utxo)
 		}
 	}
-	//把内存中的收入也加入到可用的utxo集合中
-	utxos = append(utxos, memInComes...)
 
-	var totalBalance float64
+	var totalBalance transaction.Amount
 	for _, utxo := range utxos {
 		totalBalance += utxo.Value
 	}
-	return utxos, totalBalance
+	return utxos, totalBalance, nil
 }
 
 /**
- * 定义区块链的发送交易的功能
+ * 定义区块链的发送交易的功能：构建并签名交易，验证通过后加入交易池，等待矿工打包
+ * fee为每笔交易支付的手续费，返回加入交易池的交易hash
  */
-func (chain *BlockChain) SendTransaction(froms []string, tos []string, amounts []float64) error {
+func (chain *BlockChain) SendTransaction(froms []string, tos []string, amounts []transaction.Amount, fee transaction.Amount) ([][32]byte, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	newTxs, err := chain.buildTransactions(froms, tos, amounts, fee, true)
+	if err != nil {
+		return nil, err
+	}
+
+	//3、所有交易都构建成功后，依次验证并加入交易池
+	txIds := make([][32]byte, 0)
+	for _, newTx := range newTxs {
+		err := chain.acceptTransaction(newTx)
+		if err != nil {
+			return txIds, err
+		}
+		txIds = append(txIds, newTx.TxHash)
+	}
+	return txIds, nil
+}
 
+/**
+ * 构建未签名的交易，from可以是观察地址，交易不会加入交易池
+ * 钱包中有from的公钥时，交易输入中填入公钥
+ */
+func (chain *BlockChain) CreateRawTransaction(froms []string, tos []string, amounts []transaction.Amount, fee transaction.Amount) ([]transaction.Transaction, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.buildTransactions(froms, tos, amounts, fee, false)
+}
+
+/**
+ * 按照from、to、amount一一对应构建交易，sign为true时使用钱包中的私钥签名
+ */
+func (chain *BlockChain) buildTransactions(froms []string, tos []string, amounts []transaction.Amount, fee transaction.Amount, sign bool) ([]transaction.Transaction, error) {
+	if len(froms) != len(tos) || len(froms) != len(amounts) {
+		return nil, errors.New("参数个数不一致，请检查参数后重试")
+	}
 	//0、对所有的from和to进行合法性检查
 	for i := 0; i < len(froms); i++ {
 		isFromValid := chain.Wallet.CheckAddress(froms[i])
 		isToValid := chain.Wallet.CheckAddress(tos[i])
 		if !isFromValid || !isToValid {
-			return errors.New("地址不合法，请检查后重试")
+			return nil, errors.New("地址不合法，请检查后重试")
+		}
+		//观察地址没有私钥，在构建交易之前就拒绝
+		if sign && chain.Wallet.IsWatchOnly(froms[i]) {
+			return nil, wallet.ErrWatchOnly
+		}
+		if amounts[i] <= 0 {
+			return nil, errors.New("转账的数量必须大于0")
 		}
 	}
 
@@ -399,15 +688,18 @@ func (chain *BlockChain) SendTransaction(froms []string, tos []string, amounts [
 	//遍历
 	for from_index, from := range froms {
 		//1、先把from的可花费的utxos给找出来
-		utxos, totalBalance := chain.GetUTXOsWithBalance(from, newTxs)
-		if totalBalance < amounts[from_index] {
-			return errors.New(from + "余额不足，赶紧去搬砖挣钱")
+		utxos, totalBalance, err := chain.getUTXOsWithBalance(from, newTxs)
+		if err != nil {
+			return nil, err
+		}
+		if len(utxos) == 0 || totalBalance < amounts[from_index]+fee {
+			return nil, errors.New(from + "余额不足，赶紧去搬砖挣钱")
 		}
 		totalBalance = 0
 		var utxoNum int
 		for index, utxo := range utxos {
 			totalBalance += utxo.Value
-			if totalBalance > amounts[from_index] {
+			if totalBalance >= amounts[from_index]+fee {
 				utxoNum = index
 				break
 			}
@@ -417,34 +709,89 @@ func (chain *BlockChain) SendTransaction(froms []string, tos []string, amounts [
 		newTx, err := transaction.CreateNewTransaction(utxos[0:utxoNum+1],
 			from,
 			tos[from_index],
-			amounts[from_index])
+			amounts[from_index],
+			fee)
 
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if !sign {
+			keyPair := chain.Wallet.Address[from]
+			if keyPair != nil && len(keyPair.Pub) != 0 {
+				for index := range newTx.Inputs {
+					newTx.Inputs[index].PubKey = keyPair.Pub
+				}
+				err = newTx.SetTxHash()
+				if err != nil {
+					return nil, err
+				}
+			}
+			newTxs = append(newTxs, *newTx)
+			continue
 		}
 		//对构建的交易newTx进行签名
+		priv, err := chain.Wallet.GetPrivKey(from)
+		if err != nil {
+			return nil, err
+		}
+		//导入的非压缩格式的WIF私钥，交易输入中需要使用非压缩格式的公钥
+		pub := chain.Wallet.Address[from].Pub
+		privKeys := make([]*ecdsa.PrivateKey, 0)
+		pubKeys := make([][]byte, 0)
+		for range newTx.Inputs {
+			privKeys = append(privKeys, priv)
+			pubKeys = append(pubKeys, pub)
+		}
+		err = newTx.SignWithPubKeys(privKeys, pubKeys)
+		if err != nil {
+			return nil, err
+		}
 
 		newTxs = append(newTxs, *newTx)
 	}
-
-	err := chain.CreateNewBlock(newTxs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return newTxs, nil
 }
 
 /**
  * 生成比特币地址的功能
  */
 func (chain *BlockChain) GetNewAddress() (string, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
 	return chain.Wallet.NewAddress()
 }
 
+/**
+ * 生成新的找零地址
+ */
+func (chain *BlockChain) GetNewChangeAddress() (string, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.NewChangeAddress()
+}
+
+/**
+ * 获取钱包中地址对应的公钥，用于配置PoA共识的签名者
+ */
+func (chain *BlockChain) GetPubKey(addr string) ([]byte, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	if !chain.Wallet.CheckAddress(addr) {
+		return nil, errors.New("地址不符合规范，请重试")
+	}
+	keyPair := chain.Wallet.Address[addr]
+	if keyPair == nil || len(keyPair.Pub) == 0 {
+		return nil, errors.New("当前钱包未找到对应地址的公钥")
+	}
+	return keyPair.Pub, nil
+}
+
 /**
  * 获取钱包中的地址列表
  */
 func (chain *BlockChain) GetAddressList() ([]string, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
 	if chain.Wallet.Address == nil {
 		return nil, errors.New("暂无地址")
 	}
@@ -455,22 +802,170 @@ func (chain *BlockChain) GetAddressList() ([]string, error) {
 	return addList, nil
 }
 
-func (chain *BlockChain)DumpPrivkey(addr string)(*ecdsa.PrivateKey,error) {
+/**
+ * 导出地址的秘钥对，公钥的格式决定了WIF格式的私钥是否带有压缩标记
+ */
+func (chain *BlockChain) DumpPrivkey(addr string) (*wallet.KeyPair, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
 	//1.地址规范性检查
-	isAddrValid:=chain.Wallet.CheckAddress(addr)
+	isAddrValid := chain.Wallet.CheckAddress(addr)
 	if !isAddrValid {
-		return  nil,errors.New("地址不符合规范，请重试")
+		return nil, errors.New("地址不符合规范，请重试")
 	}
 	//2.钱包为空
-	if chain.Wallet.Address == nil{
+	if chain.Wallet.Address == nil {
 		return nil, errors.New("当前钱包未找到对应地址的私钥")
 	}
 
-	//3.到wallet找addr的对应的keypair
-	keyPair :=chain.Wallet.Address[addr]
-	if keyPair == nil {
-		return nil,errors.New("当前钱包未找到对应地址的私钥")
+	//3.到wallet找addr的对应的私钥，钱包锁定时无法导出
+	priv, err := chain.Wallet.GetPrivKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &wallet.KeyPair{Priv: priv, Pub: chain.Wallet.Address[addr].Pub}, nil
+}
+
+/**
+ * 导入WIF或hex格式的私钥，返回私钥对应的地址
+ */
+func (chain *BlockChain) ImportPrivKey(key string, label string) (string, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	pri, compressed, err := chain.Wallet.ParsePrivKey(key)
+	if err != nil {
+		return "", err
 	}
-	//4.找到了具体结果，将私钥返回
-	return  keyPair.Priv,nil
+	return chain.Wallet.ImportPrivKey(pri, compressed, label)
+}
+
+/**
+ * 重新扫描地址在链上的交易：UTXO集合和地址索引包含了所有地址的数据，
+ * 不需要重新处理区块，直接从地址索引中统计交易数量，从UTXO集合中计算余额
+ */
+func (chain *BlockChain) RescanAddress(addr string) (int, transaction.Amount, error) {
+	pubHash, err := wallet.GetPubHashByAddress(addr)
+	if err != nil {
+		return 0, 0, err
+	}
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	history, err := chain.getAddressHistory(pubHash, 0, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, balance, err := chain.getUTXOsWithBalance(addr, []transaction.Transaction{})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(history), balance, nil
+}
+
+/**
+ * 导入观察地址
+ */
+func (chain *BlockChain) ImportAddress(addr string, label string) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.ImportAddress(addr, label)
+}
+
+/**
+ * 导入公钥作为观察地址，返回公钥对应的地址
+ */
+func (chain *BlockChain) ImportPubKey(pub []byte, label string) (string, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.ImportPubKey(pub, label)
+}
+
+/**
+ * 钱包中所有地址的余额：有私钥的地址的余额总和，以及观察地址的余额总和
+ */
+func (chain *BlockChain) GetWalletBalance() (transaction.Amount, transaction.Amount, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	var spendable, watchOnly transaction.Amount
+	for addr := range chain.Wallet.Address {
+		_, balance, err := chain.getUTXOsWithBalance(addr, []transaction.Transaction{})
+		if err != nil {
+			return 0, 0, err
+		}
+		if chain.Wallet.IsWatchOnly(addr) {
+			watchOnly += balance
+		} else {
+			spendable += balance
+		}
+	}
+	return spendable, watchOnly, nil
+}
+
+/**
+ * 使用口令加密钱包，加密后钱包处于锁定状态
+ */
+func (chain *BlockChain) EncryptWallet(passphrase string) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.Encrypt(passphrase)
+}
+
+/**
+ * 使用口令解锁钱包，timeout之后钱包自动锁定，解锁后共识引擎可以使用签名者的私钥
+ */
+func (chain *BlockChain) WalletPassphrase(passphrase string, timeout time.Duration) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	err := chain.Wallet.Unlock(passphrase, timeout)
+	if err != nil {
+		return err
+	}
+	return chain.authorizeEngine()
+}
+
+/**
+ * 立即锁定钱包
+ */
+func (chain *BlockChain) WalletLock() error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.Lock()
+}
+
+/**
+ * 修改钱包的口令
+ */
+func (chain *BlockChain) WalletPassphraseChange(oldPassphrase string, newPassphrase string) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.ChangePassphrase(oldPassphrase, newPassphrase)
+}
+
+/**
+ * 生成新的助记词作为钱包的HD种子，words为助记词的单词数量
+ */
+func (chain *BlockChain) NewMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", errors.New("助记词的单词数量必须是12、15、18、21或24")
+	}
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.NewHDSeed(words / 3 * 32)
+}
+
+/**
+ * 导入助记词恢复HD钱包，根据地址索引发现已经使用过的地址，返回恢复的地址数量
+ */
+func (chain *BlockChain) ImportMnemonic(mnemonic string, passphrase string, gap uint32) (int, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.Wallet.Restore(mnemonic, passphrase, gap, chain.addressUsed)
+}
+
+/**
+ * 导出钱包的助记词
+ */
+func (chain *BlockChain) DumpMnemonic() (string, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.Wallet.GetMnemonic()
 }
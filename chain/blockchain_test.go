@@ -0,0 +1,158 @@
+package chain
+
+import (
+	"XianfengChain04/config"
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"context"
+	"testing"
+)
+
+func TestMineBlockAfterLastHalving(t *testing.T) {
+	chain := newTestChain(t, func(cfg *config.Config) {
+		cfg.HalvingInterval = 1
+	})
+	addr, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	//每个区块奖励减半一次，REWARDSIZE在第33次减半时变为0
+	if chain.GetSubsidy(33) != 0 {
+		t.Fatalf("高度33的区块奖励应该为0，实际为%d", chain.GetSubsidy(33))
+	}
+	for height := int64(1); height <= 40; height++ {
+		block, err := chain.MineBlock(context.Background(), addr)
+		if err != nil {
+			t.Fatalf("挖出高度为%d的区块失败：%v", height, err)
+		}
+		if block.Height != height {
+			t.Fatalf("期望区块高度为%d，实际为%d", height, block.Height)
+		}
+		value := block.Transactions[0].Outputs[0].Value
+		if value != chain.GetSubsidy(height) {
+			t.Fatalf("高度为%d的coinbase交易期望领取%d，实际领取%d", height, chain.GetSubsidy(height), value)
+		}
+	}
+}
+
+func TestCreateChainCorruptTip(t *testing.T) {
+	db := storage.NewMemoryDB()
+	err := db.Update(func(tx storage.Tx) error {
+		bucket, err := tx.CreateBucket([]byte(BLOCKS))
+		if err != nil {
+			return err
+		}
+		err = bucket.Put([]byte(LASTHASH), []byte("tip"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("tip"), append(BLOCKMAGIC, 0x03))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Consensus = "instant"
+	_, err = CreateChain(db, cfg)
+	if err == nil {
+		t.Fatal("最新区块的数据损坏时应该返回错误")
+	}
+}
+
+func TestSpendFromUncompressedWIF(t *testing.T) {
+	chain := newTestChain(t, nil)
+	//非压缩格式的WIF私钥，地址由非压缩格式的公钥计算得到
+	from, err := chain.ImportPrivKey("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ", "")
+	if err != nil {
+		t.Fatalf("导入私钥失败：%v", err)
+	}
+	if from != "1GAehh7TsJAHuUAeKZcXf5CnwuGuGgyX2S" {
+		t.Fatalf("导入的地址不正确：%s", from)
+	}
+	keyPair, err := chain.DumpPrivkey(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyPair.Compressed() {
+		t.Fatal("非压缩格式的WIF私钥导入后公钥应该是非压缩格式")
+	}
+	to, _ := newTestAddress(t, chain)
+	err = chain.CreateCoinBase(from)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	//交易输入中的公钥必须是非压缩格式，才能与地址的公钥哈希一致
+	_, err = chain.SendTransaction([]string{from}, []string{to}, []transaction.Amount{transaction.COIN}, 0)
+	if err != nil {
+		t.Fatalf("发送交易失败：%v", err)
+	}
+	_, err = chain.MineBlock(context.Background(), to)
+	if err != nil {
+		t.Fatalf("挖矿失败：%v", err)
+	}
+	balance, err := chain.GetBalance(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != transaction.COIN {
+		t.Fatalf("期望余额为%d，实际为%d", transaction.COIN, balance)
+	}
+}
+
+func TestSendTransactionRejectsZeroAmount(t *testing.T) {
+	chain := newTestChain(t, nil)
+	from, _ := newTestAddress(t, chain)
+	to, _ := newTestAddress(t, chain)
+	//没有任何utxo的地址转账0个币，也不能越界访问utxos
+	_, err := chain.SendTransaction([]string{from}, []string{to}, []transaction.Amount{0}, 0)
+	if err == nil {
+		t.Fatal("转账数量为0时应该返回错误")
+	}
+	err = chain.CreateCoinBase(from)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	_, err = chain.SendTransaction([]string{from}, []string{to}, []transaction.Amount{-transaction.COIN}, 0)
+	if err == nil {
+		t.Fatal("转账数量为负数时应该返回错误")
+	}
+	//没有utxo的地址即使手续费和金额都满足检查，也应该返回余额不足
+	_, err = chain.SendTransaction([]string{to}, []string{from}, []transaction.Amount{transaction.COIN}, 0)
+	if err == nil {
+		t.Fatal("没有utxo的地址转账应该返回错误")
+	}
+}
+
+func TestMineBlockDropsInvalidMempoolTxs(t *testing.T) {
+	chain := newTestChain(t, nil)
+	from, priv := newTestAddress(t, chain)
+	to, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(from)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	valid, err := chain.SendTransaction([]string{from}, []string{to}, []transaction.Amount{transaction.COIN}, 0)
+	if err != nil {
+		t.Fatalf("发送交易失败：%v", err)
+	}
+	//模拟交易池中已经失效的交易：花费的输出不在UTXO集合中，以及依赖于它的子交易
+	stale := newTestTx(t, [32]byte{0xee}, 0, to, priv, transaction.COIN)
+	child := newTestTx(t, stale.TxHash, 0, to, priv, transaction.COIN)
+	for _, poolTx := range []transaction.Transaction{stale, child} {
+		err = chain.Mempool.Add(poolTx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	block, err := chain.MineBlock(context.Background(), to)
+	if err != nil {
+		t.Fatalf("交易池中有失效的交易时挖矿失败：%v", err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[1].TxHash != valid[0] {
+		t.Fatalf("区块中应该只打包有效的交易，实际打包了%d笔交易", len(block.Transactions))
+	}
+	if chain.Mempool.Has(stale.TxHash) || chain.Mempool.Has(child.TxHash) {
+		t.Fatal("失效的交易及其子交易应该从交易池中删除")
+	}
+}
@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"XianfengChain04/consensus"
+	"XianfengChain04/storage"
+	"XianfengChain04/utils"
+	"math/big"
+)
+
+const BLOCKINDEX = "blockindex"
+const HEIGHTINDEX = "heightindex"
+
+/**
+ * 区块索引：每个已保存的区块(包括分叉上的区块)的高度、前一个区块的hash，
+ * 以及从创世区块到该区块的累计工作量，用于选择累计工作量最大的链
+ */
+type blockIndexEntry struct {
+	Height   int64
+	PrevHash [32]byte
+	Work     []byte //累计工作量，big.Int的字节表示
+}
+
+func (entry blockIndexEntry) work() *big.Int {
+	return new(big.Int).SetBytes(entry.Work)
+}
+
+/**
+ * 在区块索引中查找区块，找不到时返回nil
+ */
+func getIndexEntry(tx storage.Tx, hash [32]byte) (*blockIndexEntry, error) {
+	bucket := tx.Bucket([]byte(BLOCKINDEX))
+	if bucket == nil {
+		return nil, nil
+	}
+	entryBytes := bucket.Get(hash[:])
+	if len(entryBytes) == 0 {
+		return nil, nil
+	}
+	var entry blockIndexEntry
+	_, err := utils.Decode(entryBytes, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+/**
+ * 把区块加入区块索引，parentWork为前一个区块的累计工作量，返回该区块的索引记录
+ */
+func putIndexEntry(tx storage.Tx, block Block, parentWork *big.Int) (*blockIndexEntry, error) {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(BLOCKINDEX))
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int).Add(parentWork, consensus.CalcWork(block.Bits))
+	entry := &blockIndexEntry{
+		Height:   block.Height,
+		PrevHash: block.PrevHash,
+		Work:     work.Bytes(),
+	}
+	entryBytes, err := utils.Encode(entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, bucket.Put(block.Hash[:], entryBytes)
+}
+
+/**
+ * 高度索引桶中的key：区块高度的大端序编码，按照高度顺序排列
+ */
+func heightKey(height int64) []byte {
+	key, _ := utils.Int2Byte(height)
+	return key
+}
+
+/**
+ * 主链上的区块按照高度记录到高度索引中，连接区块时添加，断开区块时删除
+ */
+func putHeightIndex(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(HEIGHTINDEX))
+	if err != nil {
+		return err
+	}
+	return bucket.Put(heightKey(block.Height), block.Hash[:])
+}
+
+func deleteHeightIndex(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(HEIGHTINDEX))
+	if err != nil {
+		return err
+	}
+	return bucket.Delete(heightKey(block.Height))
+}
+
+/**
+ * 在高度索引中查找主链上某个高度的区块hash，找不到时返回false
+ */
+func getHashByHeight(tx storage.Tx, height int64) ([32]byte, bool) {
+	var hash [32]byte
+	bucket := tx.Bucket([]byte(HEIGHTINDEX))
+	if bucket == nil {
+		return hash, false
+	}
+	hashBytes := bucket.Get(heightKey(height))
+	if len(hashBytes) != 32 {
+		return hash, false
+	}
+	copy(hash[:], hashBytes)
+	return hash, true
+}
+
+/**
+ * 使用blocks(从最新区块到创世区块的顺序)重建区块索引和高度索引，旧版本的区块文件中没有这两个索引
+ */
+func reindexBlockIndex(tx storage.Tx, blocks []Block) error {
+	for _, name := range []string{BLOCKINDEX, HEIGHTINDEX} {
+		if tx.Bucket([]byte(name)) != nil {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	work := big.NewInt(0)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		entry, err := putIndexEntry(tx, blocks[i], work)
+		if err != nil {
+			return err
+		}
+		work = entry.work()
+		err = putHeightIndex(tx, blocks[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 根据主链上的区块重建区块索引和高度索引
+ */
+func (chain *BlockChain) ReindexBlockIndex() error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	blocks, err := chain.getAllBlocks()
+	if err != nil {
+		return err
+	}
+	return chain.DB.Update(func(tx storage.Tx) error {
+		return reindexBlockIndex(tx, blocks)
+	})
+}
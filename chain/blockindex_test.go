@@ -0,0 +1,142 @@
+package chain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+/**
+ * 检查高度索引中从创世区块开始的区块依次为blocks，并且没有更高的区块
+ */
+func checkHeightIndex(t *testing.T, chain *BlockChain, blocks []Block) {
+	for height, expect := range blocks {
+		block, err := chain.GetBlockByHeight(int64(height))
+		if err != nil {
+			t.Fatalf("查找高度为%d的区块失败：%v", height, err)
+		}
+		if block.Hash != expect.Hash {
+			t.Fatalf("高度为%d的区块不在主链上：%x", height, block.Hash)
+		}
+	}
+	_, err := chain.GetBlockHash(int64(len(blocks)))
+	if err != ErrBlockNotFound {
+		t.Fatalf("高度%d超过了主链的高度，期望返回%v，实际返回%v", len(blocks), ErrBlockNotFound, err)
+	}
+}
+
+func TestHeightIndexAfterReorg(t *testing.T) {
+	chain := newTestChain(t, nil)
+	addr, _ := newTestAddress(t, chain)
+	miner, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	mainChain := []Block{chain.GetLastBlock()}
+	for height := int64(1); height <= 3; height++ {
+		block := newTestBlockOn(t, chain, mainChain[height-1], addr, chain.GetSubsidy(height), nil)
+		processTestBlock(t, chain, block)
+		mainChain = append(mainChain, block)
+	}
+	checkHeightIndex(t, chain, mainChain)
+
+	//从高度1开始分叉，分叉上的区块更多时切换，高度2和3的区块被替换
+	forkChain := append([]Block{}, mainChain[:2]...)
+	for height := int64(2); height <= 4; height++ {
+		block := newTestBlockOn(t, chain, forkChain[height-1], miner, chain.GetSubsidy(height), nil)
+		processTestBlock(t, chain, block)
+		forkChain = append(forkChain, block)
+		if height == 3 {
+			//累计工作量相同时高度索引不变
+			checkHeightIndex(t, chain, mainChain)
+		}
+	}
+	checkHeightIndex(t, chain, forkChain)
+	//被断开的区块仍然可以通过hash查到
+	block, err := chain.GetBlockByHash(mainChain[3].Hash)
+	if err != nil || block.Hash != mainChain[3].Hash {
+		t.Fatalf("分叉上的区块应该可以通过hash查到：%v", err)
+	}
+
+	//重建的高度索引与切换分叉之后的高度索引一致
+	err = chain.ReindexBlockIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeightIndex(t, chain, forkChain)
+}
+
+func TestGetBlocksPaging(t *testing.T) {
+	chain := newTestChain(t, nil)
+	addr, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	for height := 1; height <= 4; height++ {
+		_, err = chain.MineBlock(context.Background(), addr)
+		if err != nil {
+			t.Fatalf("挖矿失败：%v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		from   int64
+		limit  int
+		expect []int64
+	}{
+		{"从最新区块开始", -1, 2, []int64{4, 3}},
+		{"从中间开始", 2, 2, []int64{2, 1}},
+		{"到达创世区块", 1, 5, []int64{1, 0}},
+		{"只有创世区块", 0, 1, []int64{0}},
+		{"超过最新区块的高度", 10, 2, []int64{}},
+		{"不限制数量", -1, 0, []int64{4, 3, 2, 1, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blocks, err := chain.GetBlocks(test.from, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			heights := make([]int64, 0)
+			for _, block := range blocks {
+				heights = append(heights, block.Height)
+			}
+			if !reflect.DeepEqual(heights, test.expect) {
+				t.Fatalf("期望返回高度为%v的区块，实际为%v", test.expect, heights)
+			}
+		})
+	}
+
+	//按页查询所有区块，每一页从上一页最后一个区块的前一个高度开始，页与页之间不重复也不遗漏
+	all, err := chain.GetAllBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paged := make([]Block, 0)
+	from := int64(-1)
+	for {
+		page, err := chain.GetBlocks(from, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+		from = page[len(page)-1].Height - 1
+		if from < 0 {
+			break
+		}
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("分页查询到%d个区块，期望%d个", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i].Hash != all[i].Hash {
+			t.Fatalf("分页查询的第%d个区块不正确", i)
+		}
+	}
+}
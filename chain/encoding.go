@@ -0,0 +1,139 @@
+package chain
+
+import (
+	"XianfengChain04/transaction"
+	"XianfengChain04/utils"
+	"bytes"
+	"errors"
+)
+
+/**
+ * 区块的二进制编码格式(整数均为大端序)：
+ *   标识"XFCB"(4字节) | 编码版本(1字节) | 高度(8字节) | 版本(8字节) | 前一个区块hash(32字节) |
+ *   区块hash(32字节) | 默克尔根(32字节) | 时间戳(8字节) | 难度目标(4字节) | nonce(8字节) |
+ *   附加数据长度(4字节) | 附加数据 | 交易个数(4字节) |
+ *   每笔交易: 交易hash(32字节) | 交易编码长度(4字节) | 交易编码
+ * 交易hash单独保存，旧版本的交易hash是由gob编码计算得到的，无法由交易编码重新计算
+ * 编码版本1没有难度目标和附加数据字段，编码版本2没有附加数据字段
+ */
+var BLOCKMAGIC = []byte("XFCB")
+
+const BLOCKENCODINGVERSION = 0x03
+
+var ErrBlockEncoding = errors.New("区块数据的格式不正确")
+
+/**
+ * 判断数据是否是二进制编码格式的区块，不是则为旧版本gob编码的区块
+ */
+func hasBlockMagic(data []byte) bool {
+	return len(data) > len(BLOCKMAGIC) && bytes.Equal(data[:len(BLOCKMAGIC)], BLOCKMAGIC)
+}
+
+/**
+ * 区块的二进制编码
+ */
+func (block Block) MarshalBinary() ([]byte, error) {
+	buff := new(bytes.Buffer)
+	buff.Write(BLOCKMAGIC)
+	utils.WriteUint8(buff, BLOCKENCODINGVERSION)
+	utils.WriteInt64(buff, block.Height)
+	utils.WriteInt64(buff, block.Version)
+	utils.WriteHash(buff, block.PrevHash)
+	utils.WriteHash(buff, block.Hash)
+	utils.WriteHash(buff, block.MerkleRoot)
+	utils.WriteInt64(buff, block.TimeStamp)
+	utils.WriteUint32(buff, block.Bits)
+	utils.WriteInt64(buff, block.Nonce)
+	utils.WriteVarBytes(buff, block.Extra)
+	utils.WriteUint32(buff, uint32(len(block.Transactions)))
+	for _, tx := range block.Transactions {
+		txBytes, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		utils.WriteHash(buff, tx.TxHash)
+		utils.WriteVarBytes(buff, txBytes)
+	}
+	return buff.Bytes(), nil
+}
+
+/**
+ * 从二进制数据中解码区块
+ */
+func (block *Block) UnmarshalBinary(data []byte) error {
+	if !hasBlockMagic(data) {
+		return ErrBlockEncoding
+	}
+	reader := bytes.NewReader(data[len(BLOCKMAGIC):])
+	version, err := utils.ReadUint8(reader)
+	if err != nil {
+		return err
+	}
+	if version == 0 || version > BLOCKENCODINGVERSION {
+		return errors.New("不支持的区块编码版本")
+	}
+	var decoded Block
+	fields := []*int64{&decoded.Height, &decoded.Version}
+	for _, field := range fields {
+		*field, err = utils.ReadInt64(reader)
+		if err != nil {
+			return err
+		}
+	}
+	hashes := []*[32]byte{&decoded.PrevHash, &decoded.Hash, &decoded.MerkleRoot}
+	for _, hash := range hashes {
+		*hash, err = utils.ReadHash(reader)
+		if err != nil {
+			return err
+		}
+	}
+	decoded.TimeStamp, err = utils.ReadInt64(reader)
+	if err != nil {
+		return err
+	}
+	if version != 0x01 {
+		decoded.Bits, err = utils.ReadUint32(reader)
+		if err != nil {
+			return err
+		}
+	}
+	decoded.Nonce, err = utils.ReadInt64(reader)
+	if err != nil {
+		return err
+	}
+	if version >= 0x03 {
+		decoded.Extra, err = utils.ReadVarBytes(reader)
+		if err != nil {
+			return err
+		}
+	}
+	txNum, err := utils.ReadUint32(reader)
+	if err != nil {
+		return err
+	}
+	//每笔交易至少占用36个字节，防止恶意数据导致分配过大的内存
+	if int64(txNum)*36 > int64(reader.Len()) {
+		return ErrBlockEncoding
+	}
+	decoded.Transactions = make([]transaction.Transaction, txNum)
+	for i := range decoded.Transactions {
+		txHash, err := utils.ReadHash(reader)
+		if err != nil {
+			return err
+		}
+		txBytes, err := utils.ReadVarBytes(reader)
+		if err != nil {
+			return err
+		}
+		err = decoded.Transactions[i].UnmarshalBinary(txBytes)
+		if err != nil {
+			return err
+		}
+		decoded.Transactions[i].TxHash = txHash
+	}
+	if reader.Len() != 0 {
+		return ErrBlockEncoding
+	}
+	*block = decoded
+	return nil
+}
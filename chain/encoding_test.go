@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"XianfengChain04/transaction"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+/**
+ * 测试向量中使用的区块，包含一笔coinbase交易
+ */
+func testVectorBlock() Block {
+	var txHash [32]byte
+	hex.Decode(txHash[:], []byte("cb69cd9aa96227b35aa0518102de77f448f36b8641c75af33685a2a209a72a1c"))
+	var prevHash, hash, merkleRoot [32]byte
+	copy(prevHash[:], bytes.Repeat([]byte{0x44}, 32))
+	copy(hash[:], bytes.Repeat([]byte{0x55}, 32))
+	copy(merkleRoot[:], bytes.Repeat([]byte{0x66}, 32))
+	return Block{
+		Height:     1,
+		Version:    2,
+		PrevHash:   prevHash,
+		Hash:       hash,
+		MerkleRoot: merkleRoot,
+		TimeStamp:  1700000000,
+		Bits:       0x1d00ffff,
+		Nonce:      42,
+		Extra:      []byte{0xee},
+		Transactions: []transaction.Transaction{{
+			TxHash:  txHash,
+			Inputs:  []transaction.TxInput{{Vout: -1, Signature: []byte{0x01}, PubKey: []byte{}}},
+			Outputs: []transaction.TxOutput{{Value: 50 * transaction.COIN, ScriptPub: bytes.Repeat([]byte{0x33}, 20)}},
+		}},
+	}
+}
+
+/**
+ * 按照区块的编码格式手工拼接的测试向量
+ */
+const testVectorTxHex = "01" + //交易编码版本
+	"00000001" + //输入个数
+	"0000000000000000000000000000000000000000000000000000000000000000" + //交易hash
+	"ffffffffffffffff" + //输出序号-1
+	"00000001" + "01" + //签名中存放区块高度
+	"00000000" + //公钥
+	"00000001" + //输出个数
+	"000000012a05f200" + //金额
+	"00000014" + "3333333333333333333333333333333333333333" //锁定脚本
+
+const testVectorBlockHex = "58464342" + //标识"XFCB"
+	"03" + //编码版本
+	"0000000000000001" + //高度
+	"0000000000000002" + //版本
+	"4444444444444444444444444444444444444444444444444444444444444444" + //前一个区块hash
+	"5555555555555555555555555555555555555555555555555555555555555555" + //区块hash
+	"6666666666666666666666666666666666666666666666666666666666666666" + //默克尔根
+	"000000006553f100" + //时间戳
+	"1d00ffff" + //难度目标
+	"000000000000002a" + //nonce
+	"00000001" + "ee" + //附加数据
+	"00000001" + //交易个数
+	"cb69cd9aa96227b35aa0518102de77f448f36b8641c75af33685a2a209a72a1c" + //交易hash
+	"0000005a" + testVectorTxHex
+
+func TestBlockBinaryVector(t *testing.T) {
+	block := testVectorBlock()
+	data, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != testVectorBlockHex {
+		t.Fatalf("区块的编码不正确：%x", data)
+	}
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, block) {
+		t.Fatalf("解码得到的区块不一致：%+v", decoded)
+	}
+	//解码得到的交易hash与交易编码计算得到的一致
+	txHash := decoded.Transactions[0].TxHash
+	err = decoded.Transactions[0].SetTxHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Transactions[0].TxHash != txHash {
+		t.Fatalf("交易hash不正确：%x", decoded.Transactions[0].TxHash)
+	}
+}
+
+func TestDeserializeLegacyGob(t *testing.T) {
+	block := testVectorBlock()
+	legacy := gobBlock{
+		Height:     block.Height,
+		Version:    block.Version,
+		PrevHash:   block.PrevHash,
+		Hash:       block.Hash,
+		MerkleRoot: block.MerkleRoot,
+		TimeStamp:  block.TimeStamp,
+		Nonce:      block.Nonce,
+		Transactions: []gobTransaction{{
+			TxHash:  block.Transactions[0].TxHash,
+			Inputs:  []gobTxInput{{Vout: -1, Signature: []byte{0x01}}},
+			Outputs: []gobTxOutput{{Value: 50 * transaction.COIN, ScriptPub: bytes.Repeat([]byte{0x33}, 20)}},
+		}},
+	}
+	buff := new(bytes.Buffer)
+	err := gob.NewEncoder(buff).Encode(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Deserialize(buff.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//旧版本的区块没有难度目标和附加数据，gob不区分空切片和nil
+	block.Bits = 0
+	block.Extra = nil
+	block.Transactions[0].Inputs[0].PubKey = nil
+	if !reflect.DeepEqual(decoded, block) {
+		t.Fatalf("解码得到的区块不一致：%+v", decoded)
+	}
+}
+
+func TestDeserializeCorruptBinary(t *testing.T) {
+	data, err := hex.DecodeString(testVectorBlockHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//带有二进制编码标识的数据解码失败时直接返回错误，不再按照gob格式解码
+	_, err = Deserialize(data[:len(data)-1])
+	if err == nil {
+		t.Fatal("截断的区块数据应该解码失败")
+	}
+	_, err = Deserialize(append(data, 0x00))
+	if err != ErrBlockEncoding {
+		t.Fatalf("期望返回%v，实际返回%v", ErrBlockEncoding, err)
+	}
+}
@@ -0,0 +1,126 @@
+package chain
+
+import (
+	"XianfengChain04/consensus"
+	"XianfengChain04/storage"
+	"errors"
+)
+
+/**
+ * 在数据库事务中读取区块，供共识引擎读取已有的区块
+ */
+type blockReader struct {
+	bucket storage.Bucket
+}
+
+func (reader blockReader) GetBlockByHash(hash [32]byte) (consensus.BlockInterface, error) {
+	blockBytes := reader.bucket.Get(hash[:])
+	if len(blockBytes) == 0 {
+		return nil, nil
+	}
+	block, err := Deserialize(blockBytes)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+/**
+ * 每次读取都使用单独的只读事务读取区块，用于在数据库事务之外封装区块
+ */
+type dbReader struct {
+	db storage.DB
+}
+
+func (reader dbReader) GetBlockByHash(hash [32]byte) (consensus.BlockInterface, error) {
+	var block consensus.BlockInterface
+	err := reader.db.View(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(BLOCKS))
+		if bucket == nil {
+			return errors.New("区块数据库操作失败,请重试！")
+		}
+		var err error
+		block, err = blockReader{bucket}.GetBlockByHash(hash)
+		return err
+	})
+	return block, err
+}
+
+/**
+ * 计算下一个区块应该使用的难度目标
+ */
+func (chain *BlockChain) GetNextBits() (uint32, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.nextBits()
+}
+
+func (chain *BlockChain) nextBits() (uint32, error) {
+	var bits uint32
+	err := chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		bits, err = chain.calcTarget(tx, chain.LastBlock)
+		return err
+	})
+	return bits, err
+}
+
+/**
+ * 在数据库事务tx中由共识引擎计算追加在tip之后的区块应该使用的难度目标，还没有区块时计算创世区块的难度目标
+ */
+func (chain *BlockChain) calcTarget(tx storage.Tx, tip Block) (uint32, error) {
+	bucket := tx.Bucket([]byte(BLOCKS))
+	if bucket == nil {
+		return 0, errors.New("区块数据库操作失败,请重试！")
+	}
+	var parent consensus.BlockInterface
+	if tip.Hash != [32]byte{} {
+		parent = tip
+	}
+	return chain.Engine.CalcTarget(blockReader{bucket}, parent)
+}
+
+/**
+ * 在数据库事务tx中由共识引擎验证区块的封装数据
+ */
+func (chain *BlockChain) verifySeal(tx storage.Tx, block Block) error {
+	bucket := tx.Bucket([]byte(BLOCKS))
+	if bucket == nil {
+		return errors.New("区块数据库操作失败,请重试！")
+	}
+	return chain.Engine.VerifySeal(blockReader{bucket}, block)
+}
+
+/**
+ * 共识引擎需要本节点的私钥签名区块时(如PoA)，从钱包中找到配置的签名者地址的私钥交给共识引擎
+ */
+func (chain *BlockChain) authorizeEngine() error {
+	authorizer, ok := chain.Engine.(consensus.Authorizer)
+	if !ok || chain.Config.PoA.Signer == "" {
+		return nil
+	}
+	//钱包锁定时暂不授权，解锁钱包后再授权
+	if chain.Wallet.IsLocked() {
+		return nil
+	}
+	keyPair := chain.Wallet.Address[chain.Config.PoA.Signer]
+	if keyPair == nil {
+		return errors.New("当前钱包未找到签名者地址" + chain.Config.PoA.Signer + "的私钥")
+	}
+	priv, err := chain.Wallet.GetPrivKey(chain.Config.PoA.Signer)
+	if err != nil {
+		return err
+	}
+	authorizer.Authorize(priv, keyPair.Pub)
+	return nil
+}
+
+/**
+ * 收回交给共识引擎的私钥，钱包锁定时调用
+ */
+func (chain *BlockChain) deauthorizeEngine() {
+	authorizer, ok := chain.Engine.(consensus.Authorizer)
+	if ok {
+		authorizer.Authorize(nil, nil)
+	}
+}
@@ -1,11 +1,82 @@
 package chain
 
+import (
+	"XianfengChain04/storage"
+	"errors"
+)
+
+/**
+ * 区块迭代器，从某个区块开始沿着PrevHash往创世区块的方向遍历区块。迭代器有两个功能：
+ *   ① 判断是否还有区块
+ *   ② 取出一个区块
+ * 每个迭代器有自己的游标，多个迭代器之间以及迭代器与区块链之间互不影响
+ */
+type Iterator struct {
+	view        func(fn func(bucket storage.Bucket) error) error //读取区块桶的方式
+	currentHash [32]byte                                         //游标：下一次Next返回的区块的hash
+}
+
+/**
+ * 创建一个从fromHash对应的区块开始的迭代器，fromHash为空时从当前的最新区块开始
+ * 每次读取区块都使用单独的只读事务
+ */
+func (chain *BlockChain) NewIterator(fromHash [32]byte) *Iterator {
+	if fromHash == [32]byte{} {
+		fromHash = chain.GetLastBlock().Hash
+	}
+	db := chain.DB
+	return &Iterator{
+		view: func(fn func(bucket storage.Bucket) error) error {
+			return db.View(func(tx storage.Tx) error {
+				bucket := tx.Bucket([]byte(BLOCKS))
+				if bucket == nil {
+					return errors.New("区块数据库操作失败,请重试！")
+				}
+				return fn(bucket)
+			})
+		},
+		currentHash: fromHash,
+	}
+}
+
+/**
+ * 创建一个在已有的数据库事务中从区块桶读取区块的迭代器，用于调用者已经持有锁或者事务的情况
+ */
+func newBucketIterator(bucket storage.Bucket, fromHash [32]byte) *Iterator {
+	return &Iterator{
+		view: func(fn func(bucket storage.Bucket) error) error {
+			return fn(bucket)
+		},
+		currentHash: fromHash,
+	}
+}
+
+/**
+ * 判断是否还有区块，游标指向的区块不存在(如创世区块的前一个区块)时返回false
+ */
+func (iterator *Iterator) HasNext() bool {
+	var hasNext bool
+	iterator.view(func(bucket storage.Bucket) error {
+		hasNext = len(bucket.Get(iterator.currentHash[:])) != 0
+		return nil
+	})
+	return hasNext
+}
+
 /**
- * 定义迭代器的接口标准。通过总结分析，迭代器有两个功能：
-		① 判断容器中是否还有数据
-		② 从容器中取出一个数据
+ * 取出游标指向的区块，并把游标移动到该区块的前一个区块
+ * 读取或者解码区块失败时返回错误，游标不移动
  */
-type Iterator interface {
-	HasNext() bool //判断容器中是否还有数据
-	Next() Block   //如果容器中有数据，取出包含的一个数据区块
+func (iterator *Iterator) Next() (Block, error) {
+	var block Block
+	err := iterator.view(func(bucket storage.Bucket) error {
+		var err error
+		block, err = loadBlock(bucket, iterator.currentHash)
+		return err
+	})
+	if err != nil {
+		return Block{}, err
+	}
+	iterator.currentHash = block.PrevHash
+	return block, nil
 }
@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	chain := newTestChain(t, nil)
+	addr, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err = chain.MineBlock(context.Background(), addr)
+		if err != nil {
+			t.Fatalf("挖矿失败：%v", err)
+		}
+	}
+
+	//从最新区块开始依次取出高度为3、2、1、0的区块
+	iterator := chain.NewIterator([32]byte{})
+	height := chain.GetLastBlock().Height
+	for iterator.HasNext() {
+		block, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Height != height {
+			t.Fatalf("期望区块高度为%d，实际为%d", height, block.Height)
+		}
+		height--
+	}
+	if height != -1 {
+		t.Fatalf("迭代器没有遍历到创世区块，停在了高度%d", height+1)
+	}
+
+	//游标指向不存在的区块时返回错误
+	iterator = chain.NewIterator([32]byte{1})
+	if iterator.HasNext() {
+		t.Fatal("不存在的区块不应该有下一个区块")
+	}
+	_, err = iterator.Next()
+	if err == nil {
+		t.Fatal("取出不存在的区块应该返回错误")
+	}
+
+	blocks, err := chain.GetAllBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 || blocks[0].Hash != chain.GetLastBlock().Hash {
+		t.Fatalf("GetAllBlocks返回的区块不正确，共%d个区块", len(blocks))
+	}
+}
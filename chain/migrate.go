@@ -0,0 +1,218 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/wallet"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+)
+
+/**
+ * 旧版本的区块使用gob编码保存，gob按照字段名解码，旧版本的区块数据可以解码到以下的结构体中
+ * 注意：不能直接解码到transaction包中的结构体，它们实现了BinaryUnmarshaler，gob会改为调用二进制解码
+ */
+type gobTxInput struct {
+	TxId      [32]byte
+	Vout      int
+	Signature []byte
+	PubKey    []byte
+}
+
+type gobTxOutput struct {
+	Value     transaction.Amount
+	ScriptPub []byte
+}
+
+type gobTransaction struct {
+	TxHash  [32]byte
+	Inputs  []gobTxInput
+	Outputs []gobTxOutput
+}
+
+type gobBlock struct {
+	Height       int64
+	Version      int64
+	PrevHash     [32]byte
+	Hash         [32]byte
+	MerkleRoot   [32]byte
+	TimeStamp    int64
+	Nonce        int64
+	Transactions []gobTransaction
+}
+
+/**
+ * 更早版本区块文件中的交易输出：金额为float64类型，锁定脚本可能是地址字符串
+ */
+type legacyTxOutput struct {
+	Value     float64
+	ScriptPub []byte
+}
+
+type legacyTransaction struct {
+	TxHash  [32]byte
+	Inputs  []gobTxInput
+	Outputs []legacyTxOutput
+}
+
+type legacyBlock struct {
+	Height       int64
+	Version      int64
+	PrevHash     [32]byte
+	Hash         [32]byte
+	TimeStamp    int64
+	Nonce        int64
+	Transactions []legacyTransaction
+}
+
+func convertGobInputs(gobInputs []gobTxInput) []transaction.TxInput {
+	inputs := make([]transaction.TxInput, 0)
+	for _, input := range gobInputs {
+		inputs = append(inputs, transaction.TxInput{
+			TxId:      input.TxId,
+			Vout:      input.Vout,
+			Signature: input.Signature,
+			PubKey:    input.PubKey,
+		})
+	}
+	return inputs
+}
+
+/**
+ * 将旧版本gob编码的区块数据解码并转换为当前版本的区块，区块hash和交易hash保留原值
+ * 先按照金额为整数的格式解码，失败时再按照金额为float64的更早版本格式解码
+ */
+func deserializeLegacy(data []byte) (Block, error) {
+	var block gobBlock
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block)
+	if err != nil {
+		floatBlock, floatErr := deserializeFloatBlock(data)
+		if floatErr != nil {
+			return Block{}, err
+		}
+		return floatBlock, nil
+	}
+	txs := make([]transaction.Transaction, 0)
+	for _, gobTx := range block.Transactions {
+		outputs := make([]transaction.TxOutput, 0)
+		for _, output := range gobTx.Outputs {
+			outputs = append(outputs, transaction.TxOutput{
+				Value:     output.Value,
+				ScriptPub: output.ScriptPub,
+			})
+		}
+		txs = append(txs, transaction.Transaction{
+			TxHash:  gobTx.TxHash,
+			Inputs:  convertGobInputs(gobTx.Inputs),
+			Outputs: outputs,
+		})
+	}
+	return Block{
+		Height:       block.Height,
+		Version:      block.Version,
+		PrevHash:     block.PrevHash,
+		Hash:         block.Hash,
+		MerkleRoot:   block.MerkleRoot,
+		TimeStamp:    block.TimeStamp,
+		Nonce:        block.Nonce,
+		Transactions: txs,
+	}, nil
+}
+
+/**
+ * 解码金额为float64的旧版本区块数据：
+ * float64的金额四舍五入为最小单位，地址字符串形式的锁定脚本转换为公钥哈希
+ */
+func deserializeFloatBlock(data []byte) (Block, error) {
+	var legacy legacyBlock
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&legacy)
+	if err != nil {
+		return Block{}, err
+	}
+	txs := make([]transaction.Transaction, 0)
+	for _, legacyTx := range legacy.Transactions {
+		outputs := make([]transaction.TxOutput, 0)
+		for _, legacyOutput := range legacyTx.Outputs {
+			scriptPub := legacyOutput.ScriptPub
+			pubHash, err := wallet.GetPubHashByAddress(string(scriptPub))
+			if err == nil {
+				scriptPub = pubHash
+			}
+			outputs = append(outputs, transaction.TxOutput{
+				Value:     transaction.Amount(math.Round(legacyOutput.Value * float64(transaction.COIN))),
+				ScriptPub: scriptPub,
+			})
+		}
+		txs = append(txs, transaction.Transaction{
+			TxHash:  legacyTx.TxHash,
+			Inputs:  convertGobInputs(legacyTx.Inputs),
+			Outputs: outputs,
+		})
+	}
+	return Block{
+		Height:       legacy.Height,
+		Version:      legacy.Version,
+		PrevHash:     legacy.PrevHash,
+		Hash:         legacy.Hash,
+		TimeStamp:    legacy.TimeStamp,
+		Nonce:        legacy.Nonce,
+		Transactions: txs,
+	}, nil
+}
+
+/**
+ * 将区块文件中旧版本gob编码的区块全部转换为当前版本的二进制编码重新保存，并重建UTXO集合
+ * 返回被转换的区块数量
+ */
+func (chain *BlockChain) MigrateBlocks() (int, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	var migrated int
+	err := chain.DB.Update(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(BLOCKS))
+		if bucket == nil {
+			return errors.New("区块数据库操作失败,请重试！")
+		}
+		//1、找出所有旧版本格式的区块数据，遍历过程中不能修改桶，先收集起来
+		upgraded := make(map[string][]byte)
+		err := bucket.ForEach(func(k, v []byte) error {
+			if string(k) == LASTHASH {
+				return nil
+			}
+			if hasBlockMagic(v) {
+				return nil
+			}
+			block, err := deserializeLegacy(v)
+			if err != nil {
+				return err
+			}
+			blockBytes, err := block.Serialize()
+			if err != nil {
+				return err
+			}
+			upgraded[string(k)] = blockBytes
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		//2、以当前版本的格式重新保存
+		for k, v := range upgraded {
+			err = bucket.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+		migrated = len(upgraded)
+		//3、UTXO集合中的交易输出也是旧的格式，根据转换后的区块重建
+		blocks, err := getAllBlocksFromBucket(bucket)
+		if err != nil {
+			return err
+		}
+		return reindexUTXO(tx, blocks)
+	})
+	return migrated, err
+}
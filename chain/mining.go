@@ -0,0 +1,47 @@
+package chain
+
+import (
+	"context"
+	"sync"
+)
+
+/**
+ * 正在进行的挖矿：区块链有了新的最新区块时，正在挖的区块已经过时，需要取消
+ */
+type miningState struct {
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+}
+
+/**
+ * 开始挖矿，返回挖矿使用的ctx和挖矿结束时需要调用的stop函数
+ */
+func (chain *BlockChain) startMining(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	state := chain.mining
+	state.mutex.Lock()
+	if state.cancel != nil {
+		state.cancel()
+	}
+	state.cancel = cancel
+	state.mutex.Unlock()
+	return ctx, func() {
+		cancel()
+		state.mutex.Lock()
+		state.cancel = nil
+		state.mutex.Unlock()
+	}
+}
+
+/**
+ * 取消正在进行的挖矿
+ */
+func (chain *BlockChain) abortMining() {
+	state := chain.mining
+	state.mutex.Lock()
+	if state.cancel != nil {
+		state.cancel()
+		state.cancel = nil
+	}
+	state.mutex.Unlock()
+}
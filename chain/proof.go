@@ -0,0 +1,55 @@
+package chain
+
+import (
+	"XianfengChain04/merkle"
+	"XianfengChain04/storage"
+)
+
+/**
+ * 交易的默克尔证明：轻节点只需要区块头中的默克尔根，就可以验证交易被包含在该区块中
+ */
+type MerkleProof struct {
+	TxId       [32]byte           //交易hash
+	BlockHash  [32]byte           //交易所在区块的hash
+	Height     int64              //交易所在区块的高度
+	MerkleRoot [32]byte           //交易所在区块的默克尔根
+	Path       []merkle.ProofNode //从交易到默克尔根路径上的兄弟节点
+}
+
+/**
+ * 查找交易所在的区块，生成该交易的默克尔证明
+ */
+func (chain *BlockChain) GetMerkleProof(txId [32]byte) (*MerkleProof, error) {
+	var block Block
+	var index int
+	err := chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		block, index, err = findTransaction(tx, txId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	txHashes := make([][32]byte, 0)
+	for _, tx := range block.Transactions {
+		txHashes = append(txHashes, tx.TxHash)
+	}
+	path, err := merkle.GetMerkleProof(txHashes, index)
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleProof{
+		TxId:       txId,
+		BlockHash:  block.Hash,
+		Height:     block.Height,
+		MerkleRoot: block.MerkleRoot,
+		Path:       path,
+	}, nil
+}
+
+/**
+ * 验证默克尔证明是否有效
+ */
+func (proof MerkleProof) Verify() bool {
+	return merkle.VerifyProof(proof.TxId, proof.MerkleRoot, proof.Path)
+}
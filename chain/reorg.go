@@ -0,0 +1,279 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"errors"
+	"math/big"
+)
+
+var ErrGenesisExists = errors.New("创世区块已经存在")
+
+/**
+ * 添加区块引起的最新区块的变化：区块只是保存在分叉上时两个列表都为空
+ * 切换到累计工作量更大的分叉时，原来的链上被断开的区块中的交易需要重新广播或者重新打包
+ */
+type Reorg struct {
+	Disconnected []Block //被断开的区块，从原来的最新区块开始
+	Connected    []Block //被连接的区块，从分叉点之后的第一个区块开始，最后一个为新的最新区块
+}
+
+/**
+ * 被断开的区块中的交易(不包括coinbase交易和新连接的区块中已经包含的交易)，按照原来的顺序排列
+ */
+func (reorg *Reorg) DisconnectedTxs() []transaction.Transaction {
+	connected := make(map[[32]byte]bool)
+	for _, block := range reorg.Connected {
+		for _, blockTx := range block.Transactions {
+			connected[blockTx.TxHash] = true
+		}
+	}
+	txs := make([]transaction.Transaction, 0)
+	for i := len(reorg.Disconnected) - 1; i >= 0; i-- {
+		for _, blockTx := range reorg.Disconnected[i].Transactions {
+			if blockTx.IsCoinBase() || connected[blockTx.TxHash] {
+				continue
+			}
+			txs = append(txs, blockTx)
+		}
+	}
+	return txs
+}
+
+/**
+ * 从区块桶中读取区块
+ */
+func loadBlock(bucket storage.Bucket, hash [32]byte) (Block, error) {
+	blockBytes := bucket.Get(hash[:])
+	if len(blockBytes) == 0 {
+		return Block{}, errors.New("区块数据不存在")
+	}
+	return Deserialize(blockBytes)
+}
+
+/**
+ * 添加一个区块：区块不论是否连接在最新区块之后都会按照hash保存，并加入区块索引
+ * 区块所在分支的累计工作量超过当前最新区块时，切换到该分支
+ * 返回最新区块的变化，调用者需要在数据库事务提交后调用afterReorg
+ */
+func (chain *BlockChain) processBlock(tx storage.Tx, block Block) (*Reorg, error) {
+	bucket := tx.Bucket([]byte(BLOCKS))
+	if bucket == nil {
+		return nil, errors.New("区块数据库操作失败，请重试!")
+	}
+	if len(bucket.Get(block.Hash[:])) != 0 {
+		return nil, ErrBlockExists
+	}
+	tipHash := bucket.Get([]byte(LASTHASH))
+
+	//1、找到区块的前一个区块，创世区块只能在还没有区块时添加
+	var parent Block
+	parentWork := big.NewInt(0)
+	if block.Height == 0 && block.PrevHash == [32]byte{} {
+		if len(tipHash) != 0 {
+			return nil, ErrGenesisExists
+		}
+	} else {
+		parentEntry, err := getIndexEntry(tx, block.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		if parentEntry == nil {
+			return nil, ErrOrphanBlock
+		}
+		parent, err = loadBlock(bucket, block.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		if block.Height != parent.Height+1 {
+			return nil, ErrInvalidHeight
+		}
+		parentWork = parentEntry.work()
+	}
+
+	//2、验证区块中不依赖UTXO集合的部分，区块中的交易在连接区块时再验证
+	err := chain.validateHeader(tx, block, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	//3、按照hash保存区块，并加入区块索引
+	blockSerBytes, err := block.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	err = bucket.Put(block.Hash[:], blockSerBytes)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := putIndexEntry(tx, block, parentWork)
+	if err != nil {
+		return nil, err
+	}
+
+	//4、累计工作量没有超过当前最新区块时，区块只保存在分叉上
+	reorg := &Reorg{}
+	if len(tipHash) != 0 {
+		var tip [32]byte
+		copy(tip[:], tipHash)
+		tipEntry, err := getIndexEntry(tx, tip)
+		if err != nil {
+			return nil, err
+		}
+		if tipEntry != nil && entry.work().Cmp(tipEntry.work()) <= 0 {
+			return reorg, nil
+		}
+	}
+	return reorg, chain.reorganize(tx, bucket, block, reorg)
+}
+
+/**
+ * 切换到以newTip为最新区块的分支：从原来的最新区块开始断开区块直到分叉点，
+ * 再从分叉点开始依次验证并连接新分支上的区块，任何一个区块验证失败时整个数据库事务回滚
+ */
+func (chain *BlockChain) reorganize(tx storage.Tx, bucket storage.Bucket, newTip Block, reorg *Reorg) error {
+	connect := []Block{newTip} //从newTip往前
+	disconnect := make([]Block, 0)
+	tipHash := bucket.Get([]byte(LASTHASH))
+	if len(tipHash) != 0 {
+		var hash [32]byte
+		copy(hash[:], tipHash)
+		oldBranch, err := loadBlock(bucket, hash)
+		if err != nil {
+			return err
+		}
+		//1、找到两个分支的分叉点：先把较高的分支回退到相同高度，再同时回退直到两个分支相遇
+		newBranch := newTip
+		for newBranch.Height > oldBranch.Height+1 {
+			newBranch, err = loadBlock(bucket, newBranch.PrevHash)
+			if err != nil {
+				return err
+			}
+			connect = append(connect, newBranch)
+		}
+		for oldBranch.Height >= newBranch.Height {
+			disconnect = append(disconnect, oldBranch)
+			oldBranch, err = loadBlock(bucket, oldBranch.PrevHash)
+			if err != nil {
+				return err
+			}
+		}
+		for newBranch.PrevHash != oldBranch.Hash {
+			disconnect = append(disconnect, oldBranch)
+			oldBranch, err = loadBlock(bucket, oldBranch.PrevHash)
+			if err != nil {
+				return err
+			}
+			newBranch, err = loadBlock(bucket, newBranch.PrevHash)
+			if err != nil {
+				return err
+			}
+			connect = append(connect, newBranch)
+		}
+	}
+
+	//2、断开原来的分支上的区块
+	for _, block := range disconnect {
+		err := unindexAddresses(tx, block)
+		if err != nil {
+			return err
+		}
+		err = disconnectUTXOSet(tx, block)
+		if err != nil {
+			return err
+		}
+		err = deleteHeightIndex(tx, block)
+		if err != nil {
+			return err
+		}
+		if chain.Config.TxIndex {
+			err = unindexTransactions(tx, block)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	//3、从分叉点开始依次验证并连接新分支上的区块
+	for i := len(connect) - 1; i >= 0; i-- {
+		block := connect[i]
+		err := chain.validateBody(tx, block)
+		if err != nil {
+			return err
+		}
+		err = updateUTXOSet(tx, block)
+		if err != nil {
+			return err
+		}
+		err = putHeightIndex(tx, block)
+		if err != nil {
+			return err
+		}
+		err = indexAddresses(tx, block)
+		if err != nil {
+			return err
+		}
+		if chain.Config.TxIndex {
+			err = indexTransactions(tx, block)
+			if err != nil {
+				return err
+			}
+		}
+		reorg.Connected = append(reorg.Connected, block)
+	}
+	reorg.Disconnected = disconnect
+	return bucket.Put([]byte(LASTHASH), newTip.Hash[:])
+}
+
+/**
+ * 数据库事务提交后，根据最新区块的变化更新内存中的最新区块和交易池：
+ * 没有断开区块时从交易池中删除新区块中的交易，否则把被断开的交易和交易池中的交易重新验证后加入交易池
+ */
+func (chain *BlockChain) afterReorg(reorg *Reorg) error {
+	if len(reorg.Connected) == 0 {
+		return nil
+	}
+	newTip := reorg.Connected[len(reorg.Connected)-1]
+	chain.LastBlock = newTip
+	//有了新的最新区块，正在挖的区块已经过时
+	chain.abortMining()
+
+	if len(reorg.Disconnected) == 0 {
+		for _, block := range reorg.Connected {
+			err := chain.Mempool.RemoveBlockTxs(block.Transactions)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	candidates := append(reorg.DisconnectedTxs(), chain.Mempool.GetTransactions()...)
+	err := chain.Mempool.Clear()
+	if err != nil {
+		return err
+	}
+	for _, candidate := range candidates {
+		//已经被新分支包含或者与新分支冲突的交易不再有效，忽略
+		chain.acceptTransaction(candidate)
+	}
+	return nil
+}
+
+/**
+ * 添加一个区块，返回最新区块的变化
+ * 区块只是保存在分叉上时，返回的Reorg中的列表都为空
+ */
+func (chain *BlockChain) ProcessBlock(block Block) (*Reorg, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	var reorg *Reorg
+	err := chain.DB.Update(func(tx storage.Tx) error {
+		var err error
+		reorg, err = chain.processBlock(tx, block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reorg, chain.afterReorg(reorg)
+}
@@ -0,0 +1,117 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"testing"
+)
+
+/**
+ * 查询UTXO集合中是否有txId:vout
+ */
+func hasUTXO(t *testing.T, chain *BlockChain, txId [32]byte, vout int) bool {
+	var entry *utxoEntry
+	err := chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		entry, err = getUTXO(tx, txId, vout)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry != nil
+}
+
+func processTestBlock(t *testing.T, chain *BlockChain, block Block) *Reorg {
+	reorg, err := chain.ProcessBlock(block)
+	if err != nil {
+		t.Fatalf("添加高度为%d的区块失败：%v", block.Height, err)
+	}
+	return reorg
+}
+
+func TestReorganize(t *testing.T) {
+	chain := newTestChain(t, nil)
+	from, priv := newTestAddress(t, chain)
+	to, _ := newTestAddress(t, chain)
+	miner, _ := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(from)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	genesis := chain.GetLastBlock()
+	genesisTx := genesis.Transactions[0]
+
+	//主链：高度1的区块中的交易花费了创世区块的coinbase输出
+	spend := newTestTx(t, genesisTx.TxHash, 0, to, priv, genesisTx.Outputs[0].Value)
+	main1 := newTestBlockOn(t, chain, genesis, from, chain.GetSubsidy(1), []transaction.Transaction{spend})
+	processTestBlock(t, chain, main1)
+	if hasUTXO(t, chain, genesisTx.TxHash, 0) || !hasUTXO(t, chain, spend.TxHash, 0) {
+		t.Fatal("连接区块之后UTXO集合不正确")
+	}
+
+	//分叉：与主链累计工作量相同时不切换
+	fork1 := newTestBlockOn(t, chain, genesis, miner, chain.GetSubsidy(1), nil)
+	reorg := processTestBlock(t, chain, fork1)
+	if len(reorg.Connected) != 0 || len(reorg.Disconnected) != 0 {
+		t.Fatal("累计工作量相同的分叉不应该引起最新区块的变化")
+	}
+	if chain.GetLastBlock().Hash != main1.Hash {
+		t.Fatal("累计工作量相同时最新区块不应该改变")
+	}
+	if !hasUTXO(t, chain, spend.TxHash, 0) || hasUTXO(t, chain, fork1.Transactions[0].TxHash, 0) {
+		t.Fatal("保存在分叉上的区块不应该修改UTXO集合")
+	}
+
+	//分叉的累计工作量更大时切换到分叉
+	fork2 := newTestBlockOn(t, chain, fork1, miner, chain.GetSubsidy(2), nil)
+	reorg = processTestBlock(t, chain, fork2)
+	if len(reorg.Disconnected) != 1 || reorg.Disconnected[0].Hash != main1.Hash {
+		t.Fatalf("期望断开主链上的区块，实际断开了%d个区块", len(reorg.Disconnected))
+	}
+	if len(reorg.Connected) != 2 || reorg.Connected[0].Hash != fork1.Hash || reorg.Connected[1].Hash != fork2.Hash {
+		t.Fatalf("期望按顺序连接分叉上的2个区块，实际连接了%d个区块", len(reorg.Connected))
+	}
+	if chain.GetLastBlock().Hash != fork2.Hash {
+		t.Fatal("切换分叉之后最新区块不正确")
+	}
+	//根据撤销数据恢复被断开的区块花费的输出，删除其产生的输出
+	if !hasUTXO(t, chain, genesisTx.TxHash, 0) {
+		t.Fatal("被断开的区块花费的交易输出应该恢复到UTXO集合中")
+	}
+	if hasUTXO(t, chain, spend.TxHash, 0) || hasUTXO(t, chain, main1.Transactions[0].TxHash, 0) {
+		t.Fatal("被断开的区块产生的交易输出应该从UTXO集合中删除")
+	}
+	if !hasUTXO(t, chain, fork1.Transactions[0].TxHash, 0) || !hasUTXO(t, chain, fork2.Transactions[0].TxHash, 0) {
+		t.Fatal("新连接的区块产生的交易输出应该加入UTXO集合")
+	}
+	//被断开的区块中的交易重新加入交易池，coinbase交易除外
+	txs := reorg.DisconnectedTxs()
+	if len(txs) != 1 || txs[0].TxHash != spend.TxHash {
+		t.Fatalf("期望被断开的交易只有1笔，实际为%d笔", len(txs))
+	}
+	if !chain.Mempool.Has(spend.TxHash) {
+		t.Fatal("被断开的交易应该重新加入交易池")
+	}
+
+	//主链重新超过分叉时切换回来，交易池中已经被打包的交易被删除
+	main2 := newTestBlockOn(t, chain, main1, from, chain.GetSubsidy(2), nil)
+	processTestBlock(t, chain, main2)
+	main3 := newTestBlockOn(t, chain, main2, from, chain.GetSubsidy(3), nil)
+	reorg = processTestBlock(t, chain, main3)
+	if len(reorg.Disconnected) != 2 || len(reorg.Connected) != 3 {
+		t.Fatalf("期望断开2个区块并连接3个区块，实际断开%d个连接%d个", len(reorg.Disconnected), len(reorg.Connected))
+	}
+	if len(reorg.DisconnectedTxs()) != 0 {
+		t.Fatal("分叉上只有coinbase交易，不应该有需要重新加入交易池的交易")
+	}
+	if chain.Mempool.Has(spend.TxHash) {
+		t.Fatal("已经被新的主链打包的交易应该从交易池中删除")
+	}
+	if hasUTXO(t, chain, genesisTx.TxHash, 0) || !hasUTXO(t, chain, spend.TxHash, 0) {
+		t.Fatal("切换回主链之后UTXO集合不正确")
+	}
+	if hasUTXO(t, chain, fork1.Transactions[0].TxHash, 0) {
+		t.Fatal("切换回主链之后分叉上的交易输出应该被删除")
+	}
+}
@@ -0,0 +1,225 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/utils"
+	"errors"
+)
+
+const TXINDEX = "txindex"
+
+var ErrTxNotFound = errors.New("未找到该交易")
+
+/**
+ * 交易索引桶中的value：交易所在区块的hash和交易在区块中的位置
+ * 交易索引是可选的，配置文件中关闭时通过扫描主链上的区块查找交易
+ */
+type txIndexEntry struct {
+	BlockHash [32]byte
+	Index     int
+}
+
+/**
+ * 查询交易的结果
+ */
+type TxInfo struct {
+	Tx            transaction.Transaction
+	BlockHash     [32]byte                //交易所在区块的hash，交易还在交易池中时为空
+	Height        int64                   //交易所在区块的高度
+	Index         int                     //交易在区块中的位置
+	Confirmations int64                   //确认数，交易还在交易池中时为0
+	PrevOutputs   []*transaction.TxOutput //交易输入引用的交易输出，找不到时为nil，coinbase交易为空
+}
+
+/**
+ * 连接区块时把区块中的交易加入交易索引
+ */
+func indexTransactions(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(TXINDEX))
+	if err != nil {
+		return err
+	}
+	for index, blockTx := range block.Transactions {
+		entryBytes, err := utils.Encode(txIndexEntry{
+			BlockHash: block.Hash,
+			Index:     index,
+		})
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(blockTx.TxHash[:], entryBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 断开区块时从交易索引中删除区块中的交易
+ */
+func unindexTransactions(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(TXINDEX))
+	if err != nil {
+		return err
+	}
+	for _, blockTx := range block.Transactions {
+		err = bucket.Delete(blockTx.TxHash[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 使用blocks(从最新区块到创世区块的顺序)重建交易索引
+ */
+func reindexTransactions(tx storage.Tx, blocks []Block) error {
+	if tx.Bucket([]byte(TXINDEX)) != nil {
+		err := tx.DeleteBucket([]byte(TXINDEX))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.CreateBucket([]byte(TXINDEX))
+	if err != nil {
+		return err
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err = indexTransactions(tx, blocks[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 根据配置开启或者关闭交易索引：开启时如果还没有交易索引则根据主链上的区块建立，
+ * 关闭时删除交易索引，避免之后区块变化时索引中留下过时的记录
+ */
+func (chain *BlockChain) initTxIndex() error {
+	return chain.DB.Update(func(tx storage.Tx) error {
+		exists := tx.Bucket([]byte(TXINDEX)) != nil
+		if !chain.Config.TxIndex {
+			if exists {
+				return tx.DeleteBucket([]byte(TXINDEX))
+			}
+			return nil
+		}
+		if exists {
+			return nil
+		}
+		bucket := tx.Bucket([]byte(BLOCKS))
+		if bucket == nil {
+			return nil
+		}
+		blocks, err := getAllBlocksFromBucket(bucket)
+		if err != nil {
+			return err
+		}
+		return reindexTransactions(tx, blocks)
+	})
+}
+
+/**
+ * 在主链上查找交易所在的区块和交易在区块中的位置：有交易索引时使用交易索引，否则从最新区块开始扫描
+ */
+func findTransaction(tx storage.Tx, txId [32]byte) (Block, int, error) {
+	bucket := tx.Bucket([]byte(BLOCKS))
+	if bucket == nil {
+		return Block{}, 0, ErrTxNotFound
+	}
+	indexBucket := tx.Bucket([]byte(TXINDEX))
+	if indexBucket != nil {
+		entryBytes := indexBucket.Get(txId[:])
+		if len(entryBytes) == 0 {
+			return Block{}, 0, ErrTxNotFound
+		}
+		var entry txIndexEntry
+		_, err := utils.Decode(entryBytes, &entry)
+		if err != nil {
+			return Block{}, 0, err
+		}
+		block, err := loadBlock(bucket, entry.BlockHash)
+		if err != nil {
+			return Block{}, 0, err
+		}
+		return block, entry.Index, nil
+	}
+	blocks, err := getAllBlocksFromBucket(bucket)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	for _, block := range blocks {
+		for index, blockTx := range block.Transactions {
+			if blockTx.TxHash == txId {
+				return block, index, nil
+			}
+		}
+	}
+	return Block{}, 0, ErrTxNotFound
+}
+
+/**
+ * 根据交易hash查询主链上或者交易池中的交易，同时查询交易输入引用的交易输出
+ */
+func (chain *BlockChain) GetTransaction(txId [32]byte) (*TxInfo, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	var info *TxInfo
+	err := chain.DB.View(func(tx storage.Tx) error {
+		block, index, err := findTransaction(tx, txId)
+		if err == nil {
+			info = &TxInfo{
+				Tx:            block.Transactions[index],
+				BlockHash:     block.Hash,
+				Height:        block.Height,
+				Index:         index,
+				Confirmations: chain.LastBlock.Height - block.Height + 1,
+			}
+		} else if err != ErrTxNotFound {
+			return err
+		} else if entry, ok := chain.Mempool.Entries[txId]; ok {
+			info = &TxInfo{
+				Tx: entry.Tx,
+			}
+		} else {
+			return ErrTxNotFound
+		}
+
+		//查询交易输入引用的交易输出
+		if info.Tx.IsCoinBase() {
+			return nil
+		}
+		for _, input := range info.Tx.Inputs {
+			info.PrevOutputs = append(info.PrevOutputs, chain.findOutput(tx, input.TxId, input.Vout))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+/**
+ * 在主链和交易池中查找某笔交易的某个交易输出，找不到时返回nil
+ */
+func (chain *BlockChain) findOutput(tx storage.Tx, txId [32]byte, vout int) *transaction.TxOutput {
+	var prevTx transaction.Transaction
+	block, index, err := findTransaction(tx, txId)
+	if err == nil {
+		prevTx = block.Transactions[index]
+	} else if entry, ok := chain.Mempool.Entries[txId]; ok {
+		prevTx = entry.Tx
+	} else {
+		return nil
+	}
+	if vout < 0 || vout >= len(prevTx.Outputs) {
+		return nil
+	}
+	return &prevTx.Outputs[vout]
+}
@@ -0,0 +1,142 @@
+package chain
+
+import (
+	"XianfengChain04/config"
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"testing"
+)
+
+/**
+ * 查询交易索引中是否有txId，交易索引不存在时返回false
+ */
+func hasTxIndex(t *testing.T, chain *BlockChain, txId [32]byte) bool {
+	var found bool
+	err := chain.DB.View(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(TXINDEX))
+		found = bucket != nil && len(bucket.Get(txId[:])) != 0
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestGetTransaction(t *testing.T) {
+	for _, txIndex := range []bool{true, false} {
+		name := "关闭交易索引"
+		if txIndex {
+			name = "开启交易索引"
+		}
+		t.Run(name, func(t *testing.T) {
+			chain := newTestChain(t, func(cfg *config.Config) {
+				cfg.TxIndex = txIndex
+			})
+			from, priv := newTestAddress(t, chain)
+			to, _ := newTestAddress(t, chain)
+			err := chain.CreateCoinBase(from)
+			if err != nil {
+				t.Fatalf("创建创世区块失败：%v", err)
+			}
+			genesis := chain.GetLastBlock()
+			genesisTx := genesis.Transactions[0]
+			spend := newTestTx(t, genesisTx.TxHash, 0, to, priv, genesisTx.Outputs[0].Value)
+			main1 := newTestBlockOn(t, chain, genesis, from, chain.GetSubsidy(1), []transaction.Transaction{spend})
+			processTestBlock(t, chain, main1)
+			main2 := newTestBlockOn(t, chain, main1, from, chain.GetSubsidy(2), nil)
+			processTestBlock(t, chain, main2)
+
+			//已确认的交易：所在区块、位置、确认数以及引用的交易输出
+			info, err := chain.GetTransaction(spend.TxHash)
+			if err != nil {
+				t.Fatalf("查询已确认的交易失败：%v", err)
+			}
+			if info.BlockHash != main1.Hash || info.Height != 1 || info.Index != 1 || info.Confirmations != 2 {
+				t.Fatalf("已确认的交易信息不正确：%x %d %d %d", info.BlockHash, info.Height, info.Index, info.Confirmations)
+			}
+			if len(info.PrevOutputs) != 1 || info.PrevOutputs[0] == nil || info.PrevOutputs[0].Value != genesisTx.Outputs[0].Value {
+				t.Fatal("交易输入引用的交易输出不正确")
+			}
+			info, err = chain.GetTransaction(genesisTx.TxHash)
+			if err != nil || info.Height != 0 || len(info.PrevOutputs) != 0 {
+				t.Fatalf("查询创世区块的coinbase交易不正确：%v", err)
+			}
+			if hasTxIndex(t, chain, spend.TxHash) != txIndex {
+				t.Fatalf("交易索引中是否有该交易期望为%v", txIndex)
+			}
+
+			//切换分叉后被断开的交易从交易索引中删除，重新加入交易池
+			fork := []Block{genesis}
+			for height := int64(1); height <= 3; height++ {
+				block := newTestBlockOn(t, chain, fork[height-1], to, chain.GetSubsidy(height), nil)
+				processTestBlock(t, chain, block)
+				fork = append(fork, block)
+			}
+			if hasTxIndex(t, chain, spend.TxHash) || hasTxIndex(t, chain, main1.Transactions[0].TxHash) {
+				t.Fatal("被断开的区块中的交易应该从交易索引中删除")
+			}
+			info, err = chain.GetTransaction(spend.TxHash)
+			if err != nil {
+				t.Fatalf("查询交易池中的交易失败：%v", err)
+			}
+			if info.BlockHash != [32]byte{} || info.Confirmations != 0 {
+				t.Fatal("交易池中的交易不应该有所在区块和确认数")
+			}
+			_, err = chain.GetTransaction(main1.Transactions[0].TxHash)
+			if err != ErrTxNotFound {
+				t.Fatalf("被断开的coinbase交易期望返回%v，实际返回%v", ErrTxNotFound, err)
+			}
+			info, err = chain.GetTransaction(fork[3].Transactions[0].TxHash)
+			if err != nil || info.BlockHash != fork[3].Hash || info.Confirmations != 1 {
+				t.Fatalf("查询新连接的区块中的交易不正确：%v", err)
+			}
+		})
+	}
+}
+
+func TestInitTxIndex(t *testing.T) {
+	db := storage.NewMemoryDB()
+	cfg := config.DefaultConfig()
+	cfg.Consensus = "instant"
+	cfg.TxIndex = false
+	chain, err := CreateChain(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := newTestAddress(t, chain)
+	err = chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	coinbase := chain.GetLastBlock().Transactions[0]
+	if hasTxIndex(t, chain, coinbase.TxHash) {
+		t.Fatal("关闭交易索引时不应该建立交易索引")
+	}
+
+	//开启交易索引之后根据主链上的区块建立索引
+	cfg.TxIndex = true
+	chain, err = CreateChain(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasTxIndex(t, chain, coinbase.TxHash) {
+		t.Fatal("开启交易索引时应该根据已有的区块建立交易索引")
+	}
+
+	//再次关闭时删除交易索引，避免留下过时的记录
+	cfg.TxIndex = false
+	_, err = CreateChain(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx storage.Tx) error {
+		if tx.Bucket([]byte(TXINDEX)) != nil {
+			t.Error("关闭交易索引时应该删除交易索引")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
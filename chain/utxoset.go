@@ -0,0 +1,300 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/utils"
+	"encoding/binary"
+	"errors"
+)
+
+const UTXOSET = "utxoset"
+const UNDO = "undo"
+
+/**
+ * UTXO集合桶中的value：交易输出，以及产生该输出的区块高度和该输出是否来自coinbase交易
+ */
+type utxoEntry struct {
+	Value      transaction.Amount
+	ScriptPub  []byte
+	Height     int64
+	IsCoinBase bool
+}
+
+/**
+ * 取出UTXO记录中的交易输出
+ */
+func (entry utxoEntry) output() transaction.TxOutput {
+	return transaction.TxOutput{
+		Value:     entry.Value,
+		ScriptPub: entry.ScriptPub,
+	}
+}
+
+/**
+ * 判断UTXO在高度为height的区块中是否可以被花费：coinbase交易的输出需要经过maturity个区块才能被花费
+ * 创世区块中的coinbase交易是初始分配，不受该限制
+ */
+func (entry utxoEntry) isSpendable(height int64, maturity int64) bool {
+	if !entry.IsCoinBase || entry.Height == 0 {
+		return true
+	}
+	return height-entry.Height >= maturity
+}
+
+/**
+ * UTXO集合桶中的key：交易哈希 + 交易输出的序号
+ */
+func utxoKey(txId [32]byte, vout int) []byte {
+	voutBytes, _ := utils.Int2Byte(int64(vout))
+	return append(txId[:], voutBytes...)
+}
+
+/**
+ * 从UTXO集合桶的key中解析出交易哈希和交易输出的序号
+ */
+func parseUTXOKey(key []byte) ([32]byte, int) {
+	var txId [32]byte
+	copy(txId[:], key[:32])
+	vout := int(binary.BigEndian.Uint64(key[32:]))
+	return txId, vout
+}
+
+/**
+ * 在UTXO集合中查找某笔交易的某个交易输出，找不到说明该输出不存在或已被花费
+ */
+func getUTXO(tx storage.Tx, txId [32]byte, vout int) (*utxoEntry, error) {
+	bucket := tx.Bucket([]byte(UTXOSET))
+	if bucket == nil {
+		return nil, nil
+	}
+	entryBytes := bucket.Get(utxoKey(txId, vout))
+	if len(entryBytes) == 0 {
+		return nil, nil
+	}
+	var entry utxoEntry
+	_, err := utils.Decode(entryBytes, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+/**
+ * 区块的撤销数据：区块中每笔交易花费的交易输出，断开区块时用于恢复UTXO集合
+ */
+type spentOutput struct {
+	TxId  [32]byte
+	Vout  int
+	Entry utxoEntry
+}
+
+/**
+ * 根据区块中的交易更新UTXO集合：删除被交易输入花掉的输出，添加新产生的交易输出
+ * 同时把被花掉的输出保存为区块的撤销数据
+ * 该函数需要在保存区块的同一个db.Update中调用，保证区块和UTXO集合同时更新
+ */
+func updateUTXOSet(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(UTXOSET))
+	if err != nil {
+		return err
+	}
+	undo := make([][]spentOutput, 0)
+	for _, blockTx := range block.Transactions {
+		isCoinBase := blockTx.IsCoinBase()
+		spents := make([]spentOutput, 0)
+		//1、交易输入所引用的输出已经被花费，从集合中删除，coinbase交易的输入不引用任何输出
+		for _, input := range blockTx.Inputs {
+			if isCoinBase {
+				break
+			}
+			entry, err := getUTXO(tx, input.TxId, input.Vout)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				spents = append(spents, spentOutput{
+					TxId:  input.TxId,
+					Vout:  input.Vout,
+					Entry: *entry,
+				})
+			}
+			err = bucket.Delete(utxoKey(input.TxId, input.Vout))
+			if err != nil {
+				return err
+			}
+		}
+		undo = append(undo, spents)
+		//2、交易产生的新输出加入到集合中
+		for index, output := range blockTx.Outputs {
+			entry := utxoEntry{
+				Value:      output.Value,
+				ScriptPub:  output.ScriptPub,
+				Height:     block.Height,
+				IsCoinBase: isCoinBase,
+			}
+			entryBytes, err := utils.Encode(entry)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(utxoKey(blockTx.TxHash, index), entryBytes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	//3、保存区块的撤销数据
+	undoBucket, err := tx.CreateBucketIfNotExists([]byte(UNDO))
+	if err != nil {
+		return err
+	}
+	undoBytes, err := utils.Encode(undo)
+	if err != nil {
+		return err
+	}
+	return undoBucket.Put(block.Hash[:], undoBytes)
+}
+
+/**
+ * 读取区块的撤销数据：区块中每笔交易花掉的交易输出
+ */
+func getUndo(tx storage.Tx, block Block) ([][]spentOutput, error) {
+	undoBucket := tx.Bucket([]byte(UNDO))
+	if undoBucket == nil {
+		return nil, errors.New("找不到区块的撤销数据，请使用reindex-utxo命令重建")
+	}
+	undoBytes := undoBucket.Get(block.Hash[:])
+	if len(undoBytes) == 0 {
+		return nil, errors.New("找不到区块的撤销数据，请使用reindex-utxo命令重建")
+	}
+	undo := make([][]spentOutput, 0)
+	_, err := utils.Decode(undoBytes, &undo)
+	if err != nil {
+		return nil, err
+	}
+	if len(undo) != len(block.Transactions) {
+		return nil, errors.New("区块的撤销数据与区块中的交易不一致")
+	}
+	return undo, nil
+}
+
+/**
+ * 从UTXO集合中撤销区块：按照相反的顺序处理区块中的交易，删除交易产生的输出，
+ * 根据撤销数据恢复交易花掉的输出，区块必须是当前UTXO集合对应的最新区块
+ */
+func disconnectUTXOSet(tx storage.Tx, block Block) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(UTXOSET))
+	if err != nil {
+		return err
+	}
+	undo, err := getUndo(tx, block)
+	if err != nil {
+		return err
+	}
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		blockTx := block.Transactions[i]
+		//1、删除交易产生的输出
+		for index := range blockTx.Outputs {
+			err = bucket.Delete(utxoKey(blockTx.TxHash, index))
+			if err != nil {
+				return err
+			}
+		}
+		//2、恢复交易花掉的输出
+		for _, spent := range undo[i] {
+			entryBytes, err := utils.Encode(spent.Entry)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(utxoKey(spent.TxId, spent.Vout), entryBytes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Bucket([]byte(UNDO)).Delete(block.Hash[:])
+}
+
+/**
+ * 重建UTXO集合和区块的撤销数据：清空UTXO集合桶，从创世区块开始依次应用每个区块的交易
+ */
+func (chain *BlockChain) ReindexUTXO() error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	blocks, err := chain.getAllBlocks()
+	if err != nil {
+		return err
+	}
+	return chain.DB.Update(func(tx storage.Tx) error {
+		return reindexUTXO(tx, blocks)
+	})
+}
+
+/**
+ * 使用blocks(从最新区块到创世区块的顺序)重建UTXO集合桶和撤销数据桶
+ */
+func reindexUTXO(tx storage.Tx, blocks []Block) error {
+	for _, name := range []string{UTXOSET, UNDO} {
+		if tx.Bucket([]byte(name)) != nil {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err := tx.CreateBucket([]byte(UTXOSET))
+	if err != nil {
+		return err
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err = updateUTXOSet(tx, blocks[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 该方法用于从UTXO集合桶中查询出锁定在指定公钥哈希上的UTXOs集合并返回
+ * 尚未成熟的coinbase交易输出不能被花费，不包含在结果中
+ */
+func (chain *BlockChain) SearchUTXOsFromDB(pubHash []byte) ([]transaction.UTXO, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.searchUTXOsFromDB(pubHash)
+}
+
+func (chain *BlockChain) searchUTXOsFromDB(pubHash []byte) ([]transaction.UTXO, error) {
+	utxos := make([]transaction.UTXO, 0)
+	err := chain.DB.View(func(tx storage.Tx) error {
+		bucket := tx.Bucket([]byte(UTXOSET))
+		if bucket == nil {
+			return errors.New("UTXO集合不存在，请使用reindex-utxo命令重建")
+		}
+		//下一个区块的高度，即这些UTXO被花费时所在区块的高度
+		nextHeight := chain.LastBlock.Height + 1
+		return bucket.ForEach(func(k, v []byte) error {
+			var entry utxoEntry
+			_, err := utils.Decode(v, &entry)
+			if err != nil {
+				return err
+			}
+			output := entry.output()
+			if !output.IsLockedWithKey(pubHash) {
+				return nil
+			}
+			if !entry.isSpendable(nextHeight, chain.Config.CoinbaseMaturity) {
+				return nil
+			}
+			txId, vout := parseUTXOKey(k)
+			utxos = append(utxos, transaction.UTXO{
+				TxId:     txId,
+				Vout:     vout,
+				TxOutput: output,
+			})
+			return nil
+		})
+	})
+	return utxos, err
+}
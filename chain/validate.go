@@ -0,0 +1,285 @@
+package chain
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"errors"
+	"sort"
+	"time"
+)
+
+const MEDIANTIMEBLOCKS = 11        //区块的时间戳必须晚于之前多少个区块时间戳的中位数
+const MAXFUTUREDRIFT = 2 * 60 * 60 //区块的时间戳最多可以超前于当前时间多少秒
+
+/**
+ * 区块验证的各项规则不通过时返回的错误，调用者可以据此判断区块被拒绝的具体原因
+ */
+var (
+	ErrInvalidBits         = errors.New("区块声明的难度目标与难度调整规则计算的结果不一致")
+	ErrInvalidMerkleRoot   = errors.New("区块的默克尔根与区块中的交易不一致")
+	ErrPrevHashMismatch    = errors.New("区块的PrevHash与最新区块的hash不一致")
+	ErrOrphanBlock         = errors.New("找不到区块的前一个区块")
+	ErrBlockExists         = errors.New("区块已经存在")
+	ErrInvalidHeight       = errors.New("区块的高度不是最新区块的高度加1")
+	ErrInvalidCoinbase     = errors.New("区块的第一笔交易必须是coinbase交易，并且只能有一笔coinbase交易")
+	ErrInvalidTxHash       = errors.New("交易的哈希与交易内容不一致")
+	ErrMissingInput        = errors.New("交易输入引用的交易输出不存在或已被花费")
+	ErrDoubleSpend         = errors.New("同一个交易输出在区块中被重复花费")
+	ErrInvalidOutputValue  = errors.New("交易输出的金额必须大于0并且不能超过金额上限")
+	ErrOutputsExceedInputs = errors.New("交易输出的总额超过了交易输入的总额")
+	ErrInvalidSignature    = errors.New("交易签名验证失败")
+	ErrCoinbaseTooLarge    = errors.New("coinbase交易领取的金额超过了区块奖励与手续费之和")
+	ErrCoinbaseHeight      = errors.New("coinbase交易中记录的高度与区块高度不一致")
+	ErrImmatureCoinbase    = errors.New("coinbase交易的输出尚未成熟，不能被花费")
+	ErrTimeTooOld          = errors.New("区块的时间戳必须晚于之前区块时间戳的中位数")
+	ErrTimeTooNew          = errors.New("区块的时间戳超前于当前时间太多")
+)
+
+/**
+ * 验证区块是否可以追加到当前最新区块之后，本地生成的区块和从外部接收到的区块都需要经过验证
+ */
+func (chain *BlockChain) ValidateBlock(block Block) error {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+	return chain.DB.View(func(tx storage.Tx) error {
+		return chain.validateBlock(tx, block, chain.LastBlock)
+	})
+}
+
+/**
+ * 在数据库事务tx中，以tip为最新区块验证block：PrevHash、高度、区块头以及区块中的所有交易
+ * tip为空区块时，block只能是创世区块
+ */
+func (chain *BlockChain) validateBlock(tx storage.Tx, block Block, tip Block) error {
+	//还没有区块时，只能追加创世区块
+	if tip.Hash == [32]byte{} {
+		if block.PrevHash != [32]byte{} {
+			return ErrPrevHashMismatch
+		}
+		if block.Height != 0 {
+			return ErrInvalidHeight
+		}
+	} else {
+		if block.PrevHash != tip.Hash {
+			return ErrPrevHashMismatch
+		}
+		if block.Height != tip.Height+1 {
+			return ErrInvalidHeight
+		}
+	}
+	err := chain.validateHeader(tx, block, tip)
+	if err != nil {
+		return err
+	}
+	return chain.validateBody(tx, block)
+}
+
+/**
+ * 在数据库事务tx中验证区块中不依赖UTXO集合的部分：
+ * 时间戳、难度目标、共识封装数据、默克尔根以及coinbase交易的位置和高度
+ * parent为区块的前一个区块，创世区块的parent为空区块
+ */
+func (chain *BlockChain) validateHeader(tx storage.Tx, block Block, parent Block) error {
+	//0、时间戳必须晚于之前区块时间戳的中位数，并且不能超前于当前时间太多
+	if parent.Hash != [32]byte{} {
+		medianTime, err := chain.medianTimePast(tx, parent)
+		if err != nil {
+			return err
+		}
+		if block.TimeStamp <= medianTime {
+			return ErrTimeTooOld
+		}
+	}
+	if block.TimeStamp > time.Now().Unix()+MAXFUTUREDRIFT {
+		return ErrTimeTooNew
+	}
+
+	//1、难度目标必须与共识引擎计算的结果一致，并且满足共识引擎的封装规则(如工作量证明)
+	bits, err := chain.calcTarget(tx, parent)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return ErrInvalidBits
+	}
+	err = chain.verifySeal(tx, block)
+	if err != nil {
+		return err
+	}
+
+	//2、默克尔根必须与区块中的交易一致，交易通过默克尔根参与区块hash的计算
+	if CalculateMerkleRoot(block.Transactions) != block.MerkleRoot {
+		return ErrInvalidMerkleRoot
+	}
+
+	//3、区块的第一笔交易必须是coinbase交易，并且只能有一笔
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinBase() {
+		return ErrInvalidCoinbase
+	}
+	for index, blockTx := range block.Transactions {
+		if blockTx.IsCoinBase() && index != 0 {
+			return ErrInvalidCoinbase
+		}
+	}
+	if block.Transactions[0].CoinBaseHeight() != block.Height {
+		return ErrCoinbaseHeight
+	}
+	return nil
+}
+
+/**
+ * 在数据库事务tx中计算parent及其之前共MEDIANTIMEBLOCKS个区块时间戳的中位数，
+ * 追加在parent之后的区块的时间戳必须晚于该值，区块数量不足时使用已有的全部区块
+ */
+func (chain *BlockChain) medianTimePast(tx storage.Tx, parent Block) (int64, error) {
+	bucket := tx.Bucket([]byte(BLOCKS))
+	if bucket == nil {
+		return 0, errors.New("区块数据库操作失败,请重试！")
+	}
+	timeStamps := []int64{parent.TimeStamp}
+	current := parent
+	for len(timeStamps) < MEDIANTIMEBLOCKS && current.Height > 0 {
+		blockBytes := bucket.Get(current.PrevHash[:])
+		if len(blockBytes) == 0 {
+			return 0, ErrOrphanBlock
+		}
+		prev, err := Deserialize(blockBytes)
+		if err != nil {
+			return 0, err
+		}
+		timeStamps = append(timeStamps, prev.TimeStamp)
+		current = prev
+	}
+	sort.Slice(timeStamps, func(i, j int) bool {
+		return timeStamps[i] < timeStamps[j]
+	})
+	return timeStamps[len(timeStamps)/2], nil
+}
+
+/**
+ * 在数据库事务tx中根据UTXO集合验证区块中的交易，UTXO集合必须是区块的前一个区块之后的状态
+ */
+func (chain *BlockChain) validateBody(tx storage.Tx, block Block) error {
+	//1、区块中的交易
+	fees, err := chain.validateTransactions(tx, block.Transactions, block.Height)
+	if err != nil {
+		return err
+	}
+
+	//2、coinbase交易领取的金额不能超过区块奖励与手续费之和
+	var claimed transaction.Amount
+	for _, output := range block.Transactions[0].Outputs {
+		claimed += output.Value
+	}
+	if claimed > chain.GetSubsidy(block.Height)+fees {
+		return ErrCoinbaseTooLarge
+	}
+	return nil
+}
+
+/**
+ * 在数据库事务tx中验证一批交易，交易可以花费同一批交易中排在其之前的交易的输出
+ * height为这批交易所在区块的高度，用于判断所花费的coinbase交易输出是否已经成熟
+ * 验证通过时返回这批交易的手续费总额
+ */
+func (chain *BlockChain) validateTransactions(tx storage.Tx, txs []transaction.Transaction, height int64) (transaction.Amount, error) {
+	var fees transaction.Amount
+	//同一批交易中新产生的交易输出: utxoKey -> 交易输出
+	memOutputs := make(map[string]transaction.TxOutput)
+	//同一批交易中已经被花费的交易输出
+	memSpends := make(map[string]bool)
+	for _, newTx := range txs {
+		fee, err := chain.validateTransaction(tx, newTx, height, memOutputs, memSpends)
+		if err != nil {
+			return 0, err
+		}
+		fees += fee
+	}
+	return fees, nil
+}
+
+/**
+ * 在数据库事务tx中验证一笔交易：交易哈希、输出金额、输入引用的输出是否未花费、
+ * 是否重复花费、输出总额是否超过输入总额以及签名
+ * memOutputs和memSpends为还未保存到UTXO集合中的交易所产生和花费的交易输出，
+ * 验证通过后该交易产生和花费的输出也会记录到其中，返回该交易的手续费
+ */
+func (chain *BlockChain) validateTransaction(tx storage.Tx, newTx transaction.Transaction, height int64,
+	memOutputs map[string]transaction.TxOutput, memSpends map[string]bool) (transaction.Amount, error) {
+	//a、交易哈希
+	hashTx := newTx
+	err := hashTx.SetTxHash()
+	if err != nil {
+		return 0, err
+	}
+	if hashTx.TxHash != newTx.TxHash {
+		return 0, ErrInvalidTxHash
+	}
+
+	//b、交易输出的金额，区块奖励减半到0之后没有手续费的coinbase交易的输出金额为0
+	var outputAmount transaction.Amount
+	for _, output := range newTx.Outputs {
+		if output.Value < 0 || output.Value > transaction.MAXAMOUNT {
+			return 0, ErrInvalidOutputValue
+		}
+		if output.Value == 0 && !newTx.IsCoinBase() {
+			return 0, ErrInvalidOutputValue
+		}
+		outputAmount += output.Value
+		if outputAmount > transaction.MAXAMOUNT {
+			return 0, ErrInvalidOutputValue
+		}
+	}
+
+	var fee transaction.Amount
+	if !newTx.IsCoinBase() {
+		//c、交易输入引用的交易输出
+		prevOutputs := make([]transaction.TxOutput, 0)
+		spends := make(map[string]bool)
+		var inputAmount transaction.Amount
+		for _, input := range newTx.Inputs {
+			key := string(utxoKey(input.TxId, input.Vout))
+			if memSpends[key] || spends[key] {
+				return 0, ErrDoubleSpend
+			}
+			spends[key] = true
+
+			output, ok := memOutputs[key]
+			if !ok {
+				entry, err := getUTXO(tx, input.TxId, input.Vout)
+				if err != nil {
+					return 0, err
+				}
+				if entry == nil {
+					return 0, ErrMissingInput
+				}
+				if !entry.isSpendable(height, chain.Config.CoinbaseMaturity) {
+					return 0, ErrImmatureCoinbase
+				}
+				output = entry.output()
+			}
+			prevOutputs = append(prevOutputs, output)
+			inputAmount += output.Value
+		}
+
+		//d、输出总额不能超过输入总额，差额即为手续费
+		if outputAmount > inputAmount {
+			return 0, ErrOutputsExceedInputs
+		}
+		fee = inputAmount - outputAmount
+
+		//e、签名
+		if !newTx.Verify(prevOutputs) {
+			return 0, ErrInvalidSignature
+		}
+
+		for key := range spends {
+			memSpends[key] = true
+		}
+	}
+
+	for index, output := range newTx.Outputs {
+		memOutputs[string(utxoKey(newTx.TxHash, index))] = output
+	}
+	return fee, nil
+}
@@ -0,0 +1,227 @@
+package chain
+
+import (
+	"XianfengChain04/config"
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+/**
+ * 使用内存数据库和即时共识引擎创建测试用的区块链，modify可以修改默认配置
+ */
+func newTestChain(t *testing.T, modify func(cfg *config.Config)) *BlockChain {
+	cfg := config.DefaultConfig()
+	cfg.Consensus = "instant"
+	if modify != nil {
+		modify(cfg)
+	}
+	chain, err := CreateChain(storage.NewMemoryDB(), cfg)
+	if err != nil {
+		t.Fatalf("创建区块链失败：%v", err)
+	}
+	return chain
+}
+
+/**
+ * 在测试链的钱包中生成新地址，同时返回地址的私钥
+ */
+func newTestAddress(t *testing.T, chain *BlockChain) (string, *ecdsa.PrivateKey) {
+	addr, err := chain.GetNewAddress()
+	if err != nil {
+		t.Fatalf("生成地址失败：%v", err)
+	}
+	priv, err := chain.Wallet.GetPrivKey(addr)
+	if err != nil {
+		t.Fatalf("获取私钥失败：%v", err)
+	}
+	return addr, priv
+}
+
+/**
+ * 构建追加在最新区块之后的区块：coinbase交易领取reward，之后是txs，使用即时共识引擎封装
+ */
+func newTestBlock(t *testing.T, chain *BlockChain, miner string, reward transaction.Amount, txs []transaction.Transaction) Block {
+	return newTestBlockOn(t, chain, chain.GetLastBlock(), miner, reward, txs)
+}
+
+/**
+ * 构建追加在tip之后的区块，tip可以是分叉上的区块
+ */
+func newTestBlockOn(t *testing.T, chain *BlockChain, tip Block, miner string, reward transaction.Amount, txs []transaction.Transaction) Block {
+	coinbase, err := transaction.CreateCoinBase(miner, reward, tip.Height+1)
+	if err != nil {
+		t.Fatalf("创建coinbase交易失败：%v", err)
+	}
+	block := NewBlock(tip.Height, tip.Hash, 0, append([]transaction.Transaction{*coinbase}, txs...))
+	//同一秒内生成的区块时间戳相同，调整到之前区块时间戳的中位数之后
+	var medianTime int64
+	err = chain.DB.View(func(tx storage.Tx) error {
+		var err error
+		medianTime, err = chain.medianTimePast(tx, tip)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("计算时间戳中位数失败：%v", err)
+	}
+	if block.TimeStamp <= medianTime {
+		block.TimeStamp = medianTime + 1
+	}
+	sealTestBlock(t, chain, &block)
+	return block
+}
+
+/**
+ * 修改区块头之后重新计算区块hash
+ */
+func sealTestBlock(t *testing.T, chain *BlockChain, block *Block) {
+	err := block.Seal(context.Background(), chain.Engine, dbReader{chain.DB})
+	if err != nil {
+		t.Fatalf("封装区块失败：%v", err)
+	}
+}
+
+/**
+ * 构建一笔花费txId:vout的交易，outputs为输出的金额，都锁定在to上，使用priv签名
+ */
+func newTestTx(t *testing.T, txId [32]byte, vout int, to string, priv *ecdsa.PrivateKey, outputs ...transaction.Amount) transaction.Transaction {
+	tx := transaction.Transaction{
+		Inputs: []transaction.TxInput{{TxId: txId, Vout: vout}},
+	}
+	for _, value := range outputs {
+		output, err := transaction.NewTxOutput(value, to)
+		if err != nil {
+			t.Fatalf("创建交易输出失败：%v", err)
+		}
+		tx.Outputs = append(tx.Outputs, *output)
+	}
+	err := tx.Sign([]*ecdsa.PrivateKey{priv})
+	if err != nil {
+		t.Fatalf("交易签名失败：%v", err)
+	}
+	return tx
+}
+
+func TestValidateBlock(t *testing.T) {
+	chain := newTestChain(t, nil)
+	addr, priv := newTestAddress(t, chain)
+	_, otherPriv := newTestAddress(t, chain)
+	err := chain.CreateCoinBase(addr)
+	if err != nil {
+		t.Fatalf("创建创世区块失败：%v", err)
+	}
+	genesis := chain.GetLastBlock()
+	//创世区块的coinbase输出不受成熟度限制，可以直接花费
+	genesisTx := genesis.Transactions[0].TxHash
+	genesisValue := genesis.Transactions[0].Outputs[0].Value
+	//高度为1的区块的coinbase输出还没有成熟
+	block1, err := chain.MineBlock(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("挖矿失败：%v", err)
+	}
+	immatureTx := block1.Transactions[0].TxHash
+	subsidy := chain.GetSubsidy(2)
+
+	tests := []struct {
+		name  string
+		block func() Block
+		err   error
+	}{
+		{"有效区块", func() Block {
+			tx := newTestTx(t, genesisTx, 0, addr, priv, genesisValue-1)
+			return newTestBlock(t, chain, addr, subsidy+1, []transaction.Transaction{tx})
+		}, nil},
+		{"PrevHash不是最新区块", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.PrevHash = genesis.Hash
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrPrevHashMismatch},
+		{"高度不连续", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.Height++
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrInvalidHeight},
+		{"时间戳早于之前区块时间戳的中位数", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.TimeStamp = genesis.TimeStamp
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrTimeTooOld},
+		{"时间戳超前于当前时间太多", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.TimeStamp = time.Now().Unix() + MAXFUTUREDRIFT + 60
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrTimeTooNew},
+		{"难度目标不一致", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.Bits = 1
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrInvalidBits},
+		{"默克尔根与交易不一致", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			block.MerkleRoot = [32]byte{1}
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrInvalidMerkleRoot},
+		{"第一笔交易不是coinbase", func() Block {
+			block := newTestBlock(t, chain, addr, subsidy, nil)
+			tx := newTestTx(t, genesisTx, 0, addr, priv, genesisValue)
+			block.Transactions = []transaction.Transaction{tx}
+			block.MerkleRoot = CalculateMerkleRoot(block.Transactions)
+			sealTestBlock(t, chain, &block)
+			return block
+		}, ErrInvalidCoinbase},
+		{"coinbase领取的金额过多", func() Block {
+			return newTestBlock(t, chain, addr, subsidy+1, nil)
+		}, ErrCoinbaseTooLarge},
+		{"花费未成熟的coinbase输出", func() Block {
+			tx := newTestTx(t, immatureTx, 0, addr, priv, 1)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrImmatureCoinbase},
+		{"引用不存在的交易输出", func() Block {
+			tx := newTestTx(t, [32]byte{1}, 0, addr, priv, 1)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrMissingInput},
+		{"区块中重复花费", func() Block {
+			tx1 := newTestTx(t, genesisTx, 0, addr, priv, genesisValue)
+			tx2 := newTestTx(t, genesisTx, 0, addr, priv, genesisValue-1)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx1, tx2})
+		}, ErrDoubleSpend},
+		{"输出总额超过输入总额", func() Block {
+			tx := newTestTx(t, genesisTx, 0, addr, priv, genesisValue+1)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrOutputsExceedInputs},
+		{"使用其他私钥签名", func() Block {
+			tx := newTestTx(t, genesisTx, 0, addr, otherPriv, genesisValue)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrInvalidSignature},
+		{"交易哈希与内容不一致", func() Block {
+			tx := newTestTx(t, genesisTx, 0, addr, priv, genesisValue)
+			tx.TxHash[0] ^= 0xff
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrInvalidTxHash},
+		{"输出金额为0", func() Block {
+			tx := newTestTx(t, genesisTx, 0, addr, priv, genesisValue, 0)
+			return newTestBlock(t, chain, addr, subsidy, []transaction.Transaction{tx})
+		}, ErrInvalidOutputValue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := chain.ValidateBlock(test.block())
+			if test.err == nil && err != nil {
+				t.Fatalf("区块应该通过验证，实际返回：%v", err)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("期望返回%v，实际返回%v", test.err, err)
+			}
+		})
+	}
+}
@@ -4,8 +4,33 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
+	"math/big"
 )
 
+/**
+ * 支持的椭圆曲线的名称，保存在钱包中用于记录秘钥所使用的曲线
+ */
+const (
+	P256      = "P-256"
+	SECP256K1 = "secp256k1"
+)
+
+var ErrInvalidPubKey = errors.New("公钥的格式不正确")
+
+/**
+ * 根据名称获取椭圆曲线
+ */
+func CurveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case P256:
+		return elliptic.P256(), nil
+	case SECP256K1:
+		return S256(), nil
+	}
+	return nil, errors.New("不支持的椭圆曲线：" + name)
+}
+
 /**
  * 使用密码学随机生成私钥：椭圆曲线数字签名算法ECDSA
  * ECDSA：elliptic curve digital signature algorithm
@@ -18,8 +43,104 @@ func NewPriKey(curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
 /**
  * 根据私钥获得公钥
  */
-func GetPub(curve elliptic.Curve, pri *ecdsa.PrivateKey) []byte {
-	return elliptic.Marshal(curve, pri.X, pri.Y)
+func GetPub(pri *ecdsa.PrivateKey) []byte {
+	return MarshalPub(&pri.PublicKey)
+}
+
+/**
+ * 公钥的编码：secp256k1的公钥使用33字节的压缩格式(0x02或0x03 || x)，
+ * P-256的公钥沿用65字节的非压缩格式(0x04 || x || y)，与已有区块中的公钥保持一致
+ */
+func MarshalPub(pub *ecdsa.PublicKey) []byte {
+	if pub.Curve.Params().Name == SECP256K1 {
+		compressed := make([]byte, 33)
+		compressed[0] = 0x02 | byte(pub.Y.Bit(0))
+		pub.X.FillBytes(compressed[1:])
+		return compressed
+	}
+	return elliptic.Marshal(pub.Curve, pub.X, pub.Y)
 }
 
+/**
+ * 解析公钥，并根据编码判断公钥所在的曲线：
+ * 压缩格式的公钥为secp256k1的公钥，非压缩格式的公钥依次检查是否在P-256和secp256k1上
+ */
+func ParsePub(pub []byte) (*ecdsa.PublicKey, error) {
+	switch {
+	case len(pub) == 33 && (pub[0] == 0x02 || pub[0] == 0x03):
+		curve := S256().(secp256k1Curve)
+		x := new(big.Int).SetBytes(pub[1:])
+		y := curve.decompressY(x, pub[0] == 0x03)
+		if y == nil {
+			return nil, ErrInvalidPubKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case len(pub) == 65 && pub[0] == 0x04:
+		x := new(big.Int).SetBytes(pub[1:33])
+		y := new(big.Int).SetBytes(pub[33:])
+		for _, curve := range []elliptic.Curve{elliptic.P256(), S256()} {
+			if curve.IsOnCurve(x, y) {
+				return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+			}
+		}
+	}
+	return nil, ErrInvalidPubKey
+}
 
+/**
+ * 使用私钥对数据的hash进行签名，签名结果为定长的r和s拼接而成
+ */
+func Sign(pri *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, pri, hash)
+	if err != nil {
+		return nil, err
+	}
+	keyLen := (pri.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*keyLen)
+	r.FillBytes(signature[:keyLen])
+	s.FillBytes(signature[keyLen:])
+	return signature, nil
+}
+
+/**
+ * 使用公钥验证签名是否有效，签名有效返回true，否则返回false
+ * 公钥所在的曲线由公钥的编码决定，见ParsePub
+ */
+func Verify(pub []byte, hash []byte, signature []byte) bool {
+	pubKey, err := ParsePub(pub)
+	if err != nil {
+		return false
+	}
+	keyLen := (pubKey.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*keyLen {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:keyLen])
+	s := new(big.Int).SetBytes(signature[keyLen:])
+	return ecdsa.Verify(pubKey, hash, r, s)
+}
+
+/**
+ * 根据私钥的字节(私钥D的大端序表示)恢复私钥，并计算出对应的公钥
+ */
+func PrivKeyFromBytes(curve elliptic.Curve, d []byte) (*ecdsa.PrivateKey, error) {
+	k := new(big.Int).SetBytes(d)
+	if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("私钥不在有效范围内")
+	}
+	pri := new(ecdsa.PrivateKey)
+	pri.Curve = curve
+	pri.D = k
+	pri.X, pri.Y = curve.ScalarBaseMult(k.Bytes())
+	return pri, nil
+}
+
+/**
+ * 私钥D的定长字节表示，长度与曲线的阶相同
+ */
+func PrivKeyBytes(pri *ecdsa.PrivateKey) []byte {
+	keyLen := (pri.Curve.Params().N.BitLen() + 7) / 8
+	d := make([]byte, keyLen)
+	pri.D.FillBytes(d)
+	return d
+}
@@ -0,0 +1,257 @@
+package chaincrypto
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+/**
+ * secp256k1椭圆曲线：y² = x³ + 7 (mod p)，比特币使用的曲线
+ * 标准库的elliptic.CurveParams只支持a=-3的曲线，这里使用雅可比坐标实现a=0的曲线运算
+ * 该实现使用big.Int计算，不是常数时间的实现
+ */
+type secp256k1Curve struct {
+	params *elliptic.CurveParams
+}
+
+var secp256k1 secp256k1Curve
+var initSecp256k1 sync.Once
+
+/**
+ * 返回secp256k1曲线
+ */
+func S256() elliptic.Curve {
+	initSecp256k1.Do(func() {
+		params := &elliptic.CurveParams{Name: SECP256K1}
+		params.P, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+		params.N, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+		params.B = big.NewInt(7)
+		params.Gx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+		params.Gy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+		params.BitSize = 256
+		secp256k1.params = params
+	})
+	return secp256k1
+}
+
+func (curve secp256k1Curve) Params() *elliptic.CurveParams {
+	return curve.params
+}
+
+/**
+ * 判断点(x, y)是否在曲线上
+ */
+func (curve secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
+	p := curve.params.P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 {
+		return false
+	}
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, p)
+	return curve.rhs(x).Cmp(y2) == 0
+}
+
+/**
+ * 计算x³ + 7 (mod p)
+ */
+func (curve secp256k1Curve) rhs(x *big.Int) *big.Int {
+	x3 := new(big.Int).Mul(x, x)
+	x3.Mul(x3, x)
+	x3.Add(x3, curve.params.B)
+	return x3.Mod(x3, curve.params.P)
+}
+
+func (curve secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	z1 := zForAffine(x1, y1)
+	z2 := zForAffine(x2, y2)
+	return curve.affineFromJacobian(curve.addJacobian(x1, y1, z1, x2, y2, z2))
+}
+
+func (curve secp256k1Curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	z1 := zForAffine(x1, y1)
+	return curve.affineFromJacobian(curve.doubleJacobian(x1, y1, z1))
+}
+
+/**
+ * 计算k*(x, y)，k为大端序的标量
+ */
+func (curve secp256k1Curve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	z1 := zForAffine(x1, y1)
+	x, y, z := new(big.Int), new(big.Int), new(big.Int)
+	for _, b := range k {
+		for bit := 0; bit < 8; bit++ {
+			x, y, z = curve.doubleJacobian(x, y, z)
+			if b&0x80 == 0x80 {
+				x, y, z = curve.addJacobian(x1, y1, z1, x, y, z)
+			}
+			b <<= 1
+		}
+	}
+	return curve.affineFromJacobian(x, y, z)
+}
+
+func (curve secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return curve.ScalarMult(curve.params.Gx, curve.params.Gy, k)
+}
+
+/**
+ * 仿射坐标对应的雅可比坐标的z，无穷远点(0, 0)的z为0
+ */
+func zForAffine(x, y *big.Int) *big.Int {
+	z := new(big.Int)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		z.SetInt64(1)
+	}
+	return z
+}
+
+/**
+ * 雅可比坐标(x, y, z)转换为仿射坐标(x/z², y/z³)
+ */
+func (curve secp256k1Curve) affineFromJacobian(x, y, z *big.Int) (*big.Int, *big.Int) {
+	if z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	p := curve.params.P
+	zinv := new(big.Int).ModInverse(z, p)
+	zinvsq := new(big.Int).Mul(zinv, zinv)
+
+	xOut := new(big.Int).Mul(x, zinvsq)
+	xOut.Mod(xOut, p)
+	zinvsq.Mul(zinvsq, zinv)
+	yOut := new(big.Int).Mul(y, zinvsq)
+	yOut.Mod(yOut, p)
+	return xOut, yOut
+}
+
+/**
+ * 雅可比坐标的点加法，公式来源：
+ * https://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#addition-add-2007-bl
+ */
+func (curve secp256k1Curve) addJacobian(x1, y1, z1, x2, y2, z2 *big.Int) (*big.Int, *big.Int, *big.Int) {
+	if z1.Sign() == 0 {
+		return new(big.Int).Set(x2), new(big.Int).Set(y2), new(big.Int).Set(z2)
+	}
+	if z2.Sign() == 0 {
+		return new(big.Int).Set(x1), new(big.Int).Set(y1), new(big.Int).Set(z1)
+	}
+	p := curve.params.P
+	z1z1 := new(big.Int).Mul(z1, z1)
+	z1z1.Mod(z1z1, p)
+	z2z2 := new(big.Int).Mul(z2, z2)
+	z2z2.Mod(z2z2, p)
+
+	u1 := new(big.Int).Mul(x1, z2z2)
+	u1.Mod(u1, p)
+	u2 := new(big.Int).Mul(x2, z1z1)
+	u2.Mod(u2, p)
+	s1 := new(big.Int).Mul(y1, z2)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, p)
+	s2 := new(big.Int).Mul(y2, z1)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, p)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, p)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, p)
+	if h.Sign() == 0 {
+		//两个点的x相同：y也相同时是同一个点，使用倍点公式；否则互为相反数，结果为无穷远点
+		if r.Sign() == 0 {
+			return curve.doubleJacobian(x1, y1, z1)
+		}
+		return new(big.Int), new(big.Int), new(big.Int)
+	}
+	r.Lsh(r, 1)
+
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	j := new(big.Int).Mul(h, i)
+	v := new(big.Int).Mul(u1, i)
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, v)
+	x3.Sub(x3, v)
+	x3.Mod(x3, p)
+
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1.Mul(s1, j)
+	s1.Lsh(s1, 1)
+	y3.Sub(y3, s1)
+	y3.Mod(y3, p)
+
+	z3 := new(big.Int).Add(z1, z2)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, p)
+	return x3, y3, z3
+}
+
+/**
+ * 雅可比坐标的倍点运算(a=0)，公式来源：
+ * https://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#doubling-dbl-2009-l
+ */
+func (curve secp256k1Curve) doubleJacobian(x, y, z *big.Int) (*big.Int, *big.Int, *big.Int) {
+	if z.Sign() == 0 || y.Sign() == 0 {
+		return new(big.Int), new(big.Int), new(big.Int)
+	}
+	p := curve.params.P
+	a := new(big.Int).Mul(x, x)
+	a.Mod(a, p)
+	b := new(big.Int).Mul(y, y)
+	b.Mod(b, p)
+	c := new(big.Int).Mul(b, b)
+	c.Mod(c, p)
+
+	d := new(big.Int).Add(x, b)
+	d.Mul(d, d)
+	d.Sub(d, a)
+	d.Sub(d, c)
+	d.Lsh(d, 1)
+	d.Mod(d, p)
+
+	e := new(big.Int).Lsh(a, 1)
+	e.Add(e, a)
+	f := new(big.Int).Mul(e, e)
+
+	x3 := new(big.Int).Lsh(d, 1)
+	x3.Sub(f, x3)
+	x3.Mod(x3, p)
+
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e)
+	c.Lsh(c, 3)
+	y3.Sub(y3, c)
+	y3.Mod(y3, p)
+
+	z3 := new(big.Int).Mul(y, z)
+	z3.Lsh(z3, 1)
+	z3.Mod(z3, p)
+	return x3, y3, z3
+}
+
+/**
+ * 由x和y的奇偶性求出曲线上点的y：y = (x³ + 7)^((p+1)/4) (mod p)，p ≡ 3 (mod 4)
+ */
+func (curve secp256k1Curve) decompressY(x *big.Int, odd bool) *big.Int {
+	p := curve.params.P
+	if x.Cmp(p) >= 0 {
+		return nil
+	}
+	exp := new(big.Int).Add(p, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(curve.rhs(x), exp, p)
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(p, y)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil
+	}
+	return y
+}
@@ -0,0 +1,193 @@
+package chaincrypto
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("无效的十六进制数：%s", s)
+	}
+	return n
+}
+
+func TestScalarBaseMult(t *testing.T) {
+	curve := S256()
+	n := curve.Params().N
+	tests := []struct {
+		name string
+		k    *big.Int
+		x    string
+		y    string
+	}{
+		{"1·G", big.NewInt(1),
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"},
+		{"2·G", big.NewInt(2),
+			"c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+			"1ae168fea63dc339a3c58419466ceaeef7f632653266d0e1236431a950cfe52a"},
+		//(n-1)·G = -G，x坐标与G相同，y坐标为p-Gy
+		{"(n-1)·G", new(big.Int).Sub(n, big.NewInt(1)),
+			"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			"b7c52588d95c3b9aa25b0403f1eef75702e84bb7597aabe663b82f6f04ef2777"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			x, y := curve.ScalarBaseMult(test.k.Bytes())
+			if x.Cmp(hexInt(t, test.x)) != 0 || y.Cmp(hexInt(t, test.y)) != 0 {
+				t.Fatalf("期望(%s, %s)，实际为(%x, %x)", test.x, test.y, x, y)
+			}
+			if !curve.IsOnCurve(x, y) {
+				t.Fatal("计算结果不在曲线上")
+			}
+			//使用基点做一般的标量乘法，结果应该一致
+			x, y = curve.ScalarMult(curve.Params().Gx, curve.Params().Gy, test.k.Bytes())
+			if x.Cmp(hexInt(t, test.x)) != 0 || y.Cmp(hexInt(t, test.y)) != 0 {
+				t.Fatalf("ScalarMult期望(%s, %s)，实际为(%x, %x)", test.x, test.y, x, y)
+			}
+		})
+	}
+	//G + G与2·G一致
+	params := curve.Params()
+	x, y := curve.Add(params.Gx, params.Gy, params.Gx, params.Gy)
+	dx, dy := curve.Double(params.Gx, params.Gy)
+	if x.Cmp(dx) != 0 || y.Cmp(dy) != 0 {
+		t.Fatal("G + G与2·G的结果不一致")
+	}
+}
+
+func TestParsePub(t *testing.T) {
+	for _, name := range []string{SECP256K1, P256} {
+		t.Run(name, func(t *testing.T) {
+			curve, err := CurveByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 8; i++ {
+				pri, err := NewPriKey(curve)
+				if err != nil {
+					t.Fatal(err)
+				}
+				encodings := [][]byte{GetPub(pri), elliptic.Marshal(curve, pri.X, pri.Y)}
+				for _, encoded := range encodings {
+					pub, err := ParsePub(encoded)
+					if err != nil {
+						t.Fatalf("解析长度为%d的公钥失败：%v", len(encoded), err)
+					}
+					if pub.Curve.Params().Name != name || pub.X.Cmp(pri.X) != 0 || pub.Y.Cmp(pri.Y) != 0 {
+						t.Fatalf("长度为%d的公钥解析结果不正确", len(encoded))
+					}
+					if !bytes.Equal(MarshalPub(pub), GetPub(pri)) {
+						t.Fatal("解析后重新编码的公钥不一致")
+					}
+				}
+			}
+		})
+	}
+	//secp256k1的公钥使用压缩格式
+	pri, err := NewPriKey(S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(GetPub(pri)) != 33 {
+		t.Fatalf("secp256k1的公钥应该是33字节的压缩格式，实际为%d字节", len(GetPub(pri)))
+	}
+}
+
+func TestParsePubRejectsInvalid(t *testing.T) {
+	params := S256().Params()
+	//基点G的y坐标加1，不在任何一条曲线上
+	offCurve := make([]byte, 65)
+	offCurve[0] = 0x04
+	params.Gx.FillBytes(offCurve[1:33])
+	new(big.Int).Add(params.Gy, big.NewInt(1)).FillBytes(offCurve[33:])
+	//x = 5时x³ + 7 = 132不是模p的二次剩余，不存在对应的y
+	noSqrt := make([]byte, 33)
+	noSqrt[0] = 0x02
+	noSqrt[32] = 5
+	//x坐标不小于p
+	overflow := make([]byte, 33)
+	overflow[0] = 0x03
+	params.P.FillBytes(overflow[1:])
+	tests := []struct {
+		name string
+		pub  []byte
+	}{
+		{"不在曲线上的点", offCurve},
+		{"压缩格式的x没有对应的y", noSqrt},
+		{"压缩格式的x超出范围", overflow},
+		{"前缀不正确", append([]byte{0x05}, offCurve[1:]...)},
+		{"长度不正确", offCurve[:64]},
+		{"空的公钥", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParsePub(test.pub)
+			if err != ErrInvalidPubKey {
+				t.Fatalf("期望返回%v，实际返回%v", ErrInvalidPubKey, err)
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	hash := sha256.Sum256([]byte("XianfengChain"))
+	other := sha256.Sum256([]byte("XianfengChain04"))
+	for _, name := range []string{SECP256K1, P256} {
+		t.Run(name, func(t *testing.T) {
+			curve, err := CurveByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pri, err := NewPriKey(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			another, err := NewPriKey(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := Sign(pri, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(signature) != 64 {
+				t.Fatalf("签名的长度应该为64字节，实际为%d字节", len(signature))
+			}
+			if !Verify(GetPub(pri), hash[:], signature) {
+				t.Fatal("签名验证失败")
+			}
+			//非压缩格式的公钥同样可以验证签名
+			if !Verify(elliptic.Marshal(curve, pri.X, pri.Y), hash[:], signature) {
+				t.Fatal("使用非压缩格式的公钥验证签名失败")
+			}
+			if Verify(GetPub(pri), other[:], signature) {
+				t.Fatal("对其他数据的签名验证应该失败")
+			}
+			if Verify(GetPub(another), hash[:], signature) {
+				t.Fatal("使用其他公钥验证签名应该失败")
+			}
+			tampered := append([]byte{}, signature...)
+			tampered[0] ^= 0xff
+			if Verify(GetPub(pri), hash[:], tampered) {
+				t.Fatal("被篡改的签名验证应该失败")
+			}
+			if Verify(GetPub(pri), hash[:], signature[:63]) {
+				t.Fatal("长度不正确的签名验证应该失败")
+			}
+			//根据私钥字节恢复的私钥与原私钥一致
+			restored, err := PrivKeyFromBytes(curve, PrivKeyBytes(pri))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(GetPub(restored), GetPub(pri)) {
+				t.Fatal("根据私钥字节恢复的公钥不一致")
+			}
+		})
+	}
+}
@@ -1,19 +1,28 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"XianfengChain04/chain"
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/consensus"
+	"XianfengChain04/merkle"
+	"encoding/hex"
 	"os"
+	"os/signal"
+	"time"
 	"flag"
 	"math/big"
+	"XianfengChain04/transaction"
 	"XianfengChain04/utils"
+	"XianfengChain04/wallet"
 )
 
 /**
  * 该结构体定义了用于实现命令行参数解析的结构体
  */
 type CmdClient struct {
-	Chain chain.BlockChain
+	Chain *chain.BlockChain
 }
 
 /**
@@ -32,18 +41,62 @@ func (cmd *CmdClient) Run() {
 		cmd.GenerateGensis()
 	case SENDTRANSACTION: //发送交易..（前提：创世区块已存在）
 		cmd.SendTransaction()
+	case MINE: //从交易池中选择交易打包成新区块
+		cmd.Mine()
 	case GETBALANCE: //获取某个地址的余额
 		cmd.GetBalance()
+	case LISTTRANSACTIONS: //查询某个地址的交易记录
+		cmd.ListTransactions()
 	case GETLASTBLOCK:
 		cmd.GetLastBlock()
 	case GETALLBLOCKS:
 		cmd.GetAllBlocks()
+	case GETBLOCK:
+		cmd.GetBlock()
+	case GETBLOCKHASH:
+		cmd.GetBlockHash()
+	case GETBLOCKCOUNT:
+		cmd.GetBlockCount()
 	case GETNEWADDRESS: //生成新地址的功能
 		cmd.GetNewAddress()
 	case LISTADDRESS: //获取所有的地址列表
 		cmd.ListAddress()
 	case DUMPPRIVKEY:
 		cmd.DumpPrivKey()
+	case GETPUBKEY:
+		cmd.GetPubKey()
+	case REINDEXUTXO:
+		cmd.ReindexUTXO()
+	case MIGRATE:
+		cmd.Migrate()
+	case GETTRANSACTION:
+		cmd.GetTransaction()
+	case GETMERKLEPROOF:
+		cmd.GetMerkleProof()
+	case VERIFYPROOF:
+		cmd.VerifyProof()
+	case ENCRYPTWALLET:
+		cmd.EncryptWallet()
+	case WALLETPASSPHRASE:
+		cmd.WalletPassphrase()
+	case WALLETLOCK:
+		cmd.WalletLock()
+	case CHANGEPASSPHRASE:
+		cmd.WalletPassphraseChange()
+	case IMPORTADDRESS:
+		cmd.ImportAddress()
+	case IMPORTPUBKEY:
+		cmd.ImportPubKey()
+	case CREATERAWTX:
+		cmd.CreateRawTransaction()
+	case IMPORTPRIVKEY:
+		cmd.ImportPrivKey()
+	case NEWMNEMONIC:
+		cmd.NewMnemonic()
+	case IMPORTMNEMONIC:
+		cmd.ImportMnemonic()
+	case DUMPMNEMONIC:
+		cmd.DumpMnemonic()
 	case HELP:
 		cmd.Help()
 	default:
@@ -59,17 +112,242 @@ func (cmd *CmdClient) Default() {
 func (cmd *CmdClient)DumpPrivKey()  {
 	dumpPrivkey:=flag.NewFlagSet(DUMPPRIVKEY,flag.ExitOnError)
 	address :=dumpPrivkey.String("address","","要导出的私钥地址")
+	format := dumpPrivkey.String("format", "", "私钥的格式：wif或hex，默认secp256k1的私钥使用wif，P-256的私钥使用hex")
+	passphrase := dumpPrivkey.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
 	dumpPrivkey.Parse(os.Args[2:])
-	if len(os.Args[2:]) > 2 {
+	if len(dumpPrivkey.Args()) > 0 {
 		fmt.Println("无法解析输入参数,请检查后重试!")
 		return
 	}
-	pri,err := cmd.Chain.DumpPrivkey(*address)
+	if *format != "" && *format != "wif" && *format != "hex" {
+		fmt.Println("私钥的格式只能是wif或hex")
+		return
+	}
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
+	keyPair,err := cmd.Chain.DumpPrivkey(*address)
 	if err!=nil {
 		fmt.Println(err.Error())
 		return
 	}
-    fmt.Printf("私钥是%x",pri.D.Bytes())
+	//没有指定格式时根据私钥的曲线选择：WIF只能用于secp256k1的私钥
+	if *format == "" {
+		*format = "hex"
+		if keyPair.Priv.Curve.Params().Name == chaincrypto.SECP256K1 {
+			*format = "wif"
+		}
+	}
+	if *format == "hex" {
+		fmt.Printf("私钥是%x\n", chaincrypto.PrivKeyBytes(keyPair.Priv))
+		return
+	}
+	wif, err := wallet.EncodeWIF(keyPair.Priv, keyPair.Compressed())
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println("私钥是" + wif)
+}
+
+/**
+ * 导入WIF或hex格式的私钥
+ */
+func (cmd *CmdClient) ImportPrivKey() {
+	importPrivKey := flag.NewFlagSet(IMPORTPRIVKEY, flag.ExitOnError)
+	key := importPrivKey.String("key", "", "要导入的私钥，WIF格式或者hex格式")
+	label := importPrivKey.String("label", "", "地址的备注")
+	rescan := importPrivKey.Bool("rescan", true, "导入后扫描链上该地址的交易和余额")
+	passphrase := importPrivKey.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
+	importPrivKey.Parse(os.Args[2:])
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
+
+	address, err := cmd.Chain.ImportPrivKey(*key, *label)
+	if err != nil {
+		fmt.Println("抱歉，导入私钥失败：", err.Error())
+		return
+	}
+	fmt.Println("导入私钥成功，地址：", address)
+	if !*rescan {
+		return
+	}
+	txCount, balance, err := cmd.Chain.RescanAddress(address)
+	if err != nil {
+		fmt.Println("扫描地址的交易出现错误：", err.Error())
+		return
+	}
+	fmt.Printf("扫描完成，该地址有%d笔交易记录，余额是：%s\n", txCount, balance)
+}
+
+/**
+ * 获取钱包中地址的公钥
+ */
+func (cmd *CmdClient) GetPubKey() {
+	getPubKey := flag.NewFlagSet(GETPUBKEY, flag.ExitOnError)
+	address := getPubKey.String("address", "", "要获取公钥的地址")
+	getPubKey.Parse(os.Args[2:])
+
+	pub, err := cmd.Chain.GetPubKey(*address)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("地址%s的公钥是：%x\n", *address, pub)
+}
+
+/**
+ * 根据区块数据重建UTXO集合
+ */
+func (cmd *CmdClient) ReindexUTXO() {
+	reindexUTXO := flag.NewFlagSet(REINDEXUTXO, flag.ExitOnError)
+	reindexUTXO.Parse(os.Args[2:])
+	if len(os.Args[2:]) > 0 {
+		fmt.Println("无法解析参数，请检查后重试！")
+		return
+	}
+	err := cmd.Chain.ReindexUTXO()
+	if err != nil {
+		fmt.Println("重建UTXO集合失败：", err.Error())
+		return
+	}
+	fmt.Println("UTXO集合重建完成")
+}
+
+/**
+ * 将旧版本格式(金额为浮点数)的区块数据升级为当前版本的格式
+ */
+func (cmd *CmdClient) Migrate() {
+	migrate := flag.NewFlagSet(MIGRATE, flag.ExitOnError)
+	migrate.Parse(os.Args[2:])
+	if len(os.Args[2:]) > 0 {
+		fmt.Println("无法解析参数，请检查后重试！")
+		return
+	}
+	migrated, err := cmd.Chain.MigrateBlocks()
+	if err != nil {
+		fmt.Println("区块数据升级失败：", err.Error())
+		return
+	}
+	fmt.Printf("区块数据升级完成，共转换%d个区块\n", migrated)
+}
+
+/**
+ * 根据交易hash查询交易，显示交易输入花费的金额和地址
+ */
+func (cmd *CmdClient) GetTransaction() {
+	getTransaction := flag.NewFlagSet(GETTRANSACTION, flag.ExitOnError)
+	txid := getTransaction.String("txid", "", "交易hash")
+	getTransaction.Parse(os.Args[2:])
+
+	txHash, err := utils.Hex2Hash(*txid)
+	if err != nil {
+		fmt.Println("交易hash格式不正确：", err.Error())
+		return
+	}
+	info, err := cmd.Chain.GetTransaction(txHash)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("交易hash:%x\n", info.Tx.TxHash)
+	if info.Confirmations == 0 {
+		fmt.Println("交易还在交易池中，等待被打包")
+	} else {
+		fmt.Printf("交易所在区块高度:%d\n", info.Height)
+		fmt.Printf("交易所在区块哈希:%x\n", info.BlockHash)
+		fmt.Printf("确认数:%d\n", info.Confirmations)
+	}
+	if info.Tx.IsCoinBase() {
+		fmt.Println("coinbase交易")
+	}
+	var inputAmount transaction.Amount
+	resolved := true
+	for index, prevOutput := range info.PrevOutputs {
+		input := info.Tx.Inputs[index]
+		if prevOutput == nil {
+			resolved = false
+			fmt.Printf("   第%d笔交易输入,%s花了%x的%d的钱,金额未知\n", index, wallet.GetAddressByPub(input.PubKey), input.TxId, input.Vout)
+			continue
+		}
+		inputAmount += prevOutput.Value
+		fmt.Printf("   第%d笔交易输入,%s花了%x的%d的钱,金额%s\n", index, wallet.GetAddressByPubHash(prevOutput.ScriptPub), input.TxId, input.Vout, prevOutput.Value)
+	}
+	var outputAmount transaction.Amount
+	for index, output := range info.Tx.Outputs {
+		outputAmount += output.Value
+		fmt.Printf("   第%d笔交易输出,%s实现收入%s\n", index, wallet.GetAddressByPubHash(output.ScriptPub), output.Value)
+	}
+	if !info.Tx.IsCoinBase() && resolved && inputAmount >= outputAmount {
+		fmt.Printf("手续费:%s\n", inputAmount-outputAmount)
+	}
+}
+
+/**
+ * 获取交易的默克尔证明
+ */
+func (cmd *CmdClient) GetMerkleProof() {
+	getMerkleProof := flag.NewFlagSet(GETMERKLEPROOF, flag.ExitOnError)
+	txid := getMerkleProof.String("txid", "", "交易hash")
+	getMerkleProof.Parse(os.Args[2:])
+
+	txHash, err := utils.Hex2Hash(*txid)
+	if err != nil {
+		fmt.Println("交易hash格式不正确：", err.Error())
+		return
+	}
+	proof, err := cmd.Chain.GetMerkleProof(txHash)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("交易所在区块高度:%d\n", proof.Height)
+	fmt.Printf("交易所在区块哈希:%x\n", proof.BlockHash)
+	fmt.Printf("区块默克尔根:%x\n", proof.MerkleRoot)
+	fmt.Printf("默克尔证明:%x\n", merkle.EncodeProof(proof.Path))
+}
+
+/**
+ * 使用区块头中的默克尔根验证交易的默克尔证明，不需要完整的区块数据
+ */
+func (cmd *CmdClient) VerifyProof() {
+	verifyProof := flag.NewFlagSet(VERIFYPROOF, flag.ExitOnError)
+	txid := verifyProof.String("txid", "", "交易hash")
+	root := verifyProof.String("root", "", "区块头中的默克尔根")
+	proofStr := verifyProof.String("proof", "", "getmerkleproof命令得到的默克尔证明")
+	verifyProof.Parse(os.Args[2:])
+
+	txHash, err := utils.Hex2Hash(*txid)
+	if err != nil {
+		fmt.Println("交易hash格式不正确：", err.Error())
+		return
+	}
+	merkleRoot, err := utils.Hex2Hash(*root)
+	if err != nil {
+		fmt.Println("默克尔根格式不正确：", err.Error())
+		return
+	}
+	proofBytes, err := hex.DecodeString(*proofStr)
+	if err != nil {
+		fmt.Println("默克尔证明格式不正确：", err.Error())
+		return
+	}
+	path, err := merkle.DecodeProof(proofBytes)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	proof := chain.MerkleProof{
+		TxId:       txHash,
+		MerkleRoot: merkleRoot,
+		Path:       path,
+	}
+	if !proof.Verify() {
+		fmt.Println("验证失败，该交易不在默克尔根对应的区块中")
+		return
+	}
+	fmt.Println("验证成功，该交易包含在默克尔根对应的区块中")
 }
 
 func (cmd *CmdClient) ListAddress() {
@@ -86,7 +364,17 @@ func (cmd *CmdClient) ListAddress() {
 	}
 	fmt.Println("获取地址列表成功，地址信息如下：")
 	for index, add := range addList {
-		fmt.Printf("[%d]:%s\n", index+1, add)
+		line := fmt.Sprintf("[%d]:%s", index+1, add)
+		if path := cmd.Chain.Wallet.GetPath(add); path != "" {
+			line += "  " + path
+		}
+		if label := cmd.Chain.Wallet.GetLabel(add); label != "" {
+			line += "  " + label
+		}
+		if cmd.Chain.Wallet.IsWatchOnly(add) {
+			line += "  (watch-only)"
+		}
+		fmt.Println(line)
 	}
 }
 
@@ -95,42 +383,147 @@ func (cmd *CmdClient) ListAddress() {
  */
 func (cmd *CmdClient) GetNewAddress() {
 	getNewAddress := flag.NewFlagSet(GETNEWADDRESS, flag.ExitOnError)
+	change := getNewAddress.Bool("change", false, "生成找零地址")
+	passphrase := getNewAddress.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
 	getNewAddress.Parse(os.Args[2:])
 
-	if len(os.Args[2:]) > 0 {
+	if len(getNewAddress.Args()) > 0 {
 		fmt.Println("抱歉，生成新地址功能无法解析参数，请重试！")
 		return
 	}
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
 
-	address, err := cmd.Chain.GetNewAddress()
+	hasSeed := cmd.Chain.Wallet.HasHDSeed()
+	var address string
+	var err error
+	if *change {
+		address, err = cmd.Chain.GetNewChangeAddress()
+	} else {
+		address, err = cmd.Chain.GetNewAddress()
+	}
 	if err != nil {
 		fmt.Println("生成地址遇到错误：", err.Error())
 		return
 	}
 	fmt.Println("生成新的地址：", address)
+	if !hasSeed {
+		fmt.Println("钱包已自动生成HD种子，请使用dumpmnemonic命令导出助记词备份")
+	}
 }
 
+/**
+ * 分页查询主链上的区块，从高度为from的区块开始往创世区块的方向打印
+ */
 func (cmd *CmdClient) GetAllBlocks() {
-	blocks, err := cmd.Chain.GetAllBlocks()
+	getAllBlocks := flag.NewFlagSet(GETALLBLOCKS, flag.ExitOnError)
+	from := getAllBlocks.Int64("from", -1, "从该高度的区块开始查询，默认从最新区块开始")
+	limit := getAllBlocks.Int("limit", 0, "最多查询的区块数量，默认查询所有区块")
+	getAllBlocks.Parse(os.Args[2:])
+
+	blocks, err := cmd.Chain.GetBlocks(*from, *limit)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	fmt.Println("恭喜，查询到所有区块数据")
+	fmt.Println("恭喜，查询到区块数据")
 	for _, block := range blocks {
-		fmt.Printf("区块高度:%d,区块哈希:%x\n", block.Height, block.Hash)
-		fmt.Print("区块中的交易信息：\n")
-		for index, tx := range block.Transactions {
-			fmt.Printf("   第%d笔交易,交易hash:%x\n", index, tx.TxHash)
-			for inputIndex, input := range tx.Inputs {
-				fmt.Printf("       第%d笔交易输入,%s花了%x的%d的钱\n", inputIndex, input.ScriptSig, input.TxId, input.Vout)
-			}
-			for outputIndex, output := range tx.Outputs {
-				fmt.Printf("       第%d笔交易输出,%s实现收入%f\n", outputIndex, output.ScriptPub, output.Value)
-			}
+		printBlock(block)
+	}
+}
+
+/**
+ * 根据hash或者高度查询区块
+ */
+func (cmd *CmdClient) GetBlock() {
+	getBlock := flag.NewFlagSet(GETBLOCK, flag.ExitOnError)
+	hashStr := getBlock.String("hash", "", "区块hash")
+	height := getBlock.Int64("height", -1, "主链上区块的高度")
+	getBlock.Parse(os.Args[2:])
+
+	var block chain.Block
+	var err error
+	if *hashStr != "" {
+		hash, hashErr := utils.Hex2Hash(*hashStr)
+		if hashErr != nil {
+			fmt.Println("区块hash格式不正确：", hashErr.Error())
+			return
+		}
+		block, err = cmd.Chain.GetBlockByHash(hash)
+	} else if *height >= 0 {
+		block, err = cmd.Chain.GetBlockByHeight(*height)
+	} else {
+		fmt.Println("请使用hash或者height参数指定要查询的区块")
+		return
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("区块版本:%d\n", block.Version)
+	fmt.Printf("前一个区块哈希:%x\n", block.PrevHash)
+	fmt.Printf("默克尔根:%x\n", block.MerkleRoot)
+	fmt.Printf("时间戳:%d\n", block.TimeStamp)
+	fmt.Printf("难度目标:%08x\n", block.Bits)
+	fmt.Printf("随机数:%d\n", block.Nonce)
+	printBlock(block)
+}
+
+/**
+ * 查询主链上某个高度的区块hash
+ */
+func (cmd *CmdClient) GetBlockHash() {
+	getBlockHash := flag.NewFlagSet(GETBLOCKHASH, flag.ExitOnError)
+	height := getBlockHash.Int64("height", -1, "主链上区块的高度")
+	getBlockHash.Parse(os.Args[2:])
+
+	if *height < 0 {
+		fmt.Println("请使用height参数指定区块的高度")
+		return
+	}
+	hash, err := cmd.Chain.GetBlockHash(*height)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Printf("%x\n", hash)
+}
+
+/**
+ * 查询最新区块的高度
+ */
+func (cmd *CmdClient) GetBlockCount() {
+	getBlockCount := flag.NewFlagSet(GETBLOCKCOUNT, flag.ExitOnError)
+	getBlockCount.Parse(os.Args[2:])
+	if len(os.Args[2:]) > 0 {
+		fmt.Println("无法解析参数，请检查后重试！")
+		return
+	}
+	lastBlock := cmd.Chain.GetLastBlock()
+	if lastBlock.Hash == [32]byte{} {
+		fmt.Println("抱歉，当前暂无区块.")
+		return
+	}
+	fmt.Println(lastBlock.Height)
+}
+
+/**
+ * 打印区块的高度、hash以及区块中的交易信息
+ */
+func printBlock(block chain.Block) {
+	fmt.Printf("区块高度:%d,区块哈希:%x\n", block.Height, block.Hash)
+	fmt.Print("区块中的交易信息：\n")
+	for index, tx := range block.Transactions {
+		fmt.Printf("   第%d笔交易,交易hash:%x\n", index, tx.TxHash)
+		for inputIndex, input := range tx.Inputs {
+			fmt.Printf("       第%d笔交易输入,%s花了%x的%d的钱\n", inputIndex, wallet.GetAddressByPub(input.PubKey), input.TxId, input.Vout)
+		}
+		for outputIndex, output := range tx.Outputs {
+			fmt.Printf("       第%d笔交易输出,%s实现收入%s\n", outputIndex, wallet.GetAddressByPubHash(output.ScriptPub), output.Value)
 		}
-		fmt.Println()
 	}
+	fmt.Println()
 }
 
 func (cmd *CmdClient) GetLastBlock() {
@@ -145,6 +538,7 @@ func (cmd *CmdClient) GetLastBlock() {
 	fmt.Println("恭喜，获取到最新区块数据")
 	fmt.Printf("最新区块高度:%d\n", lastBlock.Height)
 	fmt.Printf("最新区块哈希:%x\n", lastBlock.Hash)
+	fmt.Printf("最新区块难度目标:%08x\n", lastBlock.Bits)
 
 	for index, tx := range lastBlock.Transactions {
 		fmt.Printf("区块交易%d,交易:%v\n", index, tx)
@@ -160,9 +554,11 @@ func (cmd *CmdClient) SendTransaction() {
 	from := createBlock.String("from", "", "交易发起人地址")
 	to := createBlock.String("to", "", "交易接收者地址")
 	amount := createBlock.String("amount", "", "转账的数量")
+	fee := createBlock.String("fee", "0", "每笔交易支付给矿工的手续费")
+	passphrase := createBlock.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
 
-	if len(os.Args[2:]) > 6 {
-		fmt.Println("sendTransaction命令只支持三个参数和参数值，请重试")
+	if len(os.Args[2:]) > 10 {
+		fmt.Println("sendTransaction命令只支持from、to、amount、fee、passphrase五个参数和参数值，请重试")
 		return
 	}
 	createBlock.Parse(os.Args[2:])
@@ -178,11 +574,29 @@ func (cmd *CmdClient) SendTransaction() {
 		fmt.Println("抱歉，参数格式不正确，请检查后重试！")
 		return
 	}
-	amountSlice, err := utils.JSONArray2Float(*amount)
+	amountStrSlice, err := utils.JSONArray2Number(*amount)
 	if err != nil {
 		fmt.Println("抱歉，参数格式不正确，请检查后重试！")
 		return
 	}
+	amountSlice := make([]transaction.Amount, 0)
+	for _, amountStr := range amountStrSlice {
+		amount, err := transaction.ParseAmount(amountStr)
+		if err != nil {
+			fmt.Println("抱歉，金额不正确：", err.Error())
+			return
+		}
+		if amount <= 0 {
+			fmt.Println("抱歉，转账的数量必须大于0")
+			return
+		}
+		amountSlice = append(amountSlice, amount)
+	}
+	feeAmount, err := transaction.ParseAmount(*fee)
+	if err != nil {
+		fmt.Println("抱歉，手续费不正确：", err.Error())
+		return
+	}
 
 	//先看看参数个数是否一致
 	fromLen := len(fromSlice)
@@ -195,19 +609,79 @@ func (cmd *CmdClient) SendTransaction() {
 
 	//1、先判断是否已生成创世区块，如果没有创世区块，提示用户先生成
 	//[0000000]
+	lastHash := cmd.Chain.GetLastBlock().Hash
 	hashBig := new(big.Int)
-	hashBig.SetBytes(cmd.Chain.LastBlock.Hash[:])
+	hashBig.SetBytes(lastHash[:])
 	if hashBig.Cmp(big.NewInt(0)) == 0 { //没有创世区块
 		fmt.Println("That not a gensis block in blockchain，please use go run main.go generategensis command to create a gensis block first.")
 		return
 	}
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
 
-	err = cmd.Chain.SendTransaction(fromSlice, toSlice, amountSlice)
+	txIds, err := cmd.Chain.SendTransaction(fromSlice, toSlice, amountSlice, feeAmount)
+	for _, txId := range txIds {
+		fmt.Printf("交易已加入交易池，交易hash:%x\n", txId)
+	}
 	if err != nil {
 		fmt.Println("抱歉，发送交易出现错误：", err.Error())
 		return
 	}
-	fmt.Println("交易发送成功")
+	fmt.Println("交易发送成功，等待矿工使用mine命令打包")
+}
+
+/**
+ * 挖矿：按照手续费率从交易池中选择交易打包成新区块
+ */
+func (cmd *CmdClient) Mine() {
+	mine := flag.NewFlagSet(MINE, flag.ExitOnError)
+	miner := mine.String("miner", "", "矿工地址，用于领取区块奖励和手续费，默认使用配置文件中的矿工地址")
+	passphrase := mine.String("passphrase", "", "钱包加密时用于解锁钱包的口令，PoA共识需要使用钱包中签名者的私钥")
+	timeout := mine.Int64("timeout", 600, "挖矿时钱包保持解锁的时间(秒)")
+	mine.Parse(os.Args[2:])
+
+	lastHash := cmd.Chain.GetLastBlock().Hash
+	hashBig := new(big.Int)
+	hashBig.SetBytes(lastHash[:])
+	if hashBig.Cmp(big.NewInt(0)) == 0 { //没有创世区块
+		fmt.Println("That not a gensis block in blockchain，please use go run main.go generategensis command to create a gensis block first.")
+		return
+	}
+
+	//按下Ctrl+C时取消挖矿
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if *passphrase != "" {
+		err := cmd.Chain.WalletPassphrase(*passphrase, time.Duration(*timeout)*time.Second)
+		if err != nil {
+			fmt.Println("抱歉，解锁钱包失败：", err.Error())
+			return
+		}
+	}
+	consensus.DefaultMiner.Report = func(hashes uint64, elapsed time.Duration) {
+		fmt.Printf("已计算%d次hash，用时%s，算力:%.0f H/s\n", hashes, elapsed.Round(time.Millisecond), consensus.HashRate(hashes, elapsed))
+	}
+
+	block, err := cmd.Chain.MineBlock(ctx, *miner)
+	if err != nil {
+		fmt.Println("抱歉，挖矿出现错误：", err.Error())
+		return
+	}
+	fmt.Println("恭喜，挖出了一个新区块")
+	fmt.Printf("区块高度:%d\n", block.Height)
+	fmt.Printf("区块哈希:%x\n", block.Hash)
+	fmt.Printf("打包的交易数量:%d\n", len(block.Transactions)-1)
 }
 
 /**
@@ -216,24 +690,67 @@ func (cmd *CmdClient) SendTransaction() {
 func (cmd *CmdClient) GetBalance() {
 	getbalance := flag.NewFlagSet(GETBALANCE, flag.ExitOnError)
 	var addr string
-	getbalance.StringVar(&addr, "address", "", "用户的地址")
+	getbalance.StringVar(&addr, "address", "", "用户的地址，不指定时查询钱包中所有地址的余额")
 	getbalance.Parse(os.Args[2:])
 
 	blockChain := cmd.Chain
 	//1、先判断是否有创世区块
+	lastHash := blockChain.GetLastBlock().Hash
 	hashBig := new(big.Int)
-	hashBig.SetBytes(blockChain.LastBlock.Hash[:])
+	hashBig.SetBytes(lastHash[:])
 	if hashBig.Cmp(big.NewInt(0)) == 0 { //没有创世区块
 		fmt.Println("抱歉，该网络链暂未存在，无法查询")
 		return
 	}
-	//2、调用余额查询功能
+	//2、没有指定地址时，查询钱包的余额，观察地址的余额单独统计
+	if addr == "" {
+		spendable, watchOnly, err := blockChain.GetWalletBalance()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Printf("钱包的余额是：%s\n", spendable)
+		fmt.Printf("观察地址的余额是：%s\n", watchOnly)
+		return
+	}
+	//3、调用余额查询功能
 	balance, err := blockChain.GetBalance(addr)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	fmt.Printf("地址%s的余额是：%f\n", addr, balance)
+	fmt.Printf("地址%s的余额是：%s\n", addr, balance)
+}
+
+/**
+ * 查询地址的交易记录，从新到旧排列
+ */
+func (cmd *CmdClient) ListTransactions() {
+	listTransactions := flag.NewFlagSet(LISTTRANSACTIONS, flag.ExitOnError)
+	addr := listTransactions.String("address", "", "要查询的地址")
+	offset := listTransactions.Int("offset", 0, "跳过最新的多少条记录")
+	limit := listTransactions.Int("limit", 10, "最多显示多少条记录，0为不限制")
+	listTransactions.Parse(os.Args[2:])
+
+	history, err := cmd.Chain.GetAddressHistory(*addr, *offset, *limit)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if len(history) == 0 {
+		fmt.Println("该地址暂无交易记录")
+		return
+	}
+	fmt.Printf("地址%s的交易记录如下：\n", *addr)
+	for _, record := range history {
+		fmt.Printf("交易hash:%x\n", record.TxId)
+		if record.Confirmations == 0 {
+			fmt.Println("   交易还在交易池中，等待被打包")
+		} else {
+			fmt.Printf("   区块高度:%d,确认数:%d\n", record.Height, record.Confirmations)
+		}
+		fmt.Printf("   收到:%s,花掉:%s,净额:%s\n", record.Received, record.Sent, record.Net)
+	}
 }
 
 func (cmd *CmdClient) GenerateGensis() {
@@ -246,8 +763,9 @@ func (cmd *CmdClient) GenerateGensis() {
 
 	blockChain := cmd.Chain
 	//1、先判断该blockchain中是否已存在创世区块
+	lastHash := blockChain.GetLastBlock().Hash
 	hashBig := new(big.Int)
-	hashBig.SetBytes(blockChain.LastBlock.Hash[:])
+	hashBig.SetBytes(lastHash[:])
 	if hashBig.Cmp(big.NewInt(0)) == 1 {
 		fmt.Println("创世区块已存在，不能重复生成创世区块")
 		return
@@ -275,12 +793,279 @@ func (cmd *CmdClient) Help() {
 	fmt.Println("AVAILABLE COMMANDS")
 	fmt.Println()
 	fmt.Println("    generategensis    use the command can create a genesis block and save to the boltdb file. use the genesis argument to set the custom data.")
-	fmt.Println("    sendtransaction   this command used to send a new transaction, that can specified three argument named from, to and amount.")
-	fmt.Println("    getbalance        this is a command that can get the balance of specified address")
+	fmt.Println("    sendtransaction   this command used to send a new transaction, that can specified argument named from, to, amount and fee, the transactions wait in the mempool.")
+	fmt.Println("    mine              pack the transactions in the mempool into a new block by fee rate, the miner argument set the reward address.")
+	fmt.Println("    getbalance        this is a command that can get the balance of specified address, or of the whole wallet without the address argument")
+	fmt.Println("    listtransactions  list the transactions of the address argument from newest to oldest, page with the offset and limit arguments.")
 	fmt.Println("    getlastblock      get the lastest block data.")
-	fmt.Println("    getallblocks      return all blocks data to user.")
+	fmt.Println("    getallblocks      return the blocks of the main chain to user, the from and limit arguments page through them.")
+	fmt.Println("    getblock          get a block by the hash or height argument.")
+	fmt.Println("    getblockhash      get the hash of the main chain block at the height argument.")
+	fmt.Println("    getblockcount     get the height of the lastest block.")
 	fmt.Println("    getnewaddress     this commadn used to create a new address by bitcoin algorithm")
+	fmt.Println("    getpubkey         print the public key of the address argument, used to configure the signers of the poa consensus.")
+	fmt.Println("    reindex-utxo      rebuild the unspent transaction output set from the blocks.")
+	fmt.Println("    migrate           convert blocks saved with float amounts to the current format.")
+	fmt.Println("    gettransaction    get a transaction specified by the txid argument with its confirmations and input values.")
+	fmt.Println("    getmerkleproof    get the merkle proof of a transaction specified by the txid argument.")
+	fmt.Println("    verifyproof       verify a merkle proof with the txid, root and proof arguments.")
+	fmt.Println("    importaddress     import the address argument as a watch-only address with an optional label.")
+	fmt.Println("    importpubkey      import the hex pubkey argument as a watch-only address with an optional label.")
+	fmt.Println("    createrawtransaction  build unsigned transactions with the from, to, amount and fee arguments, watch-only addresses can be used as from.")
+	fmt.Println("    dumpprivkey       print the private key of the address argument in the wif or hex format.")
+	fmt.Println("    importprivkey     import a wif or hex private key with an optional label, rescan reports its transactions and balance.")
+	fmt.Println("    newmnemonic       generate a new mnemonic with the words argument as the hd seed of the wallet, new addresses are derived from it.")
+	fmt.Println("    importmnemonic    restore the hd wallet from the mnemonic argument, addresses with transactions are discovered until gap unused ones.")
+	fmt.Println("    dumpmnemonic      print the mnemonic of the hd wallet for backup.")
+	fmt.Println("    encryptwallet     encrypt the private keys of the wallet with the passphrase argument, the wallet is locked after that.")
+	fmt.Println("    walletpassphrase  check the passphrase argument, the wallet is only unlocked until this command exits, pass the passphrase argument to commands using private keys instead.")
+	fmt.Println("    walletlock        lock the wallet and remove the private keys from memory.")
+	fmt.Println("    walletpassphrasechange  change the passphrase of the wallet from the oldpassphrase argument to the newpassphrase argument.")
 	fmt.Println("    help              use the command can print usage infomation.")
 	fmt.Println()
 	fmt.Println("Use go run main.go help [command] for more information about a command.")
 }
+
+/**
+ * 命令使用了passphrase参数时，在执行命令之前解锁钱包，解锁失败时返回false
+ */
+func (cmd *CmdClient) unlockWallet(passphrase string) bool {
+	if passphrase == "" {
+		return true
+	}
+	err := cmd.Chain.WalletPassphrase(passphrase, UNLOCKTIMEOUT*time.Second)
+	if err != nil {
+		fmt.Println("抱歉，解锁钱包失败：", err.Error())
+		return false
+	}
+	return true
+}
+
+/**
+ * 使用口令加密钱包
+ */
+func (cmd *CmdClient) EncryptWallet() {
+	encryptWallet := flag.NewFlagSet(ENCRYPTWALLET, flag.ExitOnError)
+	passphrase := encryptWallet.String("passphrase", "", "用于加密钱包的口令")
+	encryptWallet.Parse(os.Args[2:])
+
+	err := cmd.Chain.EncryptWallet(*passphrase)
+	if err != nil {
+		fmt.Println("抱歉，加密钱包失败：", err.Error())
+		return
+	}
+	fmt.Println("钱包已加密，请牢记口令，使用私钥的命令需要先解锁钱包")
+}
+
+/**
+ * 使用口令解锁钱包，超过timeout秒之后钱包自动锁定
+ * 每个命令都是一个单独的进程，解锁只在本次命令执行期间有效，使用私钥的命令需要通过passphrase参数解锁
+ */
+func (cmd *CmdClient) WalletPassphrase() {
+	walletPassphrase := flag.NewFlagSet(WALLETPASSPHRASE, flag.ExitOnError)
+	passphrase := walletPassphrase.String("passphrase", "", "钱包的口令")
+	timeout := walletPassphrase.Int64("timeout", UNLOCKTIMEOUT, "钱包保持解锁的时间(秒)")
+	walletPassphrase.Parse(os.Args[2:])
+
+	err := cmd.Chain.WalletPassphrase(*passphrase, time.Duration(*timeout)*time.Second)
+	if err != nil {
+		fmt.Println("抱歉，解锁钱包失败：", err.Error())
+		return
+	}
+	fmt.Println("口令正确。钱包只在本次命令执行期间解锁，命令结束后重新锁定")
+	fmt.Println("使用私钥的命令(如sendtransaction、mine)请通过passphrase参数解锁钱包")
+}
+
+/**
+ * 锁定钱包
+ */
+func (cmd *CmdClient) WalletLock() {
+	walletLock := flag.NewFlagSet(WALLETLOCK, flag.ExitOnError)
+	walletLock.Parse(os.Args[2:])
+
+	err := cmd.Chain.WalletLock()
+	if err != nil {
+		fmt.Println("抱歉，锁定钱包失败：", err.Error())
+		return
+	}
+	fmt.Println("钱包已锁定")
+}
+
+/**
+ * 修改钱包的口令
+ */
+func (cmd *CmdClient) WalletPassphraseChange() {
+	changePassphrase := flag.NewFlagSet(CHANGEPASSPHRASE, flag.ExitOnError)
+	oldPassphrase := changePassphrase.String("oldpassphrase", "", "钱包当前的口令")
+	newPassphrase := changePassphrase.String("newpassphrase", "", "钱包新的口令")
+	changePassphrase.Parse(os.Args[2:])
+
+	err := cmd.Chain.WalletPassphraseChange(*oldPassphrase, *newPassphrase)
+	if err != nil {
+		fmt.Println("抱歉，修改口令失败：", err.Error())
+		return
+	}
+	fmt.Println("钱包口令已修改")
+}
+
+/**
+ * 生成新的助记词作为HD钱包的种子
+ */
+func (cmd *CmdClient) NewMnemonic() {
+	newMnemonic := flag.NewFlagSet(NEWMNEMONIC, flag.ExitOnError)
+	words := newMnemonic.Int("words", 12, "助记词的单词数量：12、15、18、21或24")
+	passphrase := newMnemonic.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
+	newMnemonic.Parse(os.Args[2:])
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
+
+	mnemonic, err := cmd.Chain.NewMnemonic(*words)
+	if err != nil {
+		fmt.Println("抱歉，生成助记词失败：", err.Error())
+		return
+	}
+	fmt.Println("新的助记词如下，请抄写并妥善保管，之后生成的地址都可以使用助记词恢复：")
+	fmt.Println(mnemonic)
+}
+
+/**
+ * 导入助记词恢复HD钱包
+ */
+func (cmd *CmdClient) ImportMnemonic() {
+	importMnemonic := flag.NewFlagSet(IMPORTMNEMONIC, flag.ExitOnError)
+	mnemonic := importMnemonic.String("mnemonic", "", "要导入的助记词，单词之间用空格分隔")
+	bip39Passphrase := importMnemonic.String("bip39passphrase", "", "生成种子时使用的助记词口令(可选)")
+	gap := importMnemonic.Uint("gap", wallet.GAPLIMIT, "连续多少个地址没有交易记录时停止查找")
+	passphrase := importMnemonic.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
+	importMnemonic.Parse(os.Args[2:])
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
+
+	count, err := cmd.Chain.ImportMnemonic(*mnemonic, *bip39Passphrase, uint32(*gap))
+	if err != nil {
+		fmt.Println("抱歉，导入助记词失败：", err.Error())
+		return
+	}
+	fmt.Printf("导入助记词成功，恢复了%d个有交易记录的地址\n", count)
+}
+
+/**
+ * 导出HD钱包的助记词
+ */
+func (cmd *CmdClient) DumpMnemonic() {
+	dumpMnemonic := flag.NewFlagSet(DUMPMNEMONIC, flag.ExitOnError)
+	passphrase := dumpMnemonic.String("passphrase", "", "钱包加密时用于解锁钱包的口令")
+	dumpMnemonic.Parse(os.Args[2:])
+	if !cmd.unlockWallet(*passphrase) {
+		return
+	}
+
+	mnemonic, err := cmd.Chain.DumpMnemonic()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println(mnemonic)
+}
+
+/**
+ * 导入观察地址
+ */
+func (cmd *CmdClient) ImportAddress() {
+	importAddress := flag.NewFlagSet(IMPORTADDRESS, flag.ExitOnError)
+	address := importAddress.String("address", "", "要观察的地址")
+	label := importAddress.String("label", "", "地址的备注")
+	importAddress.Parse(os.Args[2:])
+
+	err := cmd.Chain.ImportAddress(*address, *label)
+	if err != nil {
+		fmt.Println("抱歉，导入地址失败：", err.Error())
+		return
+	}
+	fmt.Println("导入观察地址成功：", *address)
+}
+
+/**
+ * 导入公钥作为观察地址
+ */
+func (cmd *CmdClient) ImportPubKey() {
+	importPubKey := flag.NewFlagSet(IMPORTPUBKEY, flag.ExitOnError)
+	pubHex := importPubKey.String("pubkey", "", "要观察的公钥(十六进制)")
+	label := importPubKey.String("label", "", "地址的备注")
+	importPubKey.Parse(os.Args[2:])
+
+	pub, err := hex.DecodeString(*pubHex)
+	if err != nil {
+		fmt.Println("抱歉，公钥格式不正确，请检查后重试！")
+		return
+	}
+	address, err := cmd.Chain.ImportPubKey(pub, *label)
+	if err != nil {
+		fmt.Println("抱歉，导入公钥失败：", err.Error())
+		return
+	}
+	fmt.Println("导入观察地址成功：", address)
+}
+
+/**
+ * 构建未签名的交易，打印交易的hash和序列化后的十六进制数据
+ */
+func (cmd *CmdClient) CreateRawTransaction() {
+	createRawTx := flag.NewFlagSet(CREATERAWTX, flag.ExitOnError)
+	from := createRawTx.String("from", "", "交易发起人地址")
+	to := createRawTx.String("to", "", "交易接收者地址")
+	amount := createRawTx.String("amount", "", "转账的数量")
+	fee := createRawTx.String("fee", "0", "每笔交易支付给矿工的手续费")
+	createRawTx.Parse(os.Args[2:])
+
+	fromSlice, err := utils.JSONArray2String(*from)
+	if err != nil {
+		fmt.Println("抱歉，参数格式不正确，请检查后重试！")
+		return
+	}
+	toSlice, err := utils.JSONArray2String(*to)
+	if err != nil {
+		fmt.Println("抱歉，参数格式不正确，请检查后重试！")
+		return
+	}
+	amountStrSlice, err := utils.JSONArray2Number(*amount)
+	if err != nil {
+		fmt.Println("抱歉，参数格式不正确，请检查后重试！")
+		return
+	}
+	amountSlice := make([]transaction.Amount, 0)
+	for _, amountStr := range amountStrSlice {
+		amount, err := transaction.ParseAmount(amountStr)
+		if err != nil {
+			fmt.Println("抱歉，金额不正确：", err.Error())
+			return
+		}
+		if amount <= 0 {
+			fmt.Println("抱歉，转账的数量必须大于0")
+			return
+		}
+		amountSlice = append(amountSlice, amount)
+	}
+	feeAmount, err := transaction.ParseAmount(*fee)
+	if err != nil {
+		fmt.Println("抱歉，手续费不正确：", err.Error())
+		return
+	}
+
+	txs, err := cmd.Chain.CreateRawTransaction(fromSlice, toSlice, amountSlice, feeAmount)
+	if err != nil {
+		fmt.Println("抱歉，构建交易出现错误：", err.Error())
+		return
+	}
+	for _, tx := range txs {
+		txBytes, err := tx.MarshalBinary()
+		if err != nil {
+			fmt.Println("抱歉，序列化交易出现错误：", err.Error())
+			return
+		}
+		fmt.Printf("未签名的交易hash:%x\n", tx.TxHash)
+		fmt.Printf("%x\n", txBytes)
+	}
+}
@@ -1,13 +1,37 @@
 package client
 
 const (
-	GENERATEGENSIS  = "generategensis"  //ccoinbase -addr
-	SENDTRANSACTION = "sendtransaction" //sendTransaction from to amount
-	GETBALANCE      = "getbalance"      //获取地址的余额功能
-	GETLASTBLOCK    = "getlastblock"
-	GETALLBLOCKS    = "getallblocks"
-	GETNEWADDRESS   = "getnewaddress" //生成新的比特币地址
-	DUMPPRIVKEY     = "dumpprivkey"
-	LISTADDRESS     = "listaddress"   //列出所有目前已经生成并管理的地址
-	HELP            = "help"
+	GENERATEGENSIS   = "generategensis"   //ccoinbase -addr
+	SENDTRANSACTION  = "sendtransaction"  //sendTransaction from to amount
+	MINE             = "mine"             //从交易池中选择交易打包成新区块
+	GETBALANCE       = "getbalance"       //获取地址的余额功能
+	LISTTRANSACTIONS = "listtransactions" //查询地址的交易记录
+	GETLASTBLOCK     = "getlastblock"
+	GETALLBLOCKS     = "getallblocks"
+	GETBLOCK         = "getblock"      //根据hash或者高度查询区块
+	GETBLOCKHASH     = "getblockhash"  //查询主链上某个高度的区块hash
+	GETBLOCKCOUNT    = "getblockcount" //查询最新区块的高度
+	GETNEWADDRESS    = "getnewaddress" //生成新的比特币地址
+	DUMPPRIVKEY      = "dumpprivkey"
+	GETPUBKEY        = "getpubkey"              //获取地址的公钥，用于配置PoA共识的签名者
+	LISTADDRESS      = "listaddress"            //列出所有目前已经生成并管理的地址
+	REINDEXUTXO      = "reindex-utxo"           //根据区块数据重建UTXO集合
+	MIGRATE          = "migrate"                //将旧版本格式的区块数据升级为当前版本的格式
+	GETTRANSACTION   = "gettransaction"         //根据交易hash查询交易
+	GETMERKLEPROOF   = "getmerkleproof"         //获取交易的默克尔证明
+	VERIFYPROOF      = "verifyproof"            //使用默克尔根验证交易的默克尔证明
+	ENCRYPTWALLET    = "encryptwallet"          //使用口令加密钱包中的私钥
+	WALLETPASSPHRASE = "walletpassphrase"       //使用口令解锁钱包
+	WALLETLOCK       = "walletlock"             //锁定钱包
+	CHANGEPASSPHRASE = "walletpassphrasechange" //修改钱包的口令
+	IMPORTADDRESS    = "importaddress"          //导入观察地址
+	IMPORTPUBKEY     = "importpubkey"           //导入公钥作为观察地址
+	CREATERAWTX      = "createrawtransaction"   //构建未签名的交易，可以使用观察地址
+	IMPORTPRIVKEY    = "importprivkey"          //导入WIF或hex格式的私钥
+	NEWMNEMONIC      = "newmnemonic"            //生成新的助记词作为HD钱包的种子
+	IMPORTMNEMONIC   = "importmnemonic"         //导入助记词恢复HD钱包
+	DUMPMNEMONIC     = "dumpmnemonic"           //导出HD钱包的助记词用于备份
+	HELP             = "help"
 )
+
+const UNLOCKTIMEOUT = 60 //使用passphrase参数执行命令时，钱包保持解锁的时间(秒)
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+const CONFIGFILE = "config.json"
+
+/**
+ * 节点的配置信息，从json格式的配置文件中读取，配置文件不存在时使用默认配置
+ */
+type Config struct {
+	Consensus        string    `json:"consensus"`         //共识引擎的名称：pow、poa、instant
+	Miner            string    `json:"miner"`             //矿工地址，用于领取区块奖励和手续费
+	HalvingInterval  int64     `json:"halving_interval"`  //区块奖励每隔多少个区块减半
+	CoinbaseMaturity int64     `json:"coinbase_maturity"` //coinbase交易的输出需要经过多少个区块才能被花费
+	MaxBlockSize     int       `json:"max_block_size"`    //挖矿时从交易池中选择的交易的总大小上限(字节)
+	TargetBlockTime  int64     `json:"target_block_time"` //期望的出块间隔(秒)
+	RetargetInterval int64     `json:"retarget_interval"` //每隔多少个区块调整一次难度
+	TxIndex          bool      `json:"txindex"`           //是否维护交易索引，用于根据交易hash查询交易
+	WalletCurve      string    `json:"wallet_curve"`      //新钱包使用的椭圆曲线：secp256k1或P-256，已有秘钥的钱包继续使用原来的曲线
+	PoA              PoAConfig `json:"poa"`               //PoA共识的配置
+}
+
+/**
+ * PoA(权威证明)共识的配置
+ */
+type PoAConfig struct {
+	Signers []string        `json:"signers"` //初始的签名者公钥(十六进制)
+	Signer  string          `json:"signer"`  //本节点用于签名区块的地址，私钥保存在钱包中
+	Period  int64           `json:"period"`  //两个区块之间的最小间隔(秒)
+	Votes   map[string]bool `json:"votes"`   //本节点的投票：签名者公钥(十六进制) -> true为添加，false为移除
+}
+
+/**
+ * 默认配置
+ */
+func DefaultConfig() *Config {
+	return &Config{
+		Consensus:        "pow",
+		HalvingInterval:  210000,
+		CoinbaseMaturity: 10,
+		MaxBlockSize:     1000000,
+		TargetBlockTime:  10,
+		RetargetInterval: 20,
+		TxIndex:          true,
+		WalletCurve:      "secp256k1",
+		PoA: PoAConfig{
+			Period: 5,
+		},
+	}
+}
+
+/**
+ * 从配置文件中读取配置，配置文件中没有设置的项使用默认值
+ */
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -1,12 +1,36 @@
 package consensus
 
 import (
-	"math/big"
-	"XianfengChain04/transaction"
+	"context"
+	"crypto/ecdsa"
+	"errors"
 )
 
+var ErrInvalidSeal = errors.New("区块的共识封装数据无效")
+
+var ErrUnexpectedExtra = errors.New("该共识引擎的区块不能包含Extra数据")
+
+/**
+ * 共识引擎的接口标准：区块链通过该接口封装和验证区块，不依赖具体的共识算法
+ */
 type Consensus interface {
-	FindNonce() ([32]byte,int64)
+	//为区块计算共识封装数据(如PoW的nonce、PoA的签名)，ctx被取消时停止
+	Seal(ctx context.Context, chain ChainReader, block BlockInterface) (SealResult, error)
+	//验证区块的共识封装数据，chain用于读取区块之前的区块
+	VerifySeal(chain ChainReader, block BlockInterface) error
+	//计算追加在parent之后的区块的难度目标，parent为nil时计算创世区块的难度目标
+	CalcTarget(chain ChainReader, parent BlockInterface) (uint32, error)
+}
+
+/**
+ * 封装区块的结果，由区块链赋值给区块
+ * 封装过程中可能会调整区块的时间戳
+ */
+type SealResult struct {
+	Hash      [32]byte
+	Nonce     int64
+	TimeStamp int64
+	Extra     []byte
 }
 
 /**
@@ -17,11 +41,24 @@ type BlockInterface interface {
 	GetVersion() int64
 	GetTimeStamp() int64
 	GetPrevHash() [32]byte
-	GetTransactions() []transaction.Transaction
+	GetMerkleRoot() [32]byte
+	GetBits() uint32
+	GetHash() [32]byte
+	GetNonce() int64
+	GetExtra() []byte
 }
 
-func NewPoW(block BlockInterface) Consensus {
-	initTarget := big.NewInt(1)
-	initTarget.Lsh(initTarget, 255-DIFFICULTY)
-	return PoW{block, initTarget}
-}
\ No newline at end of file
+/**
+ * 共识引擎读取区块链中已有区块的接口
+ */
+type ChainReader interface {
+	//根据区块hash获取区块，找不到时返回nil
+	GetBlockByHash(hash [32]byte) (BlockInterface, error)
+}
+
+/**
+ * 需要使用本节点的私钥封装区块的共识引擎(如PoA)实现该接口，区块链加载钱包后调用Authorize
+ */
+type Authorizer interface {
+	Authorize(priv *ecdsa.PrivateKey, pub []byte)
+}
@@ -0,0 +1,25 @@
+package consensus
+
+import "testing"
+
+func TestVerifySealRejectsExtra(t *testing.T) {
+	block := testBlock{height: 1, timeStamp: 1000}
+	block.hash = CalculateHash(block, 0)
+	err := InstantEngine{}.VerifySeal(nil, block)
+	if err != nil {
+		t.Fatalf("区块应该通过验证，实际返回：%v", err)
+	}
+
+	//Extra不参与区块hash的计算，只有PoA的区块可以包含Extra
+	block.extra = []byte{0x01}
+	engines := map[string]Consensus{
+		POW:     &PoWEngine{},
+		INSTANT: InstantEngine{},
+	}
+	for name, engine := range engines {
+		err = engine.VerifySeal(nil, block)
+		if err != ErrUnexpectedExtra {
+			t.Fatalf("%s共识期望返回%v，实际返回%v", name, ErrUnexpectedExtra, err)
+		}
+	}
+}
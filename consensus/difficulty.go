@@ -0,0 +1,136 @@
+package consensus
+
+import (
+	"errors"
+	"math/big"
+)
+
+/**
+ * 区块头中的难度目标使用比特币的紧凑格式(Bits)表示：
+ * 最高字节为指数，低3个字节为尾数，目标值 = 尾数 * 256^(指数-3)
+ */
+
+//初始的难度目标，同时也是难度目标的上限(最低难度)
+var POWLIMIT = new(big.Int).Lsh(big.NewInt(1), 255-DIFFICULTY)
+
+//初始难度目标的紧凑格式，创世区块使用该难度
+var INITBITS = BigToCompact(POWLIMIT)
+
+//每次调整难度时，难度最多变为原来的4倍或者1/4
+const MAXADJUSTFACTOR = 4
+
+/**
+ * 将紧凑格式的难度目标转换为大整数
+ */
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+	//尾数的符号位表示负数，负数的难度目标无效
+	if bits&0x00800000 != 0 {
+		target.Neg(target)
+	}
+	return target
+}
+
+/**
+ * 将大整数形式的难度目标转换为紧凑格式，超出尾数精度的低位会被舍去
+ */
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+	exponent := uint(len(target.Bytes()))
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+	//尾数的最高位是符号位，为1时将尾数右移一个字节
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
+
+/**
+ * 计算追加在parent之后的区块应该使用的难度目标：
+ * 创世区块使用初始难度；每隔RetargetInterval个区块，根据上一个周期的区块时间戳调整一次难度；
+ * 其余区块沿用parent的难度
+ */
+func (engine *PoWEngine) CalcTarget(chain ChainReader, parent BlockInterface) (uint32, error) {
+	if parent == nil {
+		return INITBITS, nil
+	}
+	lastBits := parent.GetBits()
+	//旧版本的区块没有难度目标，使用的是初始难度
+	if lastBits == 0 {
+		lastBits = INITBITS
+	}
+	interval := engine.RetargetInterval
+	if interval <= 0 || (parent.GetHeight()+1)%interval != 0 {
+		return lastBits, nil
+	}
+
+	//找到调整周期开始的区块：parent之前的第interval个区块，不足时为创世区块
+	first := parent
+	for first.GetHeight() > 0 && parent.GetHeight()-first.GetHeight() < interval {
+		prev, err := chain.GetBlockByHash(first.GetPrevHash())
+		if err != nil {
+			return 0, err
+		}
+		if prev == nil {
+			return 0, errors.New("找不到难度调整周期内的区块，无法计算难度")
+		}
+		first = prev
+	}
+	actualTimespan := parent.GetTimeStamp() - first.GetTimeStamp()
+	targetTimespan := (parent.GetHeight() - first.GetHeight()) * engine.TargetBlockTime
+	if targetTimespan <= 0 {
+		return lastBits, nil
+	}
+	return CalcNextBits(lastBits, actualTimespan, targetTimespan), nil
+}
+
+/**
+ * 难度调整：根据上一个调整周期实际花费的时间和期望花费的时间计算新的难度目标
+ * 新目标 = 旧目标 * 实际时间 / 期望时间，实际时间被限制在期望时间的1/4到4倍之间，
+ * 新目标不能超过难度目标的上限
+ */
+func CalcNextBits(lastBits uint32, actualTimespan int64, targetTimespan int64) uint32 {
+	minTimespan := targetTimespan / MAXADJUSTFACTOR
+	maxTimespan := targetTimespan * MAXADJUSTFACTOR
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	}
+	if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+	newTarget := CompactToBig(lastBits)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+	if newTarget.Cmp(POWLIMIT) > 0 {
+		newTarget.Set(POWLIMIT)
+	}
+	return BigToCompact(newTarget)
+}
+
+/**
+ * 计算难度目标为bits的区块的工作量：2^256 / (目标值 + 1)，目标值越小工作量越大
+ * 没有难度目标的共识(如PoA)每个区块的工作量为1，即最长链
+ */
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(1)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
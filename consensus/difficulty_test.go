@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"math/big"
+	"testing"
+)
+
+/**
+ * 测试用的区块，只有难度计算和验证封装数据需要的字段
+ */
+type testBlock struct {
+	height    int64
+	timeStamp int64
+	bits      uint32
+	hash      [32]byte
+	prevHash  [32]byte
+	extra     []byte
+}
+
+func (block testBlock) GetHeight() int64        { return block.height }
+func (block testBlock) GetVersion() int64       { return 0 }
+func (block testBlock) GetTimeStamp() int64     { return block.timeStamp }
+func (block testBlock) GetPrevHash() [32]byte   { return block.prevHash }
+func (block testBlock) GetMerkleRoot() [32]byte { return [32]byte{} }
+func (block testBlock) GetBits() uint32         { return block.bits }
+func (block testBlock) GetHash() [32]byte       { return block.hash }
+func (block testBlock) GetNonce() int64         { return 0 }
+func (block testBlock) GetExtra() []byte        { return block.extra }
+
+type testChain map[[32]byte]BlockInterface
+
+func (chain testChain) GetBlockByHash(hash [32]byte) (BlockInterface, error) {
+	return chain[hash], nil
+}
+
+/**
+ * 按照timeStamps依次生成从创世区块开始的区块，返回区块链和最后一个区块
+ */
+func newTestChain(bits uint32, timeStamps []int64) (testChain, BlockInterface) {
+	chain := make(testChain)
+	var last testBlock
+	for height, timeStamp := range timeStamps {
+		block := testBlock{
+			height:    int64(height),
+			timeStamp: timeStamp,
+			bits:      bits,
+			hash:      [32]byte{byte(height + 1)},
+		}
+		if height > 0 {
+			block.prevHash = last.hash
+		}
+		chain[block.hash] = block
+		last = block
+	}
+	return chain, last
+}
+
+/**
+ * 计算bits表示的难度目标乘以num/den之后的紧凑格式
+ */
+func scaleBits(bits uint32, num int64, den int64) uint32 {
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(num))
+	target.Div(target, big.NewInt(den))
+	return BigToCompact(target)
+}
+
+func TestCalcNextBits(t *testing.T) {
+	const bits = 0x1d00ffff
+	tests := []struct {
+		name   string
+		actual int64
+		expect uint32
+	}{
+		{"实际时间等于期望时间", 600, bits},
+		{"出块变慢难度降低", 1200, 0x1d01fffe},
+		{"出块变快难度升高", 300, 0x1c7fff80},
+		{"出块过慢最多降低为1/4", 600 * 100, 0x1d03fffc},
+		{"恰好4倍", 2400, 0x1d03fffc},
+		{"出块过快最多升高4倍", 1, 0x1c3fffc0},
+		{"恰好1/4", 150, 0x1c3fffc0},
+		{"实际时间为负数", -600, 0x1c3fffc0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := CalcNextBits(bits, test.actual, 600)
+			if result != test.expect {
+				t.Fatalf("期望难度目标为%08x，实际为%08x", test.expect, result)
+			}
+		})
+	}
+	//难度目标不能超过上限
+	result := CalcNextBits(INITBITS, 2400, 600)
+	if result != INITBITS {
+		t.Fatalf("难度目标超过了上限：%08x", result)
+	}
+}
+
+func TestCalcTarget(t *testing.T) {
+	const bits = 0x1d00ffff
+	engine := &PoWEngine{TargetBlockTime: 10, RetargetInterval: 5}
+	//调整周期内的5个区块之间有4个间隔，期望花费40秒，实际时间限制在10秒到160秒之间
+	tests := []struct {
+		name       string
+		timeStamps []int64
+		expect     uint32
+	}{
+		{"按时出块", []int64{1000, 1010, 1020, 1030, 1040}, bits},
+		{"出块变快", []int64{1000, 1005, 1010, 1015, 1020}, scaleBits(bits, 20, 40)},
+		{"出块变慢", []int64{1000, 1020, 1040, 1060, 1080}, scaleBits(bits, 80, 40)},
+		{"出块过快最多升高4倍", []int64{1000, 1001, 1001, 1002, 1002}, scaleBits(bits, 1, 4)},
+		{"出块过慢最多降低为1/4", []int64{1000, 1100, 1200, 1300, 1400}, scaleBits(bits, 4, 1)},
+		{"时间戳倒退", []int64{1000, 1010, 990, 950, 900}, scaleBits(bits, 1, 4)},
+		{"未到调整高度", []int64{1000, 1001, 1002}, bits},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, parent := newTestChain(bits, test.timeStamps)
+			result, err := engine.CalcTarget(chain, parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.expect {
+				t.Fatalf("期望难度目标为%08x，实际为%08x", test.expect, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package consensus
+
+import (
+	"XianfengChain04/config"
+	"context"
+)
+
+const INSTANT = "instant"
+
+/**
+ * 即时共识引擎：不需要任何计算就可以封装区块，只用于测试
+ */
+type InstantEngine struct{}
+
+func init() {
+	Register(INSTANT, func(cfg *config.Config) (Consensus, error) {
+		return InstantEngine{}, nil
+	})
+}
+
+/**
+ * 直接计算nonce为0时的区块hash
+ */
+func (engine InstantEngine) Seal(ctx context.Context, chain ChainReader, block BlockInterface) (SealResult, error) {
+	return SealResult{
+		Hash:      CalculateHash(block, 0),
+		TimeStamp: block.GetTimeStamp(),
+	}, nil
+}
+
+/**
+ * 只验证区块hash与区块头一致，Extra不参与区块hash的计算，必须为空
+ */
+func (engine InstantEngine) VerifySeal(chain ChainReader, block BlockInterface) error {
+	if len(block.GetExtra()) != 0 {
+		return ErrUnexpectedExtra
+	}
+	if CalculateHash(block, block.GetNonce()) != block.GetHash() {
+		return ErrInvalidSeal
+	}
+	return nil
+}
+
+/**
+ * 即时共识没有难度目标
+ */
+func (engine InstantEngine) CalcTarget(chain ChainReader, parent BlockInterface) (uint32, error) {
+	return 0, nil
+}
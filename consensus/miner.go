@@ -0,0 +1,184 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrMiningAborted = errors.New("挖矿被取消")
+
+//每个工作协程每计算多少次hash检查一次是否被取消，并累计一次hash次数
+const CHECKINTERVAL = 1 << 12
+
+/**
+ * 挖矿的结果：找到的区块hash、nonce以及对应的时间戳(nonce用尽时时间戳会被调整)，
+ * 以及本次挖矿总共计算的hash次数和花费的时间
+ */
+type MineResult struct {
+	Hash      [32]byte
+	Nonce     int64
+	TimeStamp int64
+	Hashes    uint64
+	Elapsed   time.Duration
+}
+
+/**
+ * 计算本次挖矿的算力，单位为每秒计算的hash次数
+ */
+func (result MineResult) HashRate() float64 {
+	return HashRate(result.Hashes, result.Elapsed)
+}
+
+func HashRate(hashes uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(hashes) / elapsed.Seconds()
+}
+
+/**
+ * 多核的PoW矿工：nonce空间按照工作协程的序号交错划分，每个工作协程计算 序号、序号+Workers、...
+ * 某个工作协程的nonce用尽时，将时间戳加1后从头开始
+ */
+type Miner struct {
+	Workers        int           //工作协程的数量
+	MaxNonce       int64         //nonce的最大值
+	ReportInterval time.Duration //汇报算力的时间间隔
+	//汇报算力的回调函数，挖矿过程中每隔ReportInterval调用一次，挖矿结束时再调用一次
+	Report func(hashes uint64, elapsed time.Duration)
+}
+
+/**
+ * PoW默认使用的矿工，工作协程的数量为CPU的核数
+ */
+var DefaultMiner = NewMiner()
+
+func NewMiner() *Miner {
+	return &Miner{
+		Workers:        runtime.NumCPU(),
+		MaxNonce:       math.MaxInt64,
+		ReportInterval: 2 * time.Second,
+	}
+}
+
+/**
+ * 为区块寻找满足hash小于target的nonce，ctx被取消时停止挖矿并返回ErrMiningAborted
+ */
+func (miner *Miner) Mine(ctx context.Context, block BlockInterface, target *big.Int) (MineResult, error) {
+	if target.Sign() <= 0 {
+		return MineResult{}, errors.New("难度目标无效")
+	}
+	workers := miner.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	//hash小于target即可，target的字节表示用于直接与hash比较
+	var targetBytes [32]byte
+	target.FillBytes(targetBytes[:])
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	var hashes uint64
+	found := make(chan MineResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			miner.work(ctx, block, targetBytes, int64(index), int64(workers), &hashes, found)
+		}(i)
+	}
+	//所有工作协程退出后关闭通道
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var ticker <-chan time.Time
+	if miner.Report != nil && miner.ReportInterval > 0 {
+		reportTicker := time.NewTicker(miner.ReportInterval)
+		defer reportTicker.Stop()
+		ticker = reportTicker.C
+	}
+	finish := func(result MineResult) MineResult {
+		result.Hashes = atomic.LoadUint64(&hashes)
+		result.Elapsed = time.Since(start)
+		miner.report(result.Hashes, result.Elapsed)
+		return result
+	}
+	for {
+		select {
+		case result := <-found:
+			cancel()
+			<-done
+			return finish(result), nil
+		case <-done:
+			//工作协程全部退出，没有找到结果说明挖矿被取消
+			select {
+			case result := <-found:
+				return finish(result), nil
+			default:
+			}
+			finish(MineResult{})
+			return MineResult{}, ErrMiningAborted
+		case <-ticker:
+			miner.report(atomic.LoadUint64(&hashes), time.Since(start))
+		}
+	}
+}
+
+func (miner *Miner) report(hashes uint64, elapsed time.Duration) {
+	if miner.Report != nil {
+		miner.Report(hashes, elapsed)
+	}
+}
+
+/**
+ * 工作协程：区块头除nonce外的部分预先编码好，每次只需要改写最后8个字节的nonce
+ */
+func (miner *Miner) work(ctx context.Context, block BlockInterface, target [32]byte, first int64, step int64, hashes *uint64, found chan<- MineResult) {
+	timeStamp := block.GetTimeStamp()
+	header := append(HeaderPrefix(block, timeStamp), make([]byte, 8)...)
+	nonceBytes := header[len(header)-8:]
+	nonce := first
+	var count uint64
+	for {
+		binary.BigEndian.PutUint64(nonceBytes, uint64(nonce))
+		hash := sha256.Sum256(header)
+		if bytes.Compare(hash[:], target[:]) < 0 {
+			atomic.AddUint64(hashes, count+1)
+			found <- MineResult{Hash: hash, Nonce: nonce, TimeStamp: timeStamp}
+			return
+		}
+		count++
+		if count == CHECKINTERVAL {
+			atomic.AddUint64(hashes, count)
+			count = 0
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+		//nonce用尽时调整时间戳，重新生成区块头
+		if nonce > miner.MaxNonce-step {
+			timeStamp++
+			header = append(HeaderPrefix(block, timeStamp), make([]byte, 8)...)
+			nonceBytes = header[len(header)-8:]
+			nonce = first
+			continue
+		}
+		nonce += step
+	}
+}
@@ -0,0 +1,503 @@
+package consensus
+
+import (
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/config"
+	"XianfengChain04/utils"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const POA = "poa"
+
+//区块的时间戳最多可以超前于当前时间多少秒
+const MAXFUTUREBLOCKTIME = 15
+
+var (
+	ErrUnauthorizedSigner  = errors.New("区块的签名者不在签名者集合中")
+	ErrRecentlySigned      = errors.New("签名者最近已经签名过区块，需要等待其他签名者")
+	ErrInvalidPoASignature = errors.New("区块的签名验证失败")
+	ErrBlockPeriod         = errors.New("区块的时间戳不满足最小出块间隔")
+	ErrFutureBlock         = errors.New("区块的时间戳超前于当前时间")
+	ErrInvalidExtra        = errors.New("区块的Extra数据格式不正确")
+	ErrNotAuthorized       = errors.New("本节点没有配置签名者的私钥，不能签名区块")
+)
+
+/**
+ * 区块中的投票类型
+ */
+const (
+	VOTENONE   = 0x00 //不投票
+	VOTEADD    = 0x01 //添加签名者
+	VOTEREMOVE = 0x02 //移除签名者
+)
+
+/**
+ * PoA区块头中的Extra数据：签名者公钥、投票以及签名者对区块头的签名
+ * 编码格式：签名者公钥长度(4字节) | 签名者公钥 | 投票类型(1字节) | 投票对象公钥长度(4字节) | 投票对象公钥 | 签名长度(4字节) | 签名
+ */
+type poaExtra struct {
+	Signer    []byte
+	Vote      uint8
+	Candidate []byte
+	Signature []byte
+}
+
+func (extra poaExtra) encode(withSignature bool) []byte {
+	buff := new(bytes.Buffer)
+	utils.WriteVarBytes(buff, extra.Signer)
+	utils.WriteUint8(buff, extra.Vote)
+	utils.WriteVarBytes(buff, extra.Candidate)
+	if withSignature {
+		utils.WriteVarBytes(buff, extra.Signature)
+	} else {
+		utils.WriteVarBytes(buff, nil)
+	}
+	return buff.Bytes()
+}
+
+func decodePoAExtra(data []byte) (poaExtra, error) {
+	var extra poaExtra
+	reader := bytes.NewReader(data)
+	var err error
+	extra.Signer, err = utils.ReadVarBytes(reader)
+	if err != nil {
+		return extra, ErrInvalidExtra
+	}
+	extra.Vote, err = utils.ReadUint8(reader)
+	if err != nil || extra.Vote > VOTEREMOVE {
+		return extra, ErrInvalidExtra
+	}
+	extra.Candidate, err = utils.ReadVarBytes(reader)
+	if err != nil {
+		return extra, ErrInvalidExtra
+	}
+	extra.Signature, err = utils.ReadVarBytes(reader)
+	if err != nil || reader.Len() != 0 {
+		return extra, ErrInvalidExtra
+	}
+	return extra, nil
+}
+
+/**
+ * PoA区块头的hash：区块头(nonce固定为0)拼接Extra数据
+ * Extra中不包含签名时得到的是签名者需要签名的hash，包含签名时得到的是区块hash
+ */
+func poaHeaderHash(block BlockInterface, timeStamp int64, extra []byte) [32]byte {
+	nonceByte, _ := utils.Int2Byte(0)
+	header := append(HeaderPrefix(block, timeStamp), nonceByte...)
+	return sha256.Sum256(append(header, extra...))
+}
+
+/**
+ * 某个区块之后的签名者集合和投票状态
+ */
+type Snapshot struct {
+	Signers map[string]bool            //签名者公钥(十六进制)
+	Recents map[int64]string           //最近的区块高度 -> 签名者
+	Votes   map[string]map[string]bool //投票对象 -> 投票的签名者 -> true为添加，false为移除
+}
+
+/**
+ * 由十六进制的签名者公钥创建快照，公钥统一转换为小写，与区块中签名者公钥的编码保持一致
+ */
+func newSnapshot(signers []string) (*Snapshot, error) {
+	snap := &Snapshot{
+		Signers: make(map[string]bool),
+		Recents: make(map[int64]string),
+		Votes:   make(map[string]map[string]bool),
+	}
+	for _, signer := range signers {
+		signerBytes, err := hex.DecodeString(signer)
+		if err != nil || len(signerBytes) == 0 {
+			return nil, errors.New("签名者公钥格式不正确：" + signer)
+		}
+		snap.Signers[hex.EncodeToString(signerBytes)] = true
+	}
+	return snap, nil
+}
+
+func (snap *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		Signers: make(map[string]bool),
+		Recents: make(map[int64]string),
+		Votes:   make(map[string]map[string]bool),
+	}
+	for signer := range snap.Signers {
+		cpy.Signers[signer] = true
+	}
+	for height, signer := range snap.Recents {
+		cpy.Recents[height] = signer
+	}
+	for candidate, votes := range snap.Votes {
+		cpy.Votes[candidate] = make(map[string]bool)
+		for voter, authorize := range votes {
+			cpy.Votes[candidate][voter] = authorize
+		}
+	}
+	return cpy
+}
+
+/**
+ * 按照公钥排序的签名者列表，签名者按照该顺序轮流签名区块
+ */
+func (snap *Snapshot) SignerList() []string {
+	signers := make([]string, 0)
+	for signer := range snap.Signers {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+	return signers
+}
+
+/**
+ * 判断高度为height的区块是否轮到signer签名
+ */
+func (snap *Snapshot) InTurn(height int64, signer string) bool {
+	signers := snap.SignerList()
+	if len(signers) == 0 {
+		return false
+	}
+	return signers[height%int64(len(signers))] == signer
+}
+
+/**
+ * 签名者在最近的 签名者数量/2+1 个区块中只能签名一个区块，防止单个签名者控制区块链
+ */
+func (snap *Snapshot) recentlySigned(height int64, signer string) bool {
+	limit := int64(len(snap.Signers)/2 + 1)
+	for recentHeight, recentSigner := range snap.Recents {
+		if recentSigner == signer && height-recentHeight < limit {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * 应用高度为height的区块：检查签名者，记录最近的签名者，统计投票，
+ * 某个投票对象得到超过半数签名者的相同投票时，添加或移除该签名者
+ */
+func (snap *Snapshot) apply(height int64, extra poaExtra) error {
+	signer := hex.EncodeToString(extra.Signer)
+	if !snap.Signers[signer] {
+		return ErrUnauthorizedSigner
+	}
+	if snap.recentlySigned(height, signer) {
+		return ErrRecentlySigned
+	}
+	limit := int64(len(snap.Signers)/2 + 1)
+	for recentHeight := range snap.Recents {
+		if height-recentHeight >= limit {
+			delete(snap.Recents, recentHeight)
+		}
+	}
+	snap.Recents[height] = signer
+
+	if extra.Vote == VOTENONE {
+		return nil
+	}
+	candidate := hex.EncodeToString(extra.Candidate)
+	authorize := extra.Vote == VOTEADD
+	//添加已经是签名者的公钥、移除不是签名者的公钥的投票无效，忽略
+	if snap.Signers[candidate] == authorize {
+		return nil
+	}
+	if snap.Votes[candidate] == nil {
+		snap.Votes[candidate] = make(map[string]bool)
+	}
+	snap.Votes[candidate][signer] = authorize
+	var count int
+	for _, vote := range snap.Votes[candidate] {
+		if vote == authorize {
+			count++
+		}
+	}
+	if count <= len(snap.Signers)/2 {
+		return nil
+	}
+	//投票通过
+	delete(snap.Votes, candidate)
+	if authorize {
+		snap.Signers[candidate] = true
+		return nil
+	}
+	delete(snap.Signers, candidate)
+	for _, votes := range snap.Votes {
+		delete(votes, candidate)
+	}
+	for recentHeight, recentSigner := range snap.Recents {
+		if recentSigner == candidate {
+			delete(snap.Recents, recentHeight)
+		}
+	}
+	return nil
+}
+
+/**
+ * 权威证明共识引擎：签名者集合中的签名者按顺序轮流使用私钥签名区块
+ * 轮到的签名者在前一个区块Period秒之后可以签名，其他签名者需要再多等待Period秒
+ * 签名者可以在区块中投票添加或移除签名者，超过半数签名者同意时生效
+ */
+type PoAEngine struct {
+	Period     int64
+	signers    []string        //初始的签名者集合
+	votes      map[string]bool //本节点的投票
+	signerPriv *ecdsa.PrivateKey
+	signerPub  []byte
+
+	mutex     sync.Mutex
+	snapshots map[[32]byte]*Snapshot //区块hash -> 应用该区块之后的快照
+}
+
+func init() {
+	Register(POA, func(cfg *config.Config) (Consensus, error) {
+		if len(cfg.PoA.Signers) == 0 {
+			return nil, errors.New("PoA共识至少需要配置一个签名者")
+		}
+		initial, err := newSnapshot(cfg.PoA.Signers)
+		if err != nil {
+			return nil, err
+		}
+		//投票对象的公钥同样转换为小写，与快照中的签名者比较
+		votes := make(map[string]bool)
+		for candidate, authorize := range cfg.PoA.Votes {
+			candidateBytes, err := hex.DecodeString(candidate)
+			if err != nil || len(candidateBytes) == 0 {
+				return nil, errors.New("投票对象公钥格式不正确：" + candidate)
+			}
+			votes[hex.EncodeToString(candidateBytes)] = authorize
+		}
+		return &PoAEngine{
+			Period:    cfg.PoA.Period,
+			signers:   initial.SignerList(),
+			votes:     votes,
+			snapshots: make(map[[32]byte]*Snapshot),
+		}, nil
+	})
+}
+
+/**
+ * 设置本节点用于签名区块的私钥，priv为nil时收回授权
+ */
+func (engine *PoAEngine) Authorize(priv *ecdsa.PrivateKey, pub []byte) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.signerPriv = priv
+	engine.signerPub = pub
+}
+
+/**
+ * 获取parent之后的签名者集合和投票状态，parent为nil时为初始的签名者集合
+ */
+func (engine *PoAEngine) Snapshot(chain ChainReader, parent BlockInterface) (*Snapshot, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	//1、从parent往前找到已经计算过快照的区块或者创世区块
+	headers := make([]BlockInterface, 0)
+	snap, err := newSnapshot(engine.signers)
+	if err != nil {
+		return nil, err
+	}
+	current := parent
+	for current != nil {
+		if cached, ok := engine.snapshots[current.GetHash()]; ok {
+			snap = cached.copy()
+			break
+		}
+		headers = append(headers, current)
+		if current.GetHeight() == 0 {
+			break
+		}
+		prev, err := chain.GetBlockByHash(current.GetPrevHash())
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			return nil, errors.New("找不到前一个区块，无法计算签名者集合")
+		}
+		current = prev
+	}
+	//2、从前往后依次应用区块
+	for i := len(headers) - 1; i >= 0; i-- {
+		extra, err := decodePoAExtra(headers[i].GetExtra())
+		if err != nil {
+			return nil, err
+		}
+		err = snap.apply(headers[i].GetHeight(), extra)
+		if err != nil {
+			return nil, err
+		}
+		engine.snapshots[headers[i].GetHash()] = snap.copy()
+	}
+	return snap, nil
+}
+
+func (engine *PoAEngine) parent(chain ChainReader, block BlockInterface) (BlockInterface, error) {
+	if block.GetHeight() == 0 {
+		return nil, nil
+	}
+	parent, err := chain.GetBlockByHash(block.GetPrevHash())
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, errors.New("找不到前一个区块")
+	}
+	return parent, nil
+}
+
+/**
+ * 区块最早可以使用的时间戳：轮到的签名者为前一个区块之后Period秒，其他签名者为2*Period秒
+ */
+func (engine *PoAEngine) earliestTime(parent BlockInterface, inTurn bool) int64 {
+	if parent == nil {
+		return 0
+	}
+	if inTurn {
+		return parent.GetTimeStamp() + engine.Period
+	}
+	return parent.GetTimeStamp() + 2*engine.Period
+}
+
+/**
+ * 选择本节点的一个投票：添加还不是签名者的公钥，或者移除已经是签名者的公钥
+ */
+func (engine *PoAEngine) chooseVote(snap *Snapshot, signer string) (uint8, []byte) {
+	candidates := make([]string, 0)
+	for candidate := range engine.votes {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		authorize := engine.votes[candidate]
+		if snap.Signers[candidate] == authorize {
+			continue
+		}
+		//已经投过相同的票
+		if vote, ok := snap.Votes[candidate][signer]; ok && vote == authorize {
+			continue
+		}
+		candidateBytes, _ := hex.DecodeString(candidate)
+		if authorize {
+			return VOTEADD, candidateBytes
+		}
+		return VOTEREMOVE, candidateBytes
+	}
+	return VOTENONE, nil
+}
+
+/**
+ * 使用本节点的私钥签名区块，没有到可以签名的时间时等待，ctx被取消时停止
+ */
+func (engine *PoAEngine) Seal(ctx context.Context, chain ChainReader, block BlockInterface) (SealResult, error) {
+	//钱包可能随时被锁定，使用开始签名时的私钥
+	engine.mutex.Lock()
+	signerPriv, signerPub := engine.signerPriv, engine.signerPub
+	engine.mutex.Unlock()
+	if signerPriv == nil {
+		return SealResult{}, ErrNotAuthorized
+	}
+	parent, err := engine.parent(chain, block)
+	if err != nil {
+		return SealResult{}, err
+	}
+	snap, err := engine.Snapshot(chain, parent)
+	if err != nil {
+		return SealResult{}, err
+	}
+	signer := hex.EncodeToString(signerPub)
+	if !snap.Signers[signer] {
+		return SealResult{}, ErrUnauthorizedSigner
+	}
+	if snap.recentlySigned(block.GetHeight(), signer) {
+		return SealResult{}, ErrRecentlySigned
+	}
+
+	//1、等待到可以签名的时间
+	timeStamp := block.GetTimeStamp()
+	earliest := engine.earliestTime(parent, snap.InTurn(block.GetHeight(), signer))
+	if timeStamp < earliest {
+		timeStamp = earliest
+	}
+	wait := time.Until(time.Unix(timeStamp, 0))
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return SealResult{}, ErrMiningAborted
+		case <-timer.C:
+		}
+	}
+
+	//2、投票并签名
+	extra := poaExtra{Signer: signerPub}
+	extra.Vote, extra.Candidate = engine.chooseVote(snap, signer)
+	sigHash := poaHeaderHash(block, timeStamp, extra.encode(false))
+	extra.Signature, err = chaincrypto.Sign(signerPriv, sigHash[:])
+	if err != nil {
+		return SealResult{}, err
+	}
+	extraBytes := extra.encode(true)
+	return SealResult{
+		Hash:      poaHeaderHash(block, timeStamp, extraBytes),
+		TimeStamp: timeStamp,
+		Extra:     extraBytes,
+	}, nil
+}
+
+/**
+ * 验证区块的签名、签名者是否有权签名以及区块的时间戳
+ */
+func (engine *PoAEngine) VerifySeal(chain ChainReader, block BlockInterface) error {
+	//1、区块hash和签名
+	if block.GetNonce() != 0 {
+		return ErrInvalidSeal
+	}
+	extra, err := decodePoAExtra(block.GetExtra())
+	if err != nil {
+		return err
+	}
+	if poaHeaderHash(block, block.GetTimeStamp(), block.GetExtra()) != block.GetHash() {
+		return ErrInvalidSeal
+	}
+	sigHash := poaHeaderHash(block, block.GetTimeStamp(), extra.encode(false))
+	if !chaincrypto.Verify(extra.Signer, sigHash[:], extra.Signature) {
+		return ErrInvalidPoASignature
+	}
+
+	//2、时间戳：满足最小出块间隔，并且不能超前于当前时间太多
+	parent, err := engine.parent(chain, block)
+	if err != nil {
+		return err
+	}
+	snap, err := engine.Snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+	signer := hex.EncodeToString(extra.Signer)
+	if block.GetTimeStamp() < engine.earliestTime(parent, snap.InTurn(block.GetHeight(), signer)) {
+		return ErrBlockPeriod
+	}
+	if block.GetTimeStamp() > time.Now().Unix()+MAXFUTUREBLOCKTIME {
+		return ErrFutureBlock
+	}
+
+	//3、签名者必须在签名者集合中，并且最近没有签名过区块
+	return snap.copy().apply(block.GetHeight(), extra)
+}
+
+/**
+ * PoA共识没有难度目标
+ */
+func (engine *PoAEngine) CalcTarget(chain ChainReader, parent BlockInterface) (uint32, error) {
+	return 0, nil
+}
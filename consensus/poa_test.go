@@ -0,0 +1,295 @@
+package consensus
+
+import (
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/config"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testPeriod = 5
+
+/**
+ * 测试用的签名者：私钥、公钥以及十六进制的公钥
+ */
+type testSigner struct {
+	priv *ecdsa.PrivateKey
+	pub  []byte
+	hex  string
+}
+
+/**
+ * 生成n个签名者，按照公钥排序，与签名者轮流签名的顺序一致
+ */
+func newTestSigners(t *testing.T, n int) []testSigner {
+	signers := make([]testSigner, 0)
+	for i := 0; i < n; i++ {
+		priv, err := chaincrypto.NewPriKey(chaincrypto.S256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := chaincrypto.GetPub(priv)
+		signers = append(signers, testSigner{priv: priv, pub: pub, hex: hex.EncodeToString(pub)})
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return signers[i].hex < signers[j].hex
+	})
+	return signers
+}
+
+func newTestPoAEngine(t *testing.T, signers []testSigner, votes map[string]bool) *PoAEngine {
+	cfg := config.DefaultConfig()
+	cfg.PoA.Period = testPeriod
+	cfg.PoA.Votes = votes
+	for _, signer := range signers {
+		cfg.PoA.Signers = append(cfg.PoA.Signers, signer.hex)
+	}
+	engine, err := NewEngine(POA, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine.(*PoAEngine)
+}
+
+/**
+ * 由signer直接签名parent之后的区块，不经过Seal对时间戳的调整，parent为nil时生成创世区块
+ */
+func signTestBlock(t *testing.T, parent *testBlock, timeStamp int64, signer testSigner, vote uint8, candidate []byte) testBlock {
+	block := testBlock{timeStamp: timeStamp}
+	if parent != nil {
+		block.height = parent.height + 1
+		block.prevHash = parent.hash
+	}
+	extra := poaExtra{Signer: signer.pub, Vote: vote, Candidate: candidate}
+	sigHash := poaHeaderHash(block, timeStamp, extra.encode(false))
+	var err error
+	extra.Signature, err = chaincrypto.Sign(signer.priv, sigHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.extra = extra.encode(true)
+	block.hash = poaHeaderHash(block, timeStamp, block.extra)
+	return block
+}
+
+/**
+ * 验证区块并添加到测试链中
+ */
+func addTestBlock(t *testing.T, engine *PoAEngine, chain testChain, block testBlock) {
+	err := engine.VerifySeal(chain, block)
+	if err != nil {
+		t.Fatalf("高度为%d的区块验证失败：%v", block.height, err)
+	}
+	chain[block.hash] = block
+}
+
+func TestNewPoAEngineSigners(t *testing.T) {
+	cfg := config.DefaultConfig()
+	//大写的十六进制公钥转换为小写，与区块中签名者公钥的编码一致
+	cfg.PoA.Signers = []string{"02AB", "03cd"}
+	cfg.PoA.Votes = map[string]bool{"04EF": true}
+	engine, err := NewEngine(POA, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poa := engine.(*PoAEngine)
+	if !reflect.DeepEqual(poa.signers, []string{"02ab", "03cd"}) {
+		t.Fatalf("签名者公钥没有转换为小写：%v", poa.signers)
+	}
+	if !reflect.DeepEqual(poa.votes, map[string]bool{"04ef": true}) {
+		t.Fatalf("投票对象公钥没有转换为小写：%v", poa.votes)
+	}
+
+	for _, signers := range [][]string{{"02ab", "xyz"}, {"02a"}, {""}} {
+		cfg.PoA.Signers = signers
+		_, err = NewEngine(POA, cfg)
+		if err == nil {
+			t.Fatalf("签名者公钥%v格式不正确时应该返回错误", signers)
+		}
+	}
+	cfg.PoA.Signers = []string{"02ab"}
+	cfg.PoA.Votes = map[string]bool{"zz": true}
+	_, err = NewEngine(POA, cfg)
+	if err == nil {
+		t.Fatal("投票对象公钥格式不正确时应该返回错误")
+	}
+}
+
+func TestPoAInTurnDelay(t *testing.T) {
+	signers := newTestSigners(t, 3)
+	engine := newTestPoAEngine(t, signers, nil)
+	chain := make(testChain)
+	genesis := signTestBlock(t, nil, 1000, signers[0], VOTENONE, nil)
+	addTestBlock(t, engine, chain, genesis)
+
+	//高度1轮到signers[1]，前一个区块Period秒之后就可以签名
+	inTurn := signTestBlock(t, &genesis, genesis.timeStamp+testPeriod, signers[1], VOTENONE, nil)
+	addTestBlock(t, engine, chain, inTurn)
+
+	//其他签名者需要等待2*Period秒
+	outOfTurn := signTestBlock(t, &genesis, genesis.timeStamp+testPeriod, signers[2], VOTENONE, nil)
+	err := engine.VerifySeal(chain, outOfTurn)
+	if err != ErrBlockPeriod {
+		t.Fatalf("期望返回%v，实际返回%v", ErrBlockPeriod, err)
+	}
+	outOfTurn = signTestBlock(t, &genesis, genesis.timeStamp+2*testPeriod, signers[2], VOTENONE, nil)
+	addTestBlock(t, engine, chain, outOfTurn)
+
+	//Seal自动将时间戳推迟到可以签名的最早时间
+	tests := []struct {
+		name   string
+		signer testSigner
+		expect int64
+	}{
+		{"轮到的签名者", signers[1], genesis.timeStamp + testPeriod},
+		{"没有轮到的签名者", signers[2], genesis.timeStamp + 2*testPeriod},
+	}
+	for _, test := range tests {
+		engine.Authorize(test.signer.priv, test.signer.pub)
+		block := testBlock{height: 1, timeStamp: genesis.timeStamp, prevHash: genesis.hash}
+		result, err := engine.Seal(context.Background(), chain, block)
+		if err != nil {
+			t.Fatalf("%s签名区块失败：%v", test.name, err)
+		}
+		if result.TimeStamp != test.expect {
+			t.Fatalf("%s签名的区块时间戳期望为%d，实际为%d", test.name, test.expect, result.TimeStamp)
+		}
+		block.timeStamp, block.hash, block.extra = result.TimeStamp, result.Hash, result.Extra
+		addTestBlock(t, engine, chain, block)
+	}
+}
+
+func TestPoARecentlySigned(t *testing.T) {
+	//3个签名者时，每个签名者在最近的2个区块中只能签名一个
+	signers := newTestSigners(t, 3)
+	engine := newTestPoAEngine(t, signers, nil)
+	chain := make(testChain)
+	genesis := signTestBlock(t, nil, 1000, signers[0], VOTENONE, nil)
+	addTestBlock(t, engine, chain, genesis)
+
+	again := signTestBlock(t, &genesis, genesis.timeStamp+2*testPeriod, signers[0], VOTENONE, nil)
+	err := engine.VerifySeal(chain, again)
+	if err != ErrRecentlySigned {
+		t.Fatalf("期望返回%v，实际返回%v", ErrRecentlySigned, err)
+	}
+	engine.Authorize(signers[0].priv, signers[0].pub)
+	_, err = engine.Seal(context.Background(), chain, testBlock{height: 1, timeStamp: 1000, prevHash: genesis.hash})
+	if err != ErrRecentlySigned {
+		t.Fatalf("期望返回%v，实际返回%v", ErrRecentlySigned, err)
+	}
+
+	block1 := signTestBlock(t, &genesis, genesis.timeStamp+testPeriod, signers[1], VOTENONE, nil)
+	addTestBlock(t, engine, chain, block1)
+	//间隔一个区块之后可以再次签名
+	block2 := signTestBlock(t, &block1, block1.timeStamp+2*testPeriod, signers[0], VOTENONE, nil)
+	addTestBlock(t, engine, chain, block2)
+
+	//4个签名者时，每个签名者在最近的3个区块中只能签名一个
+	snap, err := newSnapshot([]string{"01", "02", "03", "04"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Recents[10] = "01"
+	for height, expect := range map[int64]bool{11: true, 12: true, 13: false} {
+		if snap.recentlySigned(height, "01") != expect {
+			t.Fatalf("高度为%d时签名者最近是否签名过区块期望为%v", height, expect)
+		}
+	}
+}
+
+func TestPoAVoting(t *testing.T) {
+	signers := newTestSigners(t, 4)
+	//signers[3]作为投票对象，初始不是签名者
+	candidate := signers[3]
+	signers = signers[:3]
+	engine := newTestPoAEngine(t, signers, nil)
+	chain := make(testChain)
+	genesis := signTestBlock(t, nil, 1000, signers[0], VOTENONE, nil)
+	addTestBlock(t, engine, chain, genesis)
+
+	//依次由voters签名区块并投票，每个区块之后期望的签名者个数为expects
+	parent := genesis
+	vote := func(voters []testSigner, kind uint8, expects []int) {
+		for i, voter := range voters {
+			block := signTestBlock(t, &parent, parent.timeStamp+2*testPeriod, voter, kind, candidate.pub)
+			addTestBlock(t, engine, chain, block)
+			parent = block
+			snap, err := engine.Snapshot(chain, block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snap.Signers) != expects[i] {
+				t.Fatalf("高度为%d的区块之后期望有%d个签名者，实际为%d", block.height, expects[i], len(snap.Signers))
+			}
+		}
+	}
+
+	//3个签名者中超过半数(2个)同意时添加签名者
+	vote([]testSigner{signers[1], signers[2]}, VOTEADD, []int{3, 4})
+	//新的签名者可以签名区块
+	block := signTestBlock(t, &parent, parent.timeStamp+2*testPeriod, candidate, VOTENONE, nil)
+	addTestBlock(t, engine, chain, block)
+	parent = block
+
+	//4个签名者中超过半数(3个)同意时移除签名者
+	vote([]testSigner{signers[0], signers[1], signers[2]}, VOTEREMOVE, []int{4, 4, 3})
+	block = signTestBlock(t, &parent, parent.timeStamp+2*testPeriod, candidate, VOTENONE, nil)
+	err := engine.VerifySeal(chain, block)
+	if err != ErrUnauthorizedSigner {
+		t.Fatalf("被移除的签名者签名区块期望返回%v，实际返回%v", ErrUnauthorizedSigner, err)
+	}
+
+	//Seal根据本节点的投票配置在区块中投票
+	engine = newTestPoAEngine(t, signers, map[string]bool{candidate.hex: true})
+	engine.Authorize(signers[1].priv, signers[1].pub)
+	result, err := engine.Seal(context.Background(), chain, testBlock{height: 1, timeStamp: 1000, prevHash: genesis.hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := decodePoAExtra(result.Extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extra.Vote != VOTEADD || hex.EncodeToString(extra.Candidate) != candidate.hex {
+		t.Fatalf("区块中的投票不正确：%d %x", extra.Vote, extra.Candidate)
+	}
+}
+
+func TestPoAUnauthorizedSigner(t *testing.T) {
+	signers := newTestSigners(t, 3)
+	outsider := signers[2]
+	signers = signers[:2]
+	engine := newTestPoAEngine(t, signers, nil)
+	chain := make(testChain)
+	genesis := signTestBlock(t, nil, 1000, signers[0], VOTENONE, nil)
+	addTestBlock(t, engine, chain, genesis)
+
+	block := signTestBlock(t, &genesis, genesis.timeStamp+2*testPeriod, outsider, VOTENONE, nil)
+	err := engine.VerifySeal(chain, block)
+	if err != ErrUnauthorizedSigner {
+		t.Fatalf("期望返回%v，实际返回%v", ErrUnauthorizedSigner, err)
+	}
+	engine.Authorize(outsider.priv, outsider.pub)
+	_, err = engine.Seal(context.Background(), chain, testBlock{height: 1, timeStamp: 1000, prevHash: genesis.hash})
+	if err != ErrUnauthorizedSigner {
+		t.Fatalf("期望返回%v，实际返回%v", ErrUnauthorizedSigner, err)
+	}
+
+	//冒用签名者的公钥，但签名不是该签名者的私钥生成的
+	forged := testSigner{priv: outsider.priv, pub: signers[1].pub}
+	block = signTestBlock(t, &genesis, genesis.timeStamp+testPeriod, forged, VOTENONE, nil)
+	err = engine.VerifySeal(chain, block)
+	if err != ErrInvalidPoASignature {
+		t.Fatalf("期望返回%v，实际返回%v", ErrInvalidPoASignature, err)
+	}
+	//未配置私钥时不能签名
+	engine.Authorize(nil, nil)
+	_, err = engine.Seal(context.Background(), chain, testBlock{height: 1, timeStamp: 1000, prevHash: genesis.hash})
+	if err != ErrNotAuthorized {
+		t.Fatalf("期望返回%v，实际返回%v", ErrNotAuthorized, err)
+	}
+}
@@ -1,9 +1,12 @@
 package consensus
 
 import (
+	"XianfengChain04/config"
 	"XianfengChain04/utils"
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"math/big"
 )
 
@@ -11,67 +14,122 @@ import (
 //1、通过结构体引用，引用block结构体，然后访问其属性，比如block.Height
 //2、接口
 
-const DIFFICULTY = 16 //难度值系数
+const DIFFICULTY = 16 //初始的难度值系数
 
+const POW = "pow"
+
+var ErrInvalidPoW = errors.New("区块的工作量证明无效")
+
+/**
+ * 工作量证明共识引擎：使用Miner寻找nonce，并根据区块时间戳定期调整难度
+ */
+type PoWEngine struct {
+	TargetBlockTime  int64 //期望的出块间隔(秒)
+	RetargetInterval int64 //每隔多少个区块调整一次难度
+	Miner            *Miner
+}
+
+func init() {
+	Register(POW, func(cfg *config.Config) (Consensus, error) {
+		return &PoWEngine{
+			TargetBlockTime:  cfg.TargetBlockTime,
+			RetargetInterval: cfg.RetargetInterval,
+			Miner:            DefaultMiner,
+		}, nil
+	})
+}
+
+/**
+ * 按照区块头中声明的难度目标寻找nonce
+ */
+func (engine *PoWEngine) Seal(ctx context.Context, chain ChainReader, block BlockInterface) (SealResult, error) {
+	result, err := engine.Miner.Mine(ctx, block, CompactToBig(block.GetBits()))
+	if err != nil {
+		return SealResult{}, err
+	}
+	return SealResult{
+		Hash:      result.Hash,
+		Nonce:     result.Nonce,
+		TimeStamp: result.TimeStamp,
+	}, nil
+}
+
+/**
+ * 验证区块的nonce满足区块头中声明的难度目标，Extra不参与工作量证明，必须为空
+ */
+func (engine *PoWEngine) VerifySeal(chain ChainReader, block BlockInterface) error {
+	if len(block.GetExtra()) != 0 {
+		return ErrUnexpectedExtra
+	}
+	if !NewPoW(block).CheckNonce(block.GetNonce(), block.GetHash()) {
+		return ErrInvalidPoW
+	}
+	return nil
+}
+
+/**
+ * 单个区块的工作量证明
+ */
 type PoW struct {
 	Block  BlockInterface
 	Target *big.Int
 }
 
-func (pow PoW) FindNonce() ([32]byte, int64) {
-	//1、给定一个nonce值，计算区块hash
-	var nonce int64
-	nonce = 0
-	//无限循环
-	hashBig := new(big.Int)
-	for {
-		hash := CalculateHash(pow.Block, nonce)
-		//2、拿到系统的目标值
-		target := pow.Target
-		//3、比较大小
-		//target big.Int
-		//hash  [32]byte
-
-		hashBig = hashBig.SetBytes(hash[:])
-		//result := bytes.Compare(hash[:], target.Bytes())
-		result := hashBig.Cmp(target)
-		//4、判断结果
-		if result == -1 {
-			return hash, nonce
-		}
-		nonce++ //否则nonce自增
+/**
+ * 根据区块头中声明的难度目标创建PoW
+ */
+func NewPoW(block BlockInterface) PoW {
+	return PoW{block, CompactToBig(block.GetBits())}
+}
+
+/**
+ * 使用DefaultMiner多核寻找nonce，ctx被取消时停止
+ * nonce用尽时区块的时间戳会被调整，调用者需要使用结果中的时间戳
+ */
+func (pow PoW) FindNonce(ctx context.Context) (MineResult, error) {
+	return DefaultMiner.Mine(ctx, pow.Block, pow.Target)
+}
+
+/**
+ * 验证区块的nonce：使用nonce重新计算的hash必须与区块的hash一致，并且小于目标值
+ */
+func (pow PoW) CheckNonce(nonce int64, hash [32]byte) bool {
+	if CalculateHash(pow.Block, nonce) != hash {
+		return false
 	}
+	hashBig := new(big.Int).SetBytes(hash[:])
+	return hashBig.Cmp(pow.Target) == -1
 }
 
 /**
- * 根据区块已有的信息和当前nonce的赋值，计算区块的hash
+ * 根据区块头的信息和当前nonce的赋值，计算区块的hash
+ * 区块头是定长的：高度、版本、前一个区块hash、默克尔根、时间戳、难度目标、nonce，交易通过默克尔根参与计算
  */
 func CalculateHash(block BlockInterface, nonce int64) [32]byte {
+	nonceByte, _ := utils.Int2Byte(nonce)
+	blockByte := append(HeaderPrefix(block, block.GetTimeStamp()), nonceByte...)
+	//计算区块的hash
+	hash := sha256.Sum256(blockByte)
+	return hash
+}
+
+/**
+ * 区块头中nonce之前的部分，挖矿时不随nonce变化，可以预先计算
+ */
+func HeaderPrefix(block BlockInterface, timeStamp int64) []byte {
 	heightByte, _ := utils.Int2Byte(block.GetHeight())
 	versionByte, _ := utils.Int2Byte(block.GetVersion())
-	timeByte, _ := utils.Int2Byte(block.GetTimeStamp())
-	nonceByte, _ := utils.Int2Byte(nonce)
+	timeByte, _ := utils.Int2Byte(timeStamp)
+	bitsByte, _ := utils.Int2Byte(int64(block.GetBits()))
 
 	prev := block.GetPrevHash()
+	merkleRoot := block.GetMerkleRoot()
 
-	txs := block.GetTransactions()
-	txsBytes := make([]byte, 0)
-	for _, tx := range txs {
-		// struct -> []byte
-		txData, err := utils.Encode(tx)
-		if err != nil {
-			break
-		}
-		txsBytes = append(txsBytes, txData...)
-	}
-	blockByte := bytes.Join([][]byte{heightByte,
+	return bytes.Join([][]byte{heightByte,
 		versionByte,
 		prev[:],
+		merkleRoot[:],
 		timeByte,
-		nonceByte,
-		txsBytes,
+		bitsByte,
 	}, []byte{})
-	//计算区块的hash
-	hash := sha256.Sum256(blockByte)
-	return hash
 }
@@ -0,0 +1,48 @@
+package consensus
+
+import (
+	"XianfengChain04/config"
+	"errors"
+	"sort"
+)
+
+/**
+ * 共识引擎的构造函数，根据节点的配置创建共识引擎
+ */
+type EngineConstructor func(cfg *config.Config) (Consensus, error)
+
+//已注册的共识引擎：名称 -> 构造函数
+var engines = make(map[string]EngineConstructor)
+
+/**
+ * 注册共识引擎，各个共识引擎在init函数中调用
+ */
+func Register(name string, constructor EngineConstructor) {
+	if _, ok := engines[name]; ok {
+		panic("共识引擎重复注册：" + name)
+	}
+	engines[name] = constructor
+}
+
+/**
+ * 根据名称创建共识引擎
+ */
+func NewEngine(name string, cfg *config.Config) (Consensus, error) {
+	constructor, ok := engines[name]
+	if !ok {
+		return nil, errors.New("不支持的共识引擎：" + name)
+	}
+	return constructor(cfg)
+}
+
+/**
+ * 获取所有已注册的共识引擎的名称
+ */
+func EngineNames() []string {
+	names := make([]string, 0)
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
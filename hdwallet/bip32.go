@@ -0,0 +1,163 @@
+package hdwallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+/**
+ * BIP32分层确定性密钥：由种子生成主密钥，主密钥按照序号逐层派生出子密钥，
+ * 同一个种子总是派生出相同的密钥树，只需要备份种子(助记词)就可以恢复所有地址
+ * BIP32只定义了secp256k1曲线，其他曲线按照SLIP-0010的规则派生
+ */
+
+/**
+ * 序号大于等于HARDENED的子密钥为强化派生，只能由父私钥派生
+ */
+const HARDENED uint32 = 0x80000000
+
+var (
+	ErrInvalidSeed      = errors.New("种子的长度必须在16到64字节之间")
+	ErrUnsupportedCurve = errors.New("不支持该椭圆曲线的分层确定性派生")
+)
+
+/**
+ * 扩展私钥：私钥和链码，链码参与子密钥的派生
+ */
+type ExtendedKey struct {
+	Curve     elliptic.Curve
+	Key       []byte //私钥，长度与曲线的阶相同
+	ChainCode []byte
+	Depth     uint8  //在密钥树中的深度，主密钥为0
+	Index     uint32 //派生该密钥使用的序号
+}
+
+/**
+ * 各条曲线生成主密钥时使用的HMAC密钥
+ */
+func curveSeedKey(curve elliptic.Curve) ([]byte, error) {
+	switch curve.Params().Name {
+	case chaincrypto.SECP256K1:
+		return []byte("Bitcoin seed"), nil
+	case chaincrypto.P256:
+		return []byte("Nist256p1 seed"), nil
+	}
+	return nil, ErrUnsupportedCurve
+}
+
+/**
+ * 由种子生成主密钥：I = HMAC-SHA512(曲线对应的密钥, seed)，左32字节为私钥，右32字节为链码
+ */
+func NewMaster(seed []byte, curve elliptic.Curve) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, ErrInvalidSeed
+	}
+	hmacKey, err := curveSeedKey(curve)
+	if err != nil {
+		return nil, err
+	}
+	data := seed
+	for {
+		i := hmacSHA512(hmacKey, data)
+		//私钥不在有效范围内时，用I重新计算(SLIP-0010)
+		if validKey(curve, i[:32]) {
+			return &ExtendedKey{
+				Curve:     curve,
+				Key:       i[:32],
+				ChainCode: i[32:],
+			}, nil
+		}
+		data = i
+	}
+}
+
+/**
+ * 派生序号为index的子密钥：
+ * 强化派生 I = HMAC-SHA512(链码, 0x00 || 父私钥 || index)
+ * 普通派生 I = HMAC-SHA512(链码, 压缩格式的父公钥 || index)
+ * 子私钥 = (I的左32字节 + 父私钥) mod n，子链码 = I的右32字节
+ */
+func (key *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if key.Depth == 255 {
+		return nil, errors.New("密钥树的深度不能超过255")
+	}
+	data := make([]byte, 0, 37)
+	if index >= HARDENED {
+		data = append(data, 0x00)
+		data = append(data, key.Key...)
+	} else {
+		data = append(data, key.PublicKey()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	n := key.Curve.Params().N
+	for {
+		i := hmacSHA512(key.ChainCode, data)
+		il := new(big.Int).SetBytes(i[:32])
+		if il.Cmp(n) < 0 {
+			k := il.Add(il, new(big.Int).SetBytes(key.Key))
+			k.Mod(k, n)
+			if k.Sign() != 0 {
+				childKey := make([]byte, 32)
+				k.FillBytes(childKey)
+				return &ExtendedKey{
+					Curve:     key.Curve,
+					Key:       childKey,
+					ChainCode: i[32:],
+					Depth:     key.Depth + 1,
+					Index:     index,
+				}, nil
+			}
+		}
+		//得到的私钥无效时，用0x01 || I的右32字节 || index重新计算(SLIP-0010)
+		data = append([]byte{0x01}, i[32:]...)
+		data = binary.BigEndian.AppendUint32(data, index)
+	}
+}
+
+/**
+ * 按照路径依次派生子密钥
+ */
+func (key *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	child := key
+	for _, index := range path {
+		var err error
+		child, err = child.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+/**
+ * 扩展密钥对应的ECDSA私钥
+ */
+func (key *ExtendedKey) PrivateKey() (*ecdsa.PrivateKey, error) {
+	return chaincrypto.PrivKeyFromBytes(key.Curve, key.Key)
+}
+
+/**
+ * 压缩格式的公钥：0x02或0x03(y的奇偶) || x
+ */
+func (key *ExtendedKey) PublicKey() []byte {
+	x, y := key.Curve.ScalarBaseMult(key.Key)
+	return elliptic.MarshalCompressed(key.Curve, x, y)
+}
+
+func validKey(curve elliptic.Curve, key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() != 0 && k.Cmp(curve.Params().N) < 0
+}
+
+func hmacSHA512(key []byte, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
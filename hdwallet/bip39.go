@@ -0,0 +1,156 @@
+package hdwallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"io"
+	"math/big"
+	"strings"
+)
+
+/**
+ * BIP39助记词：用单词表示随机熵，便于用户抄写备份，由助记词可以计算出HD钱包的种子
+ * 熵的长度为128~256位(32的倍数)，熵的SHA256的前(熵的位数/32)位作为校验和，
+ * 熵和校验和拼接后每11位对应单词表中的一个单词
+ * 目前只支持英文单词表，助记词和口令都按原样使用，没有做NFKD规范化
+ */
+
+/**
+ * 由助记词计算种子时PBKDF2的迭代次数和种子的长度
+ */
+const (
+	SEEDITERATIONS = 2048
+	SEEDLEN        = 64
+)
+
+var (
+	ErrInvalidEntropy   = errors.New("熵的长度必须是128到256之间32的倍数")
+	ErrInvalidMnemonic  = errors.New("助记词不正确：单词数量必须是12、15、18、21或24，并且每个单词都在单词表中")
+	ErrMnemonicChecksum = errors.New("助记词的校验和不正确，请检查单词的顺序和拼写")
+)
+
+// 单词 -> 在单词表中的序号
+var wordIndex = make(map[string]int)
+
+func init() {
+	for index, word := range englishWords {
+		wordIndex[word] = index
+	}
+}
+
+/**
+ * 生成bits位的随机熵
+ */
+func NewEntropy(bits int) ([]byte, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return nil, ErrInvalidEntropy
+	}
+	entropy := make([]byte, bits/8)
+	_, err := io.ReadFull(rand.Reader, entropy)
+	if err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+/**
+ * 根据熵生成助记词，单词之间用空格分隔
+ */
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", ErrInvalidEntropy
+	}
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+	//熵后面拼接上校验和
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumBits))
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	//从低位开始每11位取出一个单词
+	wordCount := (bits + checksumBits) / 11
+	words := make([]string, wordCount)
+	mask := big.NewInt(2047)
+	index := new(big.Int)
+	for i := wordCount - 1; i >= 0; i-- {
+		index.And(data, mask)
+		words[i] = englishWords[index.Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+/**
+ * 生成一个新的助记词，bits为熵的位数
+ */
+func GenerateMnemonic(bits int) (string, error) {
+	entropy, err := NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return NewMnemonic(entropy)
+}
+
+/**
+ * 从助记词中还原出熵，并检查校验和
+ */
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	wordCount := len(words)
+	if wordCount < 12 || wordCount > 24 || wordCount%3 != 0 {
+		return nil, ErrInvalidMnemonic
+	}
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, ErrInvalidMnemonic
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+	//总位数 = 熵的位数 + 熵的位数/32
+	checksumBits := wordCount * 11 / 33
+	bits := checksumBits * 32
+	checksum := new(big.Int).And(data, big.NewInt(int64(1)<<uint(checksumBits)-1))
+	data.Rsh(data, uint(checksumBits))
+	entropy := make([]byte, bits/8)
+	data.FillBytes(entropy)
+
+	hash := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hash[0]>>(8-checksumBits)) {
+		return nil, ErrMnemonicChecksum
+	}
+	return entropy, nil
+}
+
+/**
+ * 检查助记词是否有效
+ */
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+/**
+ * 规范化助记词：去掉多余的空白，单词之间用一个空格分隔
+ */
+func NormalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(mnemonic), " ")
+}
+
+/**
+ * 由助记词和口令(可以为空)计算出64字节的种子：
+ * PBKDF2-HMAC-SHA512(助记词, "mnemonic"+口令, 2048次)
+ */
+func NewSeed(mnemonic string, passphrase string) ([]byte, error) {
+	err := ValidateMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key([]byte(NormalizeMnemonic(mnemonic)), []byte("mnemonic"+passphrase), SEEDITERATIONS, SEEDLEN, sha512.New), nil
+}
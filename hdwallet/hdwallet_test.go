@@ -0,0 +1,206 @@
+package hdwallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"crypto/elliptic"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+/**
+ * BIP39的测试向量，口令为TREZOR
+ */
+func TestMnemonicVectors(t *testing.T) {
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"},
+		{"80808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8"},
+		{"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069"},
+	}
+	for _, test := range tests {
+		mnemonic, err := NewMnemonic(decodeHex(t, test.entropy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Fatalf("熵%s期望生成助记词%s，实际为%s", test.entropy, test.mnemonic, mnemonic)
+		}
+		entropy, err := MnemonicToEntropy(mnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(entropy) != test.entropy {
+			t.Fatalf("助记词%s还原出的熵不正确：%x", mnemonic, entropy)
+		}
+		seed, err := NewSeed(mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(seed) != test.seed {
+			t.Fatalf("助记词%s计算出的种子不正确：%x", mnemonic, seed)
+		}
+	}
+
+	//校验和不正确、单词不在单词表中、单词数量不正确
+	invalids := []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abou",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	for _, mnemonic := range invalids {
+		_, err := NewSeed(mnemonic, "TREZOR")
+		if err == nil {
+			t.Fatalf("无效的助记词%s应该返回错误", mnemonic)
+		}
+	}
+}
+
+/**
+ * 派生路径m/0'/1/2'上每一级的私钥、链码和压缩格式的公钥
+ */
+type derivationVector struct {
+	path      string
+	key       string
+	chainCode string
+	pub       string
+}
+
+func checkDerivation(t *testing.T, curve elliptic.Curve, seed string, vectors []derivationVector) {
+	master, err := NewMaster(decodeHex(t, seed), curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vector := range vectors {
+		path, err := ParsePath(vector.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			t.Fatalf("派生%s失败：%v", vector.path, err)
+		}
+		if hex.EncodeToString(key.Key) != vector.key || hex.EncodeToString(key.ChainCode) != vector.chainCode {
+			t.Fatalf("%s的私钥或链码不正确：%x %x", vector.path, key.Key, key.ChainCode)
+		}
+		if hex.EncodeToString(key.PublicKey()) != vector.pub {
+			t.Fatalf("%s的公钥不正确：%x", vector.path, key.PublicKey())
+		}
+		if int(key.Depth) != len(path) {
+			t.Fatalf("%s的深度不正确：%d", vector.path, key.Depth)
+		}
+	}
+}
+
+/**
+ * BIP32的测试向量1
+ */
+func TestBIP32Vector(t *testing.T) {
+	checkDerivation(t, chaincrypto.S256(), "000102030405060708090a0b0c0d0e0f", []derivationVector{
+		{"m", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2"},
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"035a784662a4a20a65bf6aab9ae98a6c068a81c52e4b032c0fb5400c706cfccc56"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c"},
+		{"m/0'/1/2'", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+			"04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f",
+			"0357bfe1e341d01c69fe5654309956cbea516822fba8a601743a012a7896ee8dc2"},
+	})
+}
+
+/**
+ * SLIP-0010中NIST P-256曲线的测试向量1
+ */
+func TestSLIP10P256Vector(t *testing.T) {
+	checkDerivation(t, elliptic.P256(), "000102030405060708090a0b0c0d0e0f", []derivationVector{
+		{"m", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"m/0'", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+		{"m/0'/1", "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129",
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+		{"m/0'/1/2'", "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7",
+			"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+			"0359cf160040778a4b14c5f4d7b76e327ccc8c4a6086dd9451b7482b5a4972dda0"},
+	})
+}
+
+func TestNewMasterErrors(t *testing.T) {
+	_, err := NewMaster(make([]byte, 15), chaincrypto.S256())
+	if err != ErrInvalidSeed {
+		t.Fatalf("期望返回%v，实际返回%v", ErrInvalidSeed, err)
+	}
+	_, err = NewMaster(make([]byte, 65), chaincrypto.S256())
+	if err != ErrInvalidSeed {
+		t.Fatalf("期望返回%v，实际返回%v", ErrInvalidSeed, err)
+	}
+	_, err = NewMaster(make([]byte, 16), elliptic.P384())
+	if err != ErrUnsupportedCurve {
+		t.Fatalf("期望返回%v，实际返回%v", ErrUnsupportedCurve, err)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		expect []uint32
+	}{
+		{"m", []uint32{}},
+		{"m/0", []uint32{0}},
+		{" m/44'/1h/0'/1/5 ", []uint32{44 + HARDENED, 1 + HARDENED, HARDENED, 1, 5}},
+		{"m/2147483647'", []uint32{0xffffffff}},
+	}
+	for _, test := range tests {
+		path, err := ParsePath(test.path)
+		if err != nil {
+			t.Fatalf("解析%q失败：%v", test.path, err)
+		}
+		if !reflect.DeepEqual(path, test.expect) {
+			t.Fatalf("解析%q期望得到%v，实际为%v", test.path, test.expect, path)
+		}
+		//格式化之后再解析得到相同的路径
+		again, err := ParsePath(FormatPath(path))
+		if err != nil || !reflect.DeepEqual(again, path) {
+			t.Fatalf("%q格式化为%s之后解析的结果不一致", test.path, FormatPath(path))
+		}
+	}
+	if FormatPath(BIP44Path(0, INTERNAL, 3)) != "m/44'/1'/0'/1/3" {
+		t.Fatalf("BIP44路径格式化的结果不正确：%s", FormatPath(BIP44Path(0, INTERNAL, 3)))
+	}
+
+	invalids := []string{"", "M/0", "0/1", "m/", "m//1", "m/abc", "m/-1", "m/1''", "m/1x",
+		"m/2147483648", "m/2147483648'", "m/4294967296"}
+	for _, path := range invalids {
+		_, err := ParsePath(path)
+		if err != ErrInvalidPath {
+			t.Fatalf("解析%q期望返回%v，实际返回%v", path, ErrInvalidPath, err)
+		}
+	}
+}
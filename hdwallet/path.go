@@ -0,0 +1,77 @@
+package hdwallet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/**
+ * BIP44的派生路径：m / 44' / coin_type' / account' / change / address_index
+ * change为0时是对外收款的地址，为1时是找零地址
+ */
+const (
+	PURPOSE  uint32 = 44
+	COINTYPE uint32 = 1 //所有币种的测试网络共用的币种类型
+	EXTERNAL uint32 = 0
+	INTERNAL uint32 = 1
+)
+
+var ErrInvalidPath = errors.New("派生路径的格式不正确，例如：m/44'/1'/0'/0/0")
+
+/**
+ * 账户account中第index个地址的派生路径，change为EXTERNAL或INTERNAL
+ */
+func BIP44Path(account uint32, change uint32, index uint32) []uint32 {
+	return []uint32{
+		PURPOSE + HARDENED,
+		COINTYPE + HARDENED,
+		account + HARDENED,
+		change,
+		index,
+	}
+}
+
+/**
+ * 解析字符串格式的派生路径，'或h表示强化派生
+ */
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		return nil, ErrInvalidPath
+	}
+	indexes := make([]uint32, 0)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HARDENED {
+			return nil, ErrInvalidPath
+		}
+		if hardened {
+			index += uint64(HARDENED)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+/**
+ * 把派生路径格式化为字符串
+ */
+func FormatPath(path []uint32) string {
+	builder := strings.Builder{}
+	builder.WriteString("m")
+	for _, index := range path {
+		builder.WriteString("/")
+		if index >= HARDENED {
+			builder.WriteString(strconv.FormatUint(uint64(index-HARDENED), 10))
+			builder.WriteString("'")
+		} else {
+			builder.WriteString(strconv.FormatUint(uint64(index), 10))
+		}
+	}
+	return builder.String()
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"github.com/bolt"
-	"XianfengChain04/client"
 	"XianfengChain04/chain"
+	"XianfengChain04/client"
+	"XianfengChain04/config"
+	"XianfengChain04/storage"
 	"fmt"
 )
 
@@ -12,17 +13,24 @@ const BLOCKS = "xianfengchain04.db"
 func main() {
 
 	//打开数据库文件
-	db, err := bolt.Open(BLOCKS, 0600, nil)
+	db, err := storage.OpenBoltDB(BLOCKS)
 	if err != nil {
 		panic(err.Error())
 	}
 
 	defer db.Close() //xxx.db.lock
-	blockChain, err := chain.CreateChain(db)
+
+	//读取节点的配置文件
+	cfg, err := config.LoadConfig(config.CONFIGFILE)
+	if err != nil {
+		fmt.Println("读取配置文件失败：", err.Error())
+		return
+	}
+	blockChain, err := chain.CreateChain(db, cfg)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	cmdClient := client.CmdClient{*blockChain}
+	cmdClient := client.CmdClient{blockChain}
 	cmdClient.Run()
 }
@@ -0,0 +1,333 @@
+package mempool
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"XianfengChain04/utils"
+	"errors"
+	"sort"
+)
+
+const MEMPOOL = "mempool"
+
+var (
+	ErrTxExists    = errors.New("交易已经在交易池中")
+	ErrDoubleSpend = errors.New("交易花费的交易输出已经被交易池中的其他交易花费")
+)
+
+/**
+ * 交易池中的一笔交易：交易本身、手续费、交易编码后的大小以及加入交易池的顺序
+ */
+type TxEntry struct {
+	Tx   transaction.Transaction
+	Fee  transaction.Amount
+	Size int
+	Seq  int64
+}
+
+/**
+ * 比较两笔交易的手续费率(每字节手续费)，a的手续费率更高时返回true
+ * 交叉相乘比较，避免使用浮点数
+ */
+func (a *TxEntry) higherFeeRate(b *TxEntry) bool {
+	left := int64(a.Fee) * int64(b.Size)
+	right := int64(b.Fee) * int64(a.Size)
+	if left != right {
+		return left > right
+	}
+	return a.Seq < b.Seq
+}
+
+/**
+ * 交易池：保存已经通过验证但还未被打包到区块中的交易，并持久化到单独的bolt桶中
+ * 交易在加入交易池之前需要由调用者验证，交易池只负责检查池内的重复花费
+ */
+type Mempool struct {
+	DB storage.DB
+	//交易hash -> 交易
+	Entries map[[32]byte]*TxEntry
+	//被交易池中的交易花费的交易输出 -> 花费它的交易hash
+	Spends  map[string][32]byte
+	nextSeq int64
+}
+
+/**
+ * 交易输出的标识：交易哈希 + 交易输出的序号
+ */
+func outPointKey(txId [32]byte, vout int) string {
+	voutBytes, _ := utils.Int2Byte(int64(vout))
+	return string(append(txId[:], voutBytes...))
+}
+
+/**
+ * 从db中加载交易池，交易池桶不存在时创建
+ */
+func LoadMempool(db storage.DB) (*Mempool, error) {
+	pool := &Mempool{
+		DB:      db,
+		Entries: make(map[[32]byte]*TxEntry),
+		Spends:  make(map[string][32]byte),
+	}
+	err := db.Update(func(tx storage.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(MEMPOOL))
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			entry := new(TxEntry)
+			_, err := utils.Decode(v, entry)
+			if err != nil {
+				return err
+			}
+			pool.put(entry)
+			if entry.Seq >= pool.nextSeq {
+				pool.nextSeq = entry.Seq + 1
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+/**
+ * 将交易记录到内存中的交易池
+ */
+func (pool *Mempool) put(entry *TxEntry) {
+	pool.Entries[entry.Tx.TxHash] = entry
+	for _, input := range entry.Tx.Inputs {
+		pool.Spends[outPointKey(input.TxId, input.Vout)] = entry.Tx.TxHash
+	}
+}
+
+/**
+ * 将一笔已经通过验证的交易加入交易池，fee为该交易的手续费
+ */
+func (pool *Mempool) Add(newTx transaction.Transaction, fee transaction.Amount) error {
+	if newTx.IsCoinBase() {
+		return errors.New("coinbase交易不能加入交易池")
+	}
+	if _, ok := pool.Entries[newTx.TxHash]; ok {
+		return ErrTxExists
+	}
+	for _, input := range newTx.Inputs {
+		if pool.IsSpent(input.TxId, input.Vout) {
+			return ErrDoubleSpend
+		}
+	}
+	txBytes, err := newTx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	entry := &TxEntry{
+		Tx:   newTx,
+		Fee:  fee,
+		Size: len(txBytes),
+		Seq:  pool.nextSeq,
+	}
+	entryBytes, err := utils.Encode(entry)
+	if err != nil {
+		return err
+	}
+	err = pool.DB.Update(func(tx storage.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(MEMPOOL))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(newTx.TxHash[:], entryBytes)
+	})
+	if err != nil {
+		return err
+	}
+	pool.put(entry)
+	pool.nextSeq++
+	return nil
+}
+
+/**
+ * 判断某个交易输出是否已经被交易池中的交易花费
+ */
+func (pool *Mempool) IsSpent(txId [32]byte, vout int) bool {
+	_, ok := pool.Spends[outPointKey(txId, vout)]
+	return ok
+}
+
+/**
+ * 判断交易是否在交易池中
+ */
+func (pool *Mempool) Has(txId [32]byte) bool {
+	_, ok := pool.Entries[txId]
+	return ok
+}
+
+/**
+ * 获取交易池中的所有交易，按照加入交易池的顺序排列，保证交易排在它所花费的池内交易之后
+ */
+func (pool *Mempool) GetTransactions() []transaction.Transaction {
+	entries := make([]*TxEntry, 0)
+	for _, entry := range pool.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	txs := make([]transaction.Transaction, 0)
+	for _, entry := range entries {
+		txs = append(txs, entry.Tx)
+	}
+	return txs
+}
+
+/**
+ * 按照手续费率从高到低选择交易，选中交易的总大小不超过maxSize
+ * 花费了池内其他交易输出的交易，只有在其依赖的交易都被选中之后才会被选中
+ * 返回的交易中，被依赖的交易总是排在前面
+ */
+func (pool *Mempool) SelectTransactions(maxSize int) []transaction.Transaction {
+	entries := make([]*TxEntry, 0)
+	for _, entry := range pool.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].higherFeeRate(entries[j])
+	})
+
+	selected := make(map[[32]byte]bool)
+	txs := make([]transaction.Transaction, 0)
+	var totalSize int
+	for {
+		progress := false
+		for _, entry := range entries {
+			if selected[entry.Tx.TxHash] || totalSize+entry.Size > maxSize {
+				continue
+			}
+			//依赖的池内交易还没有被选中时，暂时跳过
+			ready := true
+			for _, input := range entry.Tx.Inputs {
+				if pool.Has(input.TxId) && !selected[input.TxId] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			selected[entry.Tx.TxHash] = true
+			txs = append(txs, entry.Tx)
+			totalSize += entry.Size
+			progress = true
+			//每选中一笔交易都从手续费率最高的交易重新开始，它的子交易可能因此可以被选中
+			break
+		}
+		if !progress {
+			return txs
+		}
+	}
+}
+
+/**
+ * 区块被添加到区块链后，从交易池中删除区块中已经被打包的交易，
+ * 以及与区块中的交易花费了同一个交易输出的冲突交易和依赖于冲突交易的交易
+ */
+func (pool *Mempool) RemoveBlockTxs(txs []transaction.Transaction) error {
+	removed := make(map[[32]byte]bool)
+	for _, blockTx := range txs {
+		if pool.Has(blockTx.TxHash) {
+			removed[blockTx.TxHash] = true
+			continue
+		}
+		if blockTx.IsCoinBase() {
+			continue
+		}
+		for _, input := range blockTx.Inputs {
+			spender, ok := pool.Spends[outPointKey(input.TxId, input.Vout)]
+			if ok {
+				pool.collectDescendants(spender, removed)
+			}
+		}
+	}
+	return pool.remove(removed)
+}
+
+/**
+ * 从交易池中删除交易txIds以及所有依赖于它们的交易，用于删除已经失效的交易
+ */
+func (pool *Mempool) Remove(txIds [][32]byte) error {
+	removed := make(map[[32]byte]bool)
+	for _, txId := range txIds {
+		pool.collectDescendants(txId, removed)
+	}
+	return pool.remove(removed)
+}
+
+/**
+ * 清空交易池，区块链切换分支后交易池中的交易需要重新验证
+ */
+func (pool *Mempool) Clear() error {
+	removed := make(map[[32]byte]bool)
+	for txId := range pool.Entries {
+		removed[txId] = true
+	}
+	return pool.remove(removed)
+}
+
+/**
+ * 收集交易txId以及所有花费了它的输出的池内交易
+ */
+func (pool *Mempool) collectDescendants(txId [32]byte, removed map[[32]byte]bool) {
+	if removed[txId] {
+		return
+	}
+	entry, ok := pool.Entries[txId]
+	if !ok {
+		return
+	}
+	removed[txId] = true
+	for index := range entry.Tx.Outputs {
+		spender, ok := pool.Spends[outPointKey(txId, index)]
+		if ok {
+			pool.collectDescendants(spender, removed)
+		}
+	}
+}
+
+/**
+ * 从交易池和交易池桶中删除交易
+ */
+func (pool *Mempool) remove(txIds map[[32]byte]bool) error {
+	if len(txIds) == 0 {
+		return nil
+	}
+	err := pool.DB.Update(func(tx storage.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(MEMPOOL))
+		if err != nil {
+			return err
+		}
+		for txId := range txIds {
+			err = bucket.Delete(txId[:])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for txId := range txIds {
+		entry, ok := pool.Entries[txId]
+		if !ok {
+			continue
+		}
+		for _, input := range entry.Tx.Inputs {
+			key := outPointKey(input.TxId, input.Vout)
+			if pool.Spends[key] == txId {
+				delete(pool.Spends, key)
+			}
+		}
+		delete(pool.Entries, txId)
+	}
+	return nil
+}
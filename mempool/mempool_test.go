@@ -0,0 +1,188 @@
+package mempool
+
+import (
+	"XianfengChain04/storage"
+	"XianfengChain04/transaction"
+	"reflect"
+	"testing"
+)
+
+/**
+ * 测试用的交易输出标识
+ */
+type outPoint struct {
+	txId [32]byte
+	vout int
+}
+
+/**
+ * 生成一笔花费inputs、有outputs个交易输出的测试交易，id用于区分输入相同的交易
+ */
+func newTestTx(t *testing.T, id byte, outputs int, inputs ...outPoint) transaction.Transaction {
+	newTx := transaction.Transaction{}
+	for _, input := range inputs {
+		newTx.Inputs = append(newTx.Inputs, transaction.TxInput{TxId: input.txId, Vout: input.vout})
+	}
+	for i := 0; i < outputs; i++ {
+		newTx.Outputs = append(newTx.Outputs, transaction.TxOutput{Value: transaction.COIN, ScriptPub: []byte{id}})
+	}
+	err := newTx.SetTxHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTx
+}
+
+/**
+ * 交易池外的一个交易输出
+ */
+func externalOutPoint(id byte) outPoint {
+	return outPoint{txId: [32]byte{0xee, id}, vout: 0}
+}
+
+func newTestPool(t *testing.T) *Mempool {
+	pool, err := LoadMempool(storage.NewMemoryDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func addTx(t *testing.T, pool *Mempool, newTx transaction.Transaction, fee transaction.Amount) {
+	err := pool.Add(newTx, fee)
+	if err != nil {
+		t.Fatalf("交易加入交易池失败：%v", err)
+	}
+}
+
+func txHashes(txs []transaction.Transaction) [][32]byte {
+	hashes := make([][32]byte, 0)
+	for _, tx := range txs {
+		hashes = append(hashes, tx.TxHash)
+	}
+	return hashes
+}
+
+func TestSelectTransactionsByFeeRate(t *testing.T) {
+	pool := newTestPool(t)
+	low := newTestTx(t, 1, 1, externalOutPoint(1))
+	high := newTestTx(t, 2, 1, externalOutPoint(2))
+	middle := newTestTx(t, 3, 1, externalOutPoint(3))
+	//子交易的手续费率最高，但必须排在它花费的父交易之后
+	child := newTestTx(t, 4, 1, outPoint{low.TxHash, 0})
+	addTx(t, pool, low, 10)
+	addTx(t, pool, high, 30)
+	addTx(t, pool, middle, 20)
+	addTx(t, pool, child, 100)
+
+	selected := txHashes(pool.SelectTransactions(1 << 20))
+	expect := [][32]byte{high.TxHash, middle.TxHash, low.TxHash, child.TxHash}
+	if !reflect.DeepEqual(selected, expect) {
+		t.Fatalf("交易的选择顺序不正确：%x", selected)
+	}
+
+	//手续费相同时，大小更小的交易手续费率更高
+	big := newTestTx(t, 5, 3, externalOutPoint(5))
+	small := newTestTx(t, 6, 1, externalOutPoint(6))
+	pool = newTestPool(t)
+	addTx(t, pool, big, 10)
+	addTx(t, pool, small, 10)
+	selected = txHashes(pool.SelectTransactions(1 << 20))
+	if !reflect.DeepEqual(selected, [][32]byte{small.TxHash, big.TxHash}) {
+		t.Fatalf("手续费相同时交易的选择顺序不正确：%x", selected)
+	}
+
+	//总大小超过限制的交易不会被选中
+	size := pool.Entries[small.TxHash].Size
+	selected = txHashes(pool.SelectTransactions(size))
+	if !reflect.DeepEqual(selected, [][32]byte{small.TxHash}) {
+		t.Fatalf("总大小限制为%d时选中的交易不正确：%x", size, selected)
+	}
+}
+
+func TestAddConflictingSpend(t *testing.T) {
+	pool := newTestPool(t)
+	first := newTestTx(t, 1, 1, externalOutPoint(1))
+	conflict := newTestTx(t, 2, 1, externalOutPoint(1))
+	addTx(t, pool, first, 10)
+	err := pool.Add(first, 10)
+	if err != ErrTxExists {
+		t.Fatalf("期望返回%v，实际返回%v", ErrTxExists, err)
+	}
+	err = pool.Add(conflict, 20)
+	if err != ErrDoubleSpend {
+		t.Fatalf("期望返回%v，实际返回%v", ErrDoubleSpend, err)
+	}
+	if pool.Has(conflict.TxHash) {
+		t.Fatal("冲突的交易不应该加入交易池")
+	}
+
+	//区块中的交易与池内交易花费了同一个输出时，池内交易及其子交易都被删除
+	child := newTestTx(t, 3, 1, outPoint{first.TxHash, 0})
+	other := newTestTx(t, 4, 1, externalOutPoint(4))
+	addTx(t, pool, child, 10)
+	addTx(t, pool, other, 10)
+	err = pool.RemoveBlockTxs([]transaction.Transaction{conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(first.TxHash) || pool.Has(child.TxHash) {
+		t.Fatal("与区块中的交易冲突的交易及其子交易应该被删除")
+	}
+	if !pool.Has(other.TxHash) {
+		t.Fatal("不冲突的交易不应该被删除")
+	}
+	//被删除的交易花费的输出可以重新被花费
+	addTx(t, pool, newTestTx(t, 5, 1, externalOutPoint(1)), 10)
+}
+
+func TestRemoveDescendants(t *testing.T) {
+	db := storage.NewMemoryDB()
+	pool, err := LoadMempool(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := newTestTx(t, 1, 2, externalOutPoint(1))
+	child := newTestTx(t, 2, 1, outPoint{parent.TxHash, 0})
+	grandChild := newTestTx(t, 3, 1, outPoint{child.TxHash, 0})
+	sibling := newTestTx(t, 4, 1, outPoint{parent.TxHash, 1})
+	unrelated := newTestTx(t, 5, 1, externalOutPoint(5))
+	for _, newTx := range []transaction.Transaction{parent, child, grandChild, sibling, unrelated} {
+		addTx(t, pool, newTx, 10)
+	}
+
+	//删除子交易时，孙交易一起删除，父交易和兄弟交易保留
+	err = pool.Remove([][32]byte{child.TxHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := txHashes(pool.GetTransactions())
+	expect := [][32]byte{parent.TxHash, sibling.TxHash, unrelated.TxHash}
+	if !reflect.DeepEqual(remaining, expect) {
+		t.Fatalf("删除子交易之后剩余的交易不正确：%x", remaining)
+	}
+	if pool.IsSpent(parent.TxHash, 0) || !pool.IsSpent(parent.TxHash, 1) {
+		t.Fatal("删除子交易之后父交易输出的花费状态不正确")
+	}
+
+	//父交易被打包到区块中时只删除父交易本身，子交易仍然有效
+	err = pool.RemoveBlockTxs([]transaction.Transaction{parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Has(parent.TxHash) || !pool.Has(sibling.TxHash) {
+		t.Fatal("打包到区块中的交易应该被删除，其子交易应该保留")
+	}
+
+	//删除的结果已经持久化，重新加载的交易池与内存中一致
+	loaded, err := LoadMempool(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(txHashes(loaded.GetTransactions()), txHashes(pool.GetTransactions())) {
+		t.Fatalf("重新加载的交易池不正确：%x", txHashes(loaded.GetTransactions()))
+	}
+	if !loaded.IsSpent(sibling.Inputs[0].TxId, 1) {
+		t.Fatal("重新加载的交易池应该记录池内交易花费的输出")
+	}
+}
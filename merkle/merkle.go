@@ -0,0 +1,130 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+/**
+ * 默克尔证明路径上的一个节点：兄弟节点的hash，以及该兄弟节点是否位于左侧
+ */
+type ProofNode struct {
+	Hash   [32]byte
+	IsLeft bool
+}
+
+/**
+ * 计算两个子节点的父节点hash
+ */
+func hashPair(left [32]byte, right [32]byte) [32]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+
+/**
+ * 由下一层节点计算上一层节点，节点个数为奇数时复制最后一个节点凑成一对
+ */
+func nextLevel(level [][32]byte) [][32]byte {
+	parents := make([][32]byte, 0)
+	for i := 0; i < len(level); i += 2 {
+		left := level[i]
+		right := left
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		parents = append(parents, hashPair(left, right))
+	}
+	return parents
+}
+
+/**
+ * 根据交易hash的列表计算默克尔根，没有交易时默克尔根为空
+ */
+func GetMerkleRoot(hashes [][32]byte) [32]byte {
+	if len(hashes) == 0 {
+		return [32]byte{}
+	}
+	level := hashes
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+/**
+ * 生成第index个交易hash的默克尔证明：从叶子节点到根节点路径上的所有兄弟节点
+ */
+func GetMerkleProof(hashes [][32]byte, index int) ([]ProofNode, error) {
+	if index < 0 || index >= len(hashes) {
+		return nil, errors.New("交易在区块中的位置不正确")
+	}
+	proof := make([]ProofNode, 0)
+	level := hashes
+	for len(level) > 1 {
+		var sibling ProofNode
+		if index%2 == 0 {
+			sibling.Hash = level[index]
+			if index+1 < len(level) {
+				sibling.Hash = level[index+1]
+			}
+			sibling.IsLeft = false
+		} else {
+			sibling.Hash = level[index-1]
+			sibling.IsLeft = true
+		}
+		proof = append(proof, sibling)
+		level = nextLevel(level)
+		index = index / 2
+	}
+	return proof, nil
+}
+
+/**
+ * 验证默克尔证明：从叶子节点开始依次与兄弟节点计算父节点，最后得到的hash必须与默克尔根一致
+ */
+func VerifyProof(leaf [32]byte, root [32]byte, proof []ProofNode) bool {
+	current := leaf
+	for _, node := range proof {
+		if node.IsLeft {
+			current = hashPair(node.Hash, current)
+		} else {
+			current = hashPair(current, node.Hash)
+		}
+	}
+	return current == root
+}
+
+/**
+ * 将默克尔证明编码为字节：每个节点1个字节的位置标记(1表示左侧)加32个字节的hash
+ */
+func EncodeProof(proof []ProofNode) []byte {
+	data := make([]byte, 0)
+	for _, node := range proof {
+		var side byte
+		if node.IsLeft {
+			side = 1
+		}
+		data = append(data, side)
+		data = append(data, node.Hash[:]...)
+	}
+	return data
+}
+
+/**
+ * 从字节中解码出默克尔证明
+ */
+func DecodeProof(data []byte) ([]ProofNode, error) {
+	if len(data)%33 != 0 {
+		return nil, errors.New("默克尔证明的格式不正确")
+	}
+	proof := make([]ProofNode, 0)
+	for i := 0; i < len(data); i += 33 {
+		if data[i] > 1 {
+			return nil, errors.New("默克尔证明的格式不正确")
+		}
+		var node ProofNode
+		node.IsLeft = data[i] == 1
+		copy(node.Hash[:], data[i+1:i+33])
+		proof = append(proof, node)
+	}
+	return proof, nil
+}
@@ -0,0 +1,130 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+/**
+ * 生成n个测试用的叶子节点hash
+ */
+func testLeaves(n int) [][32]byte {
+	leaves := make([][32]byte, 0)
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, sha256.Sum256([]byte{byte(i)}))
+	}
+	return leaves
+}
+
+func TestGetMerkleRoot(t *testing.T) {
+	leaves := testLeaves(3)
+	ab := hashPair(leaves[0], leaves[1])
+	//奇数个节点时复制最后一个节点
+	cc := hashPair(leaves[2], leaves[2])
+	tests := []struct {
+		name   string
+		leaves [][32]byte
+		expect [32]byte
+	}{
+		{"没有交易", nil, [32]byte{}},
+		{"1个交易", leaves[:1], leaves[0]},
+		{"2个交易", leaves[:2], ab},
+		{"3个交易", leaves, hashPair(ab, cc)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := GetMerkleRoot(test.leaves)
+			if root != test.expect {
+				t.Fatalf("期望默克尔根为%x，实际为%x", test.expect, root)
+			}
+		})
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		leaves := testLeaves(n)
+		root := GetMerkleRoot(leaves)
+		for index := 0; index < n; index++ {
+			proof, err := GetMerkleProof(leaves, index)
+			if err != nil {
+				t.Fatalf("%d个交易中第%d个交易生成证明失败：%v", n, index, err)
+			}
+			if !VerifyProof(leaves[index], root, proof) {
+				t.Fatalf("%d个交易中第%d个交易的证明验证失败", n, index)
+			}
+			//编码之后再解码，证明仍然有效
+			decoded, err := DecodeProof(EncodeProof(proof))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyProof(leaves[index], root, decoded) {
+				t.Fatalf("%d个交易中第%d个交易的证明解码之后验证失败", n, index)
+			}
+			//其他的叶子节点不能使用该证明
+			if n > 1 && VerifyProof(leaves[(index+1)%n], root, proof) {
+				t.Fatalf("%d个交易中第%d个交易的证明对其他交易也验证通过", n, index)
+			}
+			//篡改证明中的任意一个节点都会导致验证失败
+			for i := range proof {
+				tampered := append([]ProofNode{}, proof...)
+				tampered[i].Hash[0] ^= 0xff
+				if VerifyProof(leaves[index], root, tampered) {
+					t.Fatalf("%d个交易中第%d个交易的证明被篡改后仍然验证通过", n, index)
+				}
+				//兄弟节点是复制的当前节点时，交换左右不会改变父节点
+				tampered = append([]ProofNode{}, proof...)
+				tampered[i].IsLeft = !tampered[i].IsLeft
+				if tampered[i].Hash != levelHash(leaves, proof, index, i) && VerifyProof(leaves[index], root, tampered) {
+					t.Fatalf("%d个交易中第%d个交易的证明位置被篡改后仍然验证通过", n, index)
+				}
+			}
+		}
+		_, err := GetMerkleProof(leaves, n)
+		if err == nil {
+			t.Fatalf("%d个交易时越界的位置应该返回错误", n)
+		}
+		_, err = GetMerkleProof(leaves, -1)
+		if err == nil {
+			t.Fatal("负数的位置应该返回错误")
+		}
+	}
+}
+
+/**
+ * 计算证明路径上第level层当前节点的hash
+ */
+func levelHash(leaves [][32]byte, proof []ProofNode, index int, level int) [32]byte {
+	current := leaves[index]
+	for _, node := range proof[:level] {
+		if node.IsLeft {
+			current = hashPair(node.Hash, current)
+		} else {
+			current = hashPair(current, node.Hash)
+		}
+	}
+	return current
+}
+
+func TestDecodeProof(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"长度不是33的倍数", make([]byte, 32)},
+		{"多出一个字节", make([]byte, 34)},
+		{"位置标记不正确", append([]byte{2}, make([]byte, 32)...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeProof(test.data)
+			if err == nil {
+				t.Fatal("格式不正确的默克尔证明应该返回错误")
+			}
+		})
+	}
+	proof, err := DecodeProof(nil)
+	if err != nil || len(proof) != 0 {
+		t.Fatalf("空的默克尔证明应该解码为空，实际返回%v，%v", proof, err)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"github.com/bolt"
+)
+
+/**
+ * 使用bolt数据库文件的存储实现
+ */
+type boltDB struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+type boltBucket struct {
+	bucket *bolt.Bucket
+}
+
+/**
+ * 打开(不存在时创建)bolt数据库文件
+ */
+func OpenBoltDB(path string) (DB, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return boltDB{db}, nil
+}
+
+func (db boltDB) View(fn func(tx Tx) error) error {
+	return db.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (db boltDB) Update(fn func(tx Tx) error) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (db boltDB) Close() error {
+	return db.db.Close()
+}
+
+func (tx boltTx) Bucket(name []byte) Bucket {
+	bucket := tx.tx.Bucket(name)
+	if bucket == nil {
+		return nil
+	}
+	return boltBucket{bucket}
+}
+
+func (tx boltTx) CreateBucket(name []byte) (Bucket, error) {
+	bucket, err := tx.tx.CreateBucket(name)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return boltBucket{bucket}, nil
+}
+
+func (tx boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	bucket, err := tx.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return boltBucket{bucket}, nil
+}
+
+func (tx boltTx) DeleteBucket(name []byte) error {
+	return convertError(tx.tx.DeleteBucket(name))
+}
+
+func (bucket boltBucket) Get(key []byte) []byte {
+	return bucket.bucket.Get(key)
+}
+
+func (bucket boltBucket) Put(key []byte, value []byte) error {
+	return convertError(bucket.bucket.Put(key, value))
+}
+
+func (bucket boltBucket) Delete(key []byte) error {
+	return convertError(bucket.bucket.Delete(key))
+}
+
+func (bucket boltBucket) ForEach(fn func(k, v []byte) error) error {
+	return bucket.bucket.ForEach(fn)
+}
+
+func (bucket boltBucket) Cursor() Cursor {
+	return bucket.bucket.Cursor()
+}
+
+/**
+ * 把bolt的错误转换为存储接口定义的错误，调用者不需要依赖bolt
+ */
+func convertError(err error) error {
+	switch err {
+	case bolt.ErrTxNotWritable:
+		return ErrTxNotWritable
+	case bolt.ErrBucketExists:
+		return ErrBucketExists
+	case bolt.ErrBucketNotFound:
+		return ErrBucketNotFound
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+/**
+ * 内存中的存储实现，数据不会保存到文件，用于测试以及不需要持久化的场景
+ * 读写事务在修改某个桶之前先复制该桶，事务成功结束时才替换为修改后的数据
+ */
+type memoryDB struct {
+	mutex   sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+type memoryTx struct {
+	writable bool
+	buckets  map[string]map[string][]byte
+	copied   map[string]bool //本事务中已经复制过的桶
+}
+
+type memoryBucket struct {
+	tx   *memoryTx
+	name string
+}
+
+type memoryCursor struct {
+	bucket *memoryBucket
+	keys   []string
+	index  int
+}
+
+/**
+ * 创建一个空的内存数据库
+ */
+func NewMemoryDB() DB {
+	return &memoryDB{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+func (db *memoryDB) View(fn func(tx Tx) error) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return fn(&memoryTx{
+		buckets: db.buckets,
+	})
+}
+
+func (db *memoryDB) Update(fn func(tx Tx) error) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	tx := &memoryTx{
+		writable: true,
+		buckets:  make(map[string]map[string][]byte),
+		copied:   make(map[string]bool),
+	}
+	for name, data := range db.buckets {
+		tx.buckets[name] = data
+	}
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	db.buckets = tx.buckets
+	return nil
+}
+
+func (db *memoryDB) Close() error {
+	return nil
+}
+
+func (tx *memoryTx) Bucket(name []byte) Bucket {
+	if _, ok := tx.buckets[string(name)]; !ok {
+		return nil
+	}
+	return &memoryBucket{tx: tx, name: string(name)}
+}
+
+func (tx *memoryTx) CreateBucket(name []byte) (Bucket, error) {
+	if !tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	if _, ok := tx.buckets[string(name)]; ok {
+		return nil, ErrBucketExists
+	}
+	tx.buckets[string(name)] = make(map[string][]byte)
+	tx.copied[string(name)] = true
+	return &memoryBucket{tx: tx, name: string(name)}, nil
+}
+
+func (tx *memoryTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if !tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	if _, ok := tx.buckets[string(name)]; ok {
+		return &memoryBucket{tx: tx, name: string(name)}, nil
+	}
+	return tx.CreateBucket(name)
+}
+
+func (tx *memoryTx) DeleteBucket(name []byte) error {
+	if !tx.writable {
+		return ErrTxNotWritable
+	}
+	if _, ok := tx.buckets[string(name)]; !ok {
+		return ErrBucketNotFound
+	}
+	delete(tx.buckets, string(name))
+	delete(tx.copied, string(name))
+	return nil
+}
+
+/**
+ * 返回可以修改的桶数据，第一次修改时复制一份，避免影响事务之外的读取
+ */
+func (tx *memoryTx) writableBucket(name string) (map[string][]byte, error) {
+	if !tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	data, ok := tx.buckets[name]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	if !tx.copied[name] {
+		copied := make(map[string][]byte, len(data))
+		for k, v := range data {
+			copied[k] = v
+		}
+		tx.buckets[name] = copied
+		tx.copied[name] = true
+		data = copied
+	}
+	return data, nil
+}
+
+func (bucket *memoryBucket) Get(key []byte) []byte {
+	return bucket.tx.buckets[bucket.name][string(key)]
+}
+
+func (bucket *memoryBucket) Put(key []byte, value []byte) error {
+	data, err := bucket.tx.writableBucket(bucket.name)
+	if err != nil {
+		return err
+	}
+	data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (bucket *memoryBucket) Delete(key []byte) error {
+	data, err := bucket.tx.writableBucket(bucket.name)
+	if err != nil {
+		return err
+	}
+	delete(data, string(key))
+	return nil
+}
+
+func (bucket *memoryBucket) ForEach(fn func(k, v []byte) error) error {
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		err := fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 游标创建时对桶中的key排序，之后新增的key不会出现在游标中，已经删除的key会被跳过
+ */
+func (bucket *memoryBucket) Cursor() Cursor {
+	data := bucket.tx.buckets[bucket.name]
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &memoryCursor{
+		bucket: bucket,
+		keys:   keys,
+		index:  -1,
+	}
+}
+
+/**
+ * 从index开始按照step的方向移动到第一个还存在于桶中的key，超出范围时返回的key为nil
+ */
+func (cursor *memoryCursor) move(index int, step int) ([]byte, []byte) {
+	data := cursor.bucket.tx.buckets[cursor.bucket.name]
+	for ; index >= 0 && index < len(cursor.keys); index += step {
+		key := cursor.keys[index]
+		if value, ok := data[key]; ok {
+			cursor.index = index
+			return []byte(key), value
+		}
+	}
+	if index < 0 {
+		cursor.index = -1
+	} else {
+		cursor.index = len(cursor.keys)
+	}
+	return nil, nil
+}
+
+func (cursor *memoryCursor) First() ([]byte, []byte) {
+	return cursor.move(0, 1)
+}
+
+func (cursor *memoryCursor) Last() ([]byte, []byte) {
+	return cursor.move(len(cursor.keys)-1, -1)
+}
+
+func (cursor *memoryCursor) Next() ([]byte, []byte) {
+	if cursor.index >= len(cursor.keys) {
+		return nil, nil
+	}
+	return cursor.move(cursor.index+1, 1)
+}
+
+func (cursor *memoryCursor) Prev() ([]byte, []byte) {
+	if cursor.index < 0 {
+		return nil, nil
+	}
+	return cursor.move(cursor.index-1, -1)
+}
+
+func (cursor *memoryCursor) Seek(seek []byte) ([]byte, []byte) {
+	return cursor.move(sort.SearchStrings(cursor.keys, string(seek)), 1)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import "errors"
+
+/**
+ * 键值存储的接口：数据按照桶(bucket)分组，每个桶中的key按照字节顺序排列
+ * 所有的读写都在事务中进行，Update中的修改要么全部生效，要么全部不生效
+ * chain、wallet、mempool等模块只依赖这些接口，不依赖具体的存储实现
+ */
+
+var (
+	ErrTxNotWritable  = errors.New("只读事务中不能修改数据")
+	ErrBucketExists   = errors.New("桶已经存在")
+	ErrBucketNotFound = errors.New("桶不存在")
+)
+
+/**
+ * 数据库
+ */
+type DB interface {
+	View(fn func(tx Tx) error) error   //只读事务
+	Update(fn func(tx Tx) error) error //读写事务，fn返回错误时所有修改都被丢弃
+	Close() error
+}
+
+/**
+ * 事务，只在View或Update的fn执行期间有效
+ */
+type Tx interface {
+	Bucket(name []byte) Bucket //桶不存在时返回nil
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+/**
+ * 桶：Get返回的数据只在事务期间有效，需要保留时应该复制或者解码
+ */
+type Bucket interface {
+	Get(key []byte) []byte //key不存在时返回nil
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error //按照key的顺序遍历
+	Cursor() Cursor
+}
+
+/**
+ * 游标：按照key的顺序在桶中移动，移动到桶的范围之外时返回的key为nil
+ * 遍历过程中删除了游标当前的key之后，需要使用Seek重新定位，直接调用Next可能会跳过key(bolt)
+ * ForEach的fn中不能修改桶
+ */
+type Cursor interface {
+	First() (key []byte, value []byte)
+	Last() (key []byte, value []byte)
+	Next() (key []byte, value []byte)
+	Prev() (key []byte, value []byte)
+	Seek(seek []byte) (key []byte, value []byte) //移动到第一个大于等于seek的key
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testBucket = []byte("test")
+
+/**
+ * 对bolt和内存两种存储实现分别执行同一个测试
+ */
+func forEachBackend(t *testing.T, test func(t *testing.T, db DB)) {
+	t.Run("bolt", func(t *testing.T) {
+		db, err := OpenBoltDB(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		test(t, db)
+	})
+	t.Run("memory", func(t *testing.T) {
+		db := NewMemoryDB()
+		defer db.Close()
+		test(t, db)
+	})
+}
+
+/**
+ * 在一个读写事务中创建测试桶并写入keys，value与key相同
+ */
+func putKeys(t *testing.T, db DB, keys ...string) {
+	err := db.Update(func(tx Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(testBucket)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err = bucket.Put([]byte(key), []byte(key))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/**
+ * 按照key的顺序读取测试桶中所有的key
+ */
+func readKeys(t *testing.T, db DB) []string {
+	keys := make([]string, 0)
+	err := db.View(func(tx Tx) error {
+		bucket := tx.Bucket(testBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestUpdateRollback(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		errRollback := errors.New("rollback")
+		//fn返回错误时，新建的桶也不会保存
+		err := db.Update(func(tx Tx) error {
+			bucket, err := tx.CreateBucket(testBucket)
+			if err != nil {
+				return err
+			}
+			bucket.Put([]byte("a"), []byte("a"))
+			return errRollback
+		})
+		if err != errRollback {
+			t.Fatalf("期望返回%v，实际返回%v", errRollback, err)
+		}
+		err = db.View(func(tx Tx) error {
+			if tx.Bucket(testBucket) != nil {
+				return errors.New("回滚的事务中创建的桶仍然存在")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//fn返回错误时，对已有的桶的修改全部丢弃
+		putKeys(t, db, "a", "b")
+		err = db.Update(func(tx Tx) error {
+			bucket := tx.Bucket(testBucket)
+			err := bucket.Put([]byte("c"), []byte("c"))
+			if err != nil {
+				return err
+			}
+			err = bucket.Delete([]byte("a"))
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucket([]byte("other"))
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if err != errRollback {
+			t.Fatalf("期望返回%v，实际返回%v", errRollback, err)
+		}
+		keys := readKeys(t, db)
+		if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+			t.Fatalf("回滚之后桶中的数据不正确：%v", keys)
+		}
+		err = db.View(func(tx Tx) error {
+			if tx.Bucket([]byte("other")) != nil {
+				return errors.New("回滚的事务中创建的桶仍然存在")
+			}
+			//只读事务中不能修改数据
+			return tx.Bucket(testBucket).Put([]byte("d"), []byte("d"))
+		})
+		if err != ErrTxNotWritable {
+			t.Fatalf("期望返回%v，实际返回%v", ErrTxNotWritable, err)
+		}
+	})
+}
+
+func TestCursorOrder(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		putKeys(t, db, "d", "b", "a", "e", "c")
+		err := db.View(func(tx Tx) error {
+			cursor := tx.Bucket(testBucket).Cursor()
+			var forward []string
+			for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+				forward = append(forward, string(k))
+			}
+			if !reflect.DeepEqual(forward, []string{"a", "b", "c", "d", "e"}) {
+				t.Errorf("First/Next的顺序不正确：%v", forward)
+			}
+			var backward []string
+			for k, _ := cursor.Last(); k != nil; k, _ = cursor.Prev() {
+				backward = append(backward, string(k))
+			}
+			if !reflect.DeepEqual(backward, []string{"e", "d", "c", "b", "a"}) {
+				t.Errorf("Last/Prev的顺序不正确：%v", backward)
+			}
+
+			tests := []struct {
+				seek string
+				key  string
+				next string
+				prev string
+			}{
+				{"c", "c", "d", "b"},
+				{"bb", "c", "d", "b"},
+				{"", "a", "b", ""},
+				{"f", "", "", ""},
+			}
+			for _, test := range tests {
+				k, v := cursor.Seek([]byte(test.seek))
+				if string(k) != test.key || string(v) != test.key {
+					t.Errorf("Seek(%q)期望返回%q，实际返回%q", test.seek, test.key, k)
+					continue
+				}
+				if k == nil {
+					continue
+				}
+				k, _ = cursor.Next()
+				if string(k) != test.next {
+					t.Errorf("Seek(%q)之后Next期望返回%q，实际返回%q", test.seek, test.next, k)
+				}
+				cursor.Seek([]byte(test.seek))
+				k, _ = cursor.Prev()
+				if string(k) != test.prev {
+					t.Errorf("Seek(%q)之后Prev期望返回%q，实际返回%q", test.seek, test.prev, k)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDeleteDuringIteration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db DB) {
+		//分别测试事务中游标创建之前桶没有被修改和已经被修改的情况
+		for _, modified := range []bool{false, true} {
+			putKeys(t, db, "a", "b", "c", "d", "e", "f")
+			var visited []string
+			err := db.Update(func(tx Tx) error {
+				bucket := tx.Bucket(testBucket)
+				if modified {
+					err := bucket.Put([]byte("g"), []byte("g"))
+					if err != nil {
+						return err
+					}
+				}
+				visited = nil
+				cursor := bucket.Cursor()
+				for k, _ := cursor.First(); k != nil; {
+					key := append([]byte{}, k...)
+					visited = append(visited, string(key))
+					if key[0] == 'g' || (key[0]-'a')%2 != 0 {
+						k, _ = cursor.Next()
+						continue
+					}
+					//删除当前的key之后使用Seek重新定位游标
+					err := bucket.Delete(key)
+					if err != nil {
+						return err
+					}
+					k, _ = cursor.Seek(key)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectVisited := []string{"a", "b", "c", "d", "e", "f"}
+			expectKeys := []string{"b", "d", "f"}
+			if modified {
+				expectVisited = append(expectVisited, "g")
+				expectKeys = append(expectKeys, "g")
+			}
+			if !reflect.DeepEqual(visited, expectVisited) {
+				t.Fatalf("遍历过程中删除之后遍历到的key不正确：%v", visited)
+			}
+			keys := readKeys(t, db)
+			if !reflect.DeepEqual(keys, expectKeys) {
+				t.Fatalf("遍历过程中删除之后桶中的数据不正确：%v", keys)
+			}
+			err = db.Update(func(tx Tx) error {
+				return tx.DeleteBucket(testBucket)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package transaction
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 金额类型：以最小单位(类似比特币的聪)计数的整数，避免使用浮点数计算金额产生精度误差
+ */
+type Amount int64
+
+const DECIMALS = 8                       //金额的小数位数
+const COIN Amount = 100000000            //1个币等于多少个最小单位
+const MAXAMOUNT Amount = 21000000 * COIN //单笔金额的上限
+
+/**
+ * 将用户输入的十进制金额字符串(如"10.5")解析为以最小单位计数的金额
+ */
+func ParseAmount(str string) (Amount, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return 0, errors.New("金额不能为空")
+	}
+	if strings.HasPrefix(str, "-") {
+		return 0, errors.New("金额不能为负数")
+	}
+	str = strings.TrimPrefix(str, "+")
+
+	//1、拆分整数部分和小数部分
+	intPart := str
+	fracPart := ""
+	if index := strings.Index(str, "."); index >= 0 {
+		intPart = str[:index]
+		fracPart = str[index+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, errors.New("金额格式不正确：" + str)
+	}
+	if len(fracPart) > DECIMALS {
+		return 0, errors.New("金额最多支持8位小数：" + str)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	//2、小数部分补齐到8位，整体作为最小单位的整数进行解析
+	fracPart += strings.Repeat("0", DECIMALS-len(fracPart))
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return 0, errors.New("金额格式不正确：" + str)
+		}
+	}
+	whole, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || Amount(whole) > MAXAMOUNT/COIN {
+		return 0, errors.New("金额超出范围：" + str)
+	}
+	frac, err := strconv.ParseInt(fracPart, 10, 64)
+	if err != nil {
+		return 0, errors.New("金额格式不正确：" + str)
+	}
+	amount := Amount(whole)*COIN + Amount(frac)
+	if amount > MAXAMOUNT {
+		return 0, errors.New("金额超出范围：" + str)
+	}
+	return amount, nil
+}
+
+/**
+ * 将金额格式化为十进制字符串，去掉小数部分末尾多余的0
+ */
+func (amount Amount) String() string {
+	sign := ""
+	value := int64(amount)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	whole := strconv.FormatInt(value/int64(COIN), 10)
+	frac := strconv.FormatInt(value%int64(COIN), 10)
+	frac = strings.Repeat("0", DECIMALS-len(frac)) + frac
+	frac = strings.TrimRight(frac, "0")
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
@@ -0,0 +1,174 @@
+package transaction
+
+import (
+	"XianfengChain04/utils"
+	"bytes"
+	"errors"
+)
+
+/**
+ * 交易的二进制编码格式(整数均为大端序)：
+ *   交易:     编码版本(1字节) | 输入个数(4字节) | 输入... | 输出个数(4字节) | 输出...
+ *   交易输入: 交易hash(32字节) | 输出序号(8字节) | 签名长度(4字节) | 签名 | 公钥长度(4字节) | 公钥
+ *   交易输出: 金额(8字节) | 锁定脚本长度(4字节) | 锁定脚本
+ * 交易hash由交易的编码计算得到，不包含在交易的编码中
+ */
+const TXENCODINGVERSION = 0x01
+
+var ErrTxEncoding = errors.New("交易数据的格式不正确")
+
+/**
+ * 交易输入的二进制编码
+ */
+func (input TxInput) MarshalBinary() ([]byte, error) {
+	buff := new(bytes.Buffer)
+	input.writeTo(buff)
+	return buff.Bytes(), nil
+}
+
+/**
+ * 从二进制数据中解码交易输入
+ */
+func (input *TxInput) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	err := input.readFrom(reader)
+	if err != nil {
+		return err
+	}
+	if reader.Len() != 0 {
+		return ErrTxEncoding
+	}
+	return nil
+}
+
+func (input TxInput) writeTo(buff *bytes.Buffer) {
+	utils.WriteHash(buff, input.TxId)
+	utils.WriteInt64(buff, int64(input.Vout))
+	utils.WriteVarBytes(buff, input.Signature)
+	utils.WriteVarBytes(buff, input.PubKey)
+}
+
+func (input *TxInput) readFrom(reader *bytes.Reader) error {
+	var err error
+	input.TxId, err = utils.ReadHash(reader)
+	if err != nil {
+		return err
+	}
+	vout, err := utils.ReadInt64(reader)
+	if err != nil {
+		return err
+	}
+	input.Vout = int(vout)
+	input.Signature, err = utils.ReadVarBytes(reader)
+	if err != nil {
+		return err
+	}
+	input.PubKey, err = utils.ReadVarBytes(reader)
+	return err
+}
+
+/**
+ * 交易输出的二进制编码
+ */
+func (output TxOutput) MarshalBinary() ([]byte, error) {
+	buff := new(bytes.Buffer)
+	output.writeTo(buff)
+	return buff.Bytes(), nil
+}
+
+/**
+ * 从二进制数据中解码交易输出
+ */
+func (output *TxOutput) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	err := output.readFrom(reader)
+	if err != nil {
+		return err
+	}
+	if reader.Len() != 0 {
+		return ErrTxEncoding
+	}
+	return nil
+}
+
+func (output TxOutput) writeTo(buff *bytes.Buffer) {
+	utils.WriteInt64(buff, int64(output.Value))
+	utils.WriteVarBytes(buff, output.ScriptPub)
+}
+
+func (output *TxOutput) readFrom(reader *bytes.Reader) error {
+	value, err := utils.ReadInt64(reader)
+	if err != nil {
+		return err
+	}
+	output.Value = Amount(value)
+	output.ScriptPub, err = utils.ReadVarBytes(reader)
+	return err
+}
+
+/**
+ * 交易的二进制编码，用于计算交易hash、签名以及存储
+ */
+func (tx Transaction) MarshalBinary() ([]byte, error) {
+	buff := new(bytes.Buffer)
+	utils.WriteUint8(buff, TXENCODINGVERSION)
+	utils.WriteUint32(buff, uint32(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		input.writeTo(buff)
+	}
+	utils.WriteUint32(buff, uint32(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		output.writeTo(buff)
+	}
+	return buff.Bytes(), nil
+}
+
+/**
+ * 从二进制数据中解码交易，并根据编码计算交易hash
+ */
+func (tx *Transaction) UnmarshalBinary(data []byte) error {
+	reader := bytes.NewReader(data)
+	version, err := utils.ReadUint8(reader)
+	if err != nil {
+		return err
+	}
+	if version != TXENCODINGVERSION {
+		return errors.New("不支持的交易编码版本")
+	}
+	inputNum, err := utils.ReadUint32(reader)
+	if err != nil {
+		return err
+	}
+	//每个交易输入至少占用48个字节，防止恶意数据导致分配过大的内存
+	if int64(inputNum)*48 > int64(reader.Len()) {
+		return ErrTxEncoding
+	}
+	inputs := make([]TxInput, inputNum)
+	for i := range inputs {
+		err = inputs[i].readFrom(reader)
+		if err != nil {
+			return err
+		}
+	}
+	outputNum, err := utils.ReadUint32(reader)
+	if err != nil {
+		return err
+	}
+	//每个交易输出至少占用12个字节
+	if int64(outputNum)*12 > int64(reader.Len()) {
+		return ErrTxEncoding
+	}
+	outputs := make([]TxOutput, outputNum)
+	for i := range outputs {
+		err = outputs[i].readFrom(reader)
+		if err != nil {
+			return err
+		}
+	}
+	if reader.Len() != 0 {
+		return ErrTxEncoding
+	}
+	tx.Inputs = inputs
+	tx.Outputs = outputs
+	return tx.SetTxHash()
+}
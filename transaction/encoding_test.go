@@ -0,0 +1,104 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+ * 测试向量中使用的交易输入、交易输出和交易，以及它们按照编码格式手工拼接的十六进制编码
+ */
+var (
+	testInput = TxInput{
+		TxId:      [32]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11},
+		Vout:      1,
+		Signature: []byte{0xaa, 0xbb},
+		PubKey:    []byte{0x02, 0x03},
+	}
+	testInputHex = strings.Repeat("11", 32) + //交易hash
+		"0000000000000001" + //输出序号
+		"00000002" + "aabb" + //签名
+		"00000002" + "0203" //公钥
+
+	testOutput = TxOutput{
+		Value:     50 * COIN,
+		ScriptPub: bytes.Repeat([]byte{0x33}, 20),
+	}
+	testOutputHex = "000000012a05f200" + //金额
+		"00000014" + strings.Repeat("33", 20) //锁定脚本
+
+	testTx = Transaction{
+		Inputs:  []TxInput{testInput},
+		Outputs: []TxOutput{testOutput},
+	}
+	testTxHex = "01" + //编码版本
+		"00000001" + testInputHex +
+		"00000001" + testOutputHex
+	testTxHash = "e8e46b7d051ece0f03077a453b63945e7dda3221b6994daf1793513b5b5961c3"
+)
+
+func TestTxInputBinaryVector(t *testing.T) {
+	data, err := testInput.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != testInputHex {
+		t.Fatalf("交易输入的编码不正确：%x", data)
+	}
+	var decoded TxInput
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, testInput) {
+		t.Fatalf("解码得到的交易输入不一致：%+v", decoded)
+	}
+}
+
+func TestTxOutputBinaryVector(t *testing.T) {
+	data, err := testOutput.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != testOutputHex {
+		t.Fatalf("交易输出的编码不正确：%x", data)
+	}
+	var decoded TxOutput
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, testOutput) {
+		t.Fatalf("解码得到的交易输出不一致：%+v", decoded)
+	}
+}
+
+func TestTransactionBinaryVector(t *testing.T) {
+	data, err := testTx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != testTxHex {
+		t.Fatalf("交易的编码不正确：%x", data)
+	}
+	var decoded Transaction
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(decoded.TxHash[:]) != testTxHash {
+		t.Fatalf("交易hash不正确：%x", decoded.TxHash)
+	}
+	decoded.TxHash = [32]byte{}
+	if !reflect.DeepEqual(decoded, testTx) {
+		t.Fatalf("解码得到的交易不一致：%+v", decoded)
+	}
+	//编码之后多余的数据
+	err = decoded.UnmarshalBinary(append(data, 0x00))
+	if err != ErrTxEncoding {
+		t.Fatalf("期望返回%v，实际返回%v", ErrTxEncoding, err)
+	}
+}
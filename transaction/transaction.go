@@ -1,11 +1,30 @@
 package transaction
 
 import (
+	"XianfengChain04/chaincrypto"
 	"XianfengChain04/utils"
+	"XianfengChain04/wallet"
+	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 )
 
-const REWARDSIZE = 50
+const REWARDSIZE = 50 * COIN //初始的区块奖励
+
+/**
+ * 根据区块高度计算区块奖励：初始奖励为REWARDSIZE，每隔halvingInterval个区块减半
+ */
+func GetSubsidy(height int64, halvingInterval int64) Amount {
+	if halvingInterval <= 0 {
+		return REWARDSIZE
+	}
+	halvings := height / halvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return REWARDSIZE >> uint(halvings)
+}
 
 /**
  * 定义交易的结构体
@@ -21,60 +40,79 @@ type Transaction struct {
 
 /**
  * 该函数用于定义一个coinbase交易，并返回该交易结构体
+ * value为矿工领取的金额：区块奖励加上区块中所有交易的手续费
+ * height为区块高度，写入coinbase交易的输入中，保证不同区块的coinbase交易哈希不会重复
  */
-func CreateCoinBase(addr string) (*Transaction, error) {
-	output0 := TxOutput{
-		Value:     REWARDSIZE,
-		ScriptPub: []byte(addr),
+func CreateCoinBase(addr string, value Amount, height int64) (*Transaction, error) {
+	output0, err := NewTxOutput(value, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	heightBytes, err := utils.Int2Byte(height)
+	if err != nil {
+		return nil, err
+	}
+	//coinbase交易的输入不引用任何交易输出，Signature中存放区块高度
+	input0 := TxInput{
+		Vout:      -1,
+		Signature: heightBytes,
 	}
 
 	coinbase := Transaction{
-		Outputs: []TxOutput{output0},
+		Inputs:  []TxInput{input0},
+		Outputs: []TxOutput{*output0},
 	}
-	coinbaseBytes, err := utils.Encode(coinbase)
+	err = coinbase.SetTxHash()
 	if err != nil {
 		return nil, err
 	}
-	coinbase.TxHash = sha256.Sum256(coinbaseBytes)
 
 	return &coinbase, nil
 }
 
 /**
  * 该函数用于构建一笔普通的交易，返回构建好的交易实例
+ * fee为支付给矿工的手续费，交易输入总额减去转账金额和手续费后剩余的部分找零给from
  */
-func CreateNewTransaction(utxos []UTXO, from string, to string, amount float64) (*Transaction, error) {
+func CreateNewTransaction(utxos []UTXO, from string, to string, amount Amount, fee Amount) (*Transaction, error) {
 	//1、构建inputs
 	inputs := make([]TxInput, 0) //用于存放交易输入的容器
-	var inputAmount float64      //该变量用于记录转账发起者一共付了多少钱
+	var inputAmount Amount       //该变量用于记录转账发起者一共付了多少钱
 	//input -> 交易输入:对某个交易的交易输出UTXO的引用
 	for _, utxo := range utxos {
 		input := TxInput{
-			TxId:      utxo.TxId,
-			Vout:      utxo.Vout,
-			ScriptSig: []byte(from),
+			TxId: utxo.TxId,
+			Vout: utxo.Vout,
 		}
 		inputAmount += utxo.Value
 		//把构建好的input存入到交易输入容器中
 		inputs = append(inputs, input)
 	}
 
+	if fee < 0 {
+		return nil, errors.New("手续费不能为负数")
+	}
+	if inputAmount < amount+fee {
+		return nil, errors.New(from + "的余额不足以支付转账金额和手续费")
+	}
+
 	//2、构建outputs
 	outputs := make([]TxOutput, 0) //用于存放交易输出的容器
 	//构建转账接收者的交易输出
-	output0 := TxOutput{
-		Value:     amount,
-		ScriptPub: []byte(to),
+	output0, err := NewTxOutput(amount, to)
+	if err != nil {
+		return nil, err
 	}
-	outputs = append(outputs, output0) //把第一个交易输出放入到专门存交易输出的容器中
+	outputs = append(outputs, *output0) //把第一个交易输出放入到专门存交易输出的容器中
 
 	//判断是否需要找零,如果需要找零，则需要构建一个新的找零输出
-	if inputAmount-amount > 0 {
-		output1 := TxOutput{
-			Value:     inputAmount - amount,
-			ScriptPub: []byte(from),
+	if inputAmount-amount-fee > 0 {
+		output1, err := NewTxOutput(inputAmount-amount-fee, from)
+		if err != nil {
+			return nil, err
 		}
-		outputs = append(outputs, output1)
+		outputs = append(outputs, *output1)
 	}
 
 	//3、构建transaction
@@ -84,8 +122,7 @@ func CreateNewTransaction(utxos []UTXO, from string, to string, amount float64)
 	}
 
 	//4、计算transaction的哈希,并赋值
-	transactionBytes, err := utils.Encode(newTransaction)
-	newTransaction.TxHash = sha256.Sum256(transactionBytes)
+	err = newTransaction.SetTxHash()
 	if err != nil {
 		return nil, err
 	}
@@ -93,3 +130,146 @@ func CreateNewTransaction(utxos []UTXO, from string, to string, amount float64)
 	//5、将构建的transaction实例进行返回
 	return &newTransaction, nil
 }
+
+/**
+ * 计算交易的哈希，并赋值给TxHash字段：交易哈希是交易二进制编码的sha256哈希
+ */
+func (tx *Transaction) SetTxHash() error {
+	txBytes, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.TxHash = sha256.Sum256(txBytes)
+	return nil
+}
+
+/**
+ * 判断交易是否是coinbase交易：coinbase交易只有一个不引用任何交易输出的输入
+ * 旧版本的coinbase交易没有交易输入
+ */
+func (tx Transaction) IsCoinBase() bool {
+	if len(tx.Inputs) == 0 {
+		return true
+	}
+	return len(tx.Inputs) == 1 && tx.Inputs[0].TxId == [32]byte{} && tx.Inputs[0].Vout == -1
+}
+
+/**
+ * 获取coinbase交易中记录的区块高度，旧版本的coinbase交易没有记录高度，返回-1
+ */
+func (tx Transaction) CoinBaseHeight() int64 {
+	if len(tx.Inputs) != 1 || len(tx.Inputs[0].Signature) != 8 {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(tx.Inputs[0].Signature))
+}
+
+/**
+ * 拷贝一份修剪过的交易副本：清空所有交易输入的签名和公钥，
+ * 只保留第index个交易输入的公钥，该副本的哈希即为第index个交易输入要签名的数据
+ */
+func (tx Transaction) TrimmedCopy(index int) Transaction {
+	inputs := make([]TxInput, 0)
+	for inputIndex, input := range tx.Inputs {
+		trimmedInput := TxInput{
+			TxId: input.TxId,
+			Vout: input.Vout,
+		}
+		if inputIndex == index {
+			trimmedInput.PubKey = input.PubKey
+		}
+		inputs = append(inputs, trimmedInput)
+	}
+	outputs := make([]TxOutput, 0)
+	outputs = append(outputs, tx.Outputs...)
+	return Transaction{
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+}
+
+/**
+ * 计算第index个交易输入需要签名的数据的哈希
+ */
+func (tx Transaction) signHash(index int) ([]byte, error) {
+	trimmedTx := tx.TrimmedCopy(index)
+	trimmedBytes, err := trimmedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return utils.Hash256(trimmedBytes), nil
+}
+
+/**
+ * 对交易进行签名：privKeys中的私钥与交易输入一一对应，
+ * 签名和公钥保存在对应的交易输入中，签名完成后重新计算交易哈希
+ */
+func (tx *Transaction) Sign(privKeys []*ecdsa.PrivateKey) error {
+	pubKeys := make([][]byte, len(privKeys))
+	for index, pri := range privKeys {
+		if pri != nil {
+			pubKeys[index] = chaincrypto.GetPub(pri)
+		}
+	}
+	return tx.SignWithPubKeys(privKeys, pubKeys)
+}
+
+/**
+ * 对交易进行签名，交易输入中保存pubKeys中对应的公钥，
+ * 用于公钥不是默认编码的地址(如导入非压缩格式的WIF私钥得到的地址)
+ */
+func (tx *Transaction) SignWithPubKeys(privKeys []*ecdsa.PrivateKey, pubKeys [][]byte) error {
+	//coinbase交易没有交易输入，不需要签名
+	if tx.IsCoinBase() {
+		return nil
+	}
+	if len(privKeys) != len(tx.Inputs) || len(pubKeys) != len(tx.Inputs) {
+		return errors.New("私钥数量与交易输入数量不一致，无法签名")
+	}
+	for index, pri := range privKeys {
+		if pri == nil {
+			return errors.New("缺少交易输入对应的私钥，无法签名")
+		}
+		tx.Inputs[index].PubKey = pubKeys[index]
+	}
+	for index, pri := range privKeys {
+		hash, err := tx.signHash(index)
+		if err != nil {
+			return err
+		}
+		signature, err := chaincrypto.Sign(pri, hash)
+		if err != nil {
+			return err
+		}
+		tx.Inputs[index].Signature = signature
+	}
+	return tx.SetTxHash()
+}
+
+/**
+ * 验证交易的签名：prevOutputs为交易输入所引用的交易输出，与交易输入一一对应。
+ * 每个交易输入的公钥必须是所引用交易输出的所有者，并且签名有效，才返回true
+ */
+func (tx Transaction) Verify(prevOutputs []TxOutput) bool {
+	if tx.IsCoinBase() {
+		return true
+	}
+	if len(prevOutputs) != len(tx.Inputs) {
+		return false
+	}
+	for index, input := range tx.Inputs {
+		//1、交易输入提供的公钥的哈希必须与所引用的交易输出锁定的公钥哈希一致
+		if !prevOutputs[index].IsLockedWithKey(wallet.HashPubKey(input.PubKey)) {
+			return false
+		}
+		//2、使用公钥对签名进行验证
+		hash, err := tx.signHash(index)
+		if err != nil {
+			return false
+		}
+		if !chaincrypto.Verify(input.PubKey, hash, input.Signature) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,10 +1,23 @@
 package transaction
 
+import (
+	"XianfengChain04/wallet"
+	"bytes"
+)
+
 /**
  * 定义交易输入的结构体
  */
 type TxInput struct {
 	TxId      [32]byte //该字段确定引用自哪笔交易
 	Vout      int      //该字段确定引用自该交易的哪个输出
-	ScriptSig []byte   //该字段表示使用交易输出的证明，解锁脚本
+	Signature []byte   //交易发起者对交易的签名，解锁脚本的一部分
+	PubKey    []byte   //交易发起者的公钥，解锁脚本的一部分
+}
+
+/**
+ * 判断该交易输入是否是由公钥哈希为pubHash的用户所花费
+ */
+func (input TxInput) UsesKey(pubHash []byte) bool {
+	return bytes.Equal(wallet.HashPubKey(input.PubKey), pubHash)
 }
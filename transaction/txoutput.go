@@ -1,9 +1,45 @@
 package transaction
 
+import (
+	"XianfengChain04/wallet"
+	"bytes"
+)
+
 /**
  * 定义交易输出的结构体
  */
 type TxOutput struct {
-	Value     float64 //转账的数量
-	ScriptPub []byte  //锁定脚本
+	Value     Amount //转账的数量，以最小单位计数
+	ScriptPub []byte //锁定脚本，存放收款人的公钥哈希
+}
+
+/**
+ * 根据收款人的地址构建一个被锁定到该地址公钥哈希上的交易输出
+ */
+func NewTxOutput(value Amount, addr string) (*TxOutput, error) {
+	output := TxOutput{Value: value}
+	err := output.Lock(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+/**
+ * 将交易输出锁定到地址对应的公钥哈希上
+ */
+func (output *TxOutput) Lock(addr string) error {
+	pubHash, err := wallet.GetPubHashByAddress(addr)
+	if err != nil {
+		return err
+	}
+	output.ScriptPub = pubHash
+	return nil
+}
+
+/**
+ * 判断该交易输出是否被锁定在公钥哈希pubHash上
+ */
+func (output TxOutput) IsLockedWithKey(pubHash []byte) bool {
+	return bytes.Equal(output.ScriptPub, pubHash)
 }
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/**
+ * 二进制编码的辅助函数：整数统一使用大端序定长编码，
+ * 变长的字节数据在前面加上4个字节的长度
+ */
+
+const MAXVARBYTES = 32 * 1024 * 1024 //变长字节数据的最大长度，防止恶意数据导致分配过大的内存
+
+var ErrVarBytesTooLong = errors.New("变长数据的长度超出限制")
+
+func WriteUint8(buff *bytes.Buffer, num uint8) {
+	buff.WriteByte(num)
+}
+
+func WriteUint32(buff *bytes.Buffer, num uint32) {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], num)
+	buff.Write(data[:])
+}
+
+func WriteInt64(buff *bytes.Buffer, num int64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(num))
+	buff.Write(data[:])
+}
+
+func WriteHash(buff *bytes.Buffer, hash [32]byte) {
+	buff.Write(hash[:])
+}
+
+func WriteVarBytes(buff *bytes.Buffer, data []byte) {
+	WriteUint32(buff, uint32(len(data)))
+	buff.Write(data)
+}
+
+func ReadUint8(reader *bytes.Reader) (uint8, error) {
+	return reader.ReadByte()
+}
+
+func ReadUint32(reader *bytes.Reader) (uint32, error) {
+	var data [4]byte
+	_, err := io.ReadFull(reader, data[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(data[:]), nil
+}
+
+func ReadInt64(reader *bytes.Reader) (int64, error) {
+	var data [8]byte
+	_, err := io.ReadFull(reader, data[:])
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(data[:])), nil
+}
+
+func ReadHash(reader *bytes.Reader) ([32]byte, error) {
+	var hash [32]byte
+	_, err := io.ReadFull(reader, hash[:])
+	return hash, err
+}
+
+func ReadVarBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := ReadUint32(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > MAXVARBYTES || int64(length) > int64(reader.Len()) {
+		return nil, ErrVarBytesTooLong
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	return data, err
+}
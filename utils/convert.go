@@ -2,6 +2,8 @@ package utils
 
 import (
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
@@ -47,12 +49,36 @@ func JSONArray2String(array string) ([]string, error) {
 }
 
 /**
- * 将json格式的数组转换为对应的浮点型数据的切片
+ * 将json格式的数字数组转换为对应的十进制字符串的切片，保留用户输入的原始精度
+ * 例如: [10.5, "0.1"] -> ["10.5", "0.1"]
  */
-func JSONArray2Float(array string) ([]float64, error) {
-	var floatSlice []float64
-	err := json.Unmarshal([]byte(array), &floatSlice)
-	return floatSlice, err
+func JSONArray2Number(array string) ([]string, error) {
+	var numberSlice []json.Number
+	err := json.Unmarshal([]byte(array), &numberSlice)
+	if err != nil {
+		return nil, err
+	}
+	stringSlice := make([]string, 0)
+	for _, number := range numberSlice {
+		stringSlice = append(stringSlice, number.String())
+	}
+	return stringSlice, nil
+}
+
+/**
+ * 将十六进制字符串形式的hash转换为[32]byte类型
+ */
+func Hex2Hash(str string) ([32]byte, error) {
+	var hash [32]byte
+	hashBytes, err := hex.DecodeString(str)
+	if err != nil {
+		return hash, err
+	}
+	if len(hashBytes) != 32 {
+		return hash, errors.New("hash的长度不正确，应为32个字节")
+	}
+	copy(hash[:], hashBytes)
+	return hash, nil
 }
 
 /**
@@ -0,0 +1,278 @@
+package wallet
+
+import (
+	"XianfengChain04/hdwallet"
+	"crypto/elliptic"
+	"errors"
+)
+
+/**
+ * HD钱包：所有地址的秘钥对都从同一个种子按照BIP44路径派生，只需要备份助记词就可以恢复钱包
+ * 派生出的秘钥对仍然和其他秘钥对一样保存在钱包桶中，种子只在生成新地址和恢复钱包时使用
+ */
+
+const HDCHAIN = "hdchain"
+
+const MNEMONICBITS = 128 //自动生成助记词时熵的位数，对应12个单词
+const GAPLIMIT = 20      //恢复钱包时连续这么多个地址都没有交易记录，就认为后面的地址都没有使用过
+
+var ErrNoHDSeed = errors.New("钱包还没有HD种子，请先使用getnewaddress或者importmnemonic命令生成种子")
+
+/**
+ * HD钱包的种子和派生进度，保存在钱包元数据桶中，钱包加密后助记词和种子为密文
+ */
+type hdChain struct {
+	Mnemonic      []byte
+	MnemonicNonce []byte
+	Seed          []byte
+	SeedNonce     []byte
+	Account       uint32 //BIP44路径中的账户序号
+	NextExternal  uint32 //下一个收款地址的序号
+	NextInternal  uint32 //下一个找零地址的序号
+}
+
+/**
+ * 收款地址或找零地址下一个序号的指针
+ */
+func (hd *hdChain) nextIndex(change uint32) *uint32 {
+	if change == hdwallet.INTERNAL {
+		return &hd.NextInternal
+	}
+	return &hd.NextExternal
+}
+
+/**
+ * 使用主密钥加密助记词和种子，返回加密后的副本
+ */
+func (hd *hdChain) encrypt(masterKey []byte, mnemonic string, seed []byte) (*hdChain, error) {
+	encrypted := *hd
+	var err error
+	encrypted.Mnemonic, encrypted.MnemonicNonce, err = seal(masterKey, []byte(mnemonic), []byte(HDCHAIN))
+	if err != nil {
+		return nil, err
+	}
+	encrypted.Seed, encrypted.SeedNonce, err = seal(masterKey, seed, []byte(HDCHAIN))
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+/**
+ * 使用主密钥解密出助记词和种子
+ */
+func (hd *hdChain) decrypt(masterKey []byte) (string, []byte, error) {
+	mnemonic, err := open(masterKey, hd.Mnemonic, hd.MnemonicNonce, []byte(HDCHAIN))
+	if err != nil {
+		return "", nil, errors.New("HD种子解密失败")
+	}
+	seed, err := open(masterKey, hd.Seed, hd.SeedNonce, []byte(HDCHAIN))
+	if err != nil {
+		return "", nil, errors.New("HD种子解密失败")
+	}
+	return string(mnemonic), seed, nil
+}
+
+/**
+ * 由助记词生成新的HD种子和派生进度，钱包加密时助记词和种子使用主密钥加密，
+ * 返回保存到文件中的hdChain、种子和规范化的助记词，不修改钱包
+ * 调用者需要持有锁，并保证钱包没有锁定
+ */
+func (wallet *Wallet) newHDChain(mnemonic string, passphrase string) (*hdChain, []byte, string, error) {
+	mnemonic = hdwallet.NormalizeMnemonic(mnemonic)
+	seed, err := hdwallet.NewSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	hd := &hdChain{
+		Mnemonic: []byte(mnemonic),
+		Seed:     seed,
+	}
+	if wallet.params != nil {
+		hd, err = hd.encrypt(wallet.masterKey, mnemonic, seed)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return hd, seed, mnemonic, nil
+}
+
+/**
+ * 设置钱包的HD种子，之后的新地址都从该种子派生，已有的地址仍然保留在钱包中
+ * 调用者需要持有锁，并保证钱包没有锁定
+ */
+func (wallet *Wallet) setHDSeed(mnemonic string, passphrase string) error {
+	hd, seed, mnemonic, err := wallet.newHDChain(mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	wallet.hd = hd
+	wallet.seed = seed
+	wallet.mnemonic = mnemonic
+	return nil
+}
+
+/**
+ * 派生账户中第index个收款地址或找零地址的秘钥对，同时返回派生路径
+ */
+func (wallet *Wallet) deriveKeyPair(change uint32, index uint32) (*KeyPair, string, error) {
+	return deriveHDKeyPair(wallet.curve, wallet.seed, wallet.hd.Account, change, index)
+}
+
+func deriveHDKeyPair(curve elliptic.Curve, seed []byte, account uint32, change uint32, index uint32) (*KeyPair, string, error) {
+	master, err := hdwallet.NewMaster(seed, curve)
+	if err != nil {
+		return nil, "", err
+	}
+	path := hdwallet.BIP44Path(account, change, index)
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, "", err
+	}
+	priv, err := key.PrivateKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return newKeyPair(priv), hdwallet.FormatPath(path), nil
+}
+
+/**
+ * 钱包是否已经有HD种子
+ */
+func (wallet *Wallet) HasHDSeed() bool {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	return wallet.hd != nil
+}
+
+/**
+ * 获取钱包的助记词，用于备份钱包，钱包锁定时返回ErrWalletLocked
+ */
+func (wallet *Wallet) GetMnemonic() (string, error) {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	if wallet.hd == nil {
+		return "", ErrNoHDSeed
+	}
+	if wallet.params != nil && wallet.masterKey == nil {
+		return "", ErrWalletLocked
+	}
+	return wallet.mnemonic, nil
+}
+
+/**
+ * 获取地址的派生路径，不是从种子派生的地址返回空字符串
+ */
+func (wallet *Wallet) GetPath(addr string) string {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	record := wallet.records[addr]
+	if record == nil {
+		return ""
+	}
+	return record.Path
+}
+
+/**
+ * 使用助记词恢复HD钱包：设置新的种子，然后依次派生收款地址和找零地址，
+ * 使用used判断地址是否有交易记录，连续gap个地址都没有交易记录时停止，
+ * 有交易记录的地址以及它们之前的地址都加入到钱包中，返回加入的地址数量
+ */
+func (wallet *Wallet) Restore(mnemonic string, passphrase string, gap uint32, used func(addr string) (bool, error)) (int, error) {
+	if gap == 0 {
+		return 0, errors.New("gap必须大于0")
+	}
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	if wallet.params != nil && wallet.masterKey == nil {
+		return 0, ErrWalletLocked
+	}
+	//新的种子、派生进度和地址都先在局部变量中生成，保存成功之后才替换钱包中的数据
+	hd, seed, mnemonic, err := wallet.newHDChain(mnemonic, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	keyPairs := make(map[string]*KeyPair)
+	records := make(map[string]*keyRecord)
+	for _, change := range []uint32{hdwallet.EXTERNAL, hdwallet.INTERNAL} {
+		derived := make([]*KeyPair, 0)
+		paths := make([]string, 0)
+		next := uint32(0)
+		for index := uint32(0); index < next+gap; index++ {
+			keyPair, path, err := deriveHDKeyPair(wallet.curve, seed, hd.Account, change, index)
+			if err != nil {
+				return 0, err
+			}
+			derived = append(derived, keyPair)
+			paths = append(paths, path)
+			isUsed, err := used(GetAddressByPub(keyPair.Pub))
+			if err != nil {
+				return 0, err
+			}
+			if isUsed {
+				next = index + 1
+			}
+		}
+		for i := uint32(0); i < next; i++ {
+			record, err := wallet.newRecord(derived[i])
+			if err != nil {
+				return 0, err
+			}
+			record.Path = paths[i]
+			address := GetAddressByPub(derived[i].Pub)
+			keyPairs[address] = derived[i]
+			records[address] = record
+		}
+		*hd.nextIndex(change) = next
+	}
+
+	address := make(map[string]*KeyPair)
+	for addr, keyPair := range wallet.Address {
+		address[addr] = keyPair
+	}
+	allRecords := make(map[string]*keyRecord)
+	for addr, record := range wallet.records {
+		allRecords[addr] = record
+	}
+	for addr := range keyPairs {
+		address[addr] = keyPairs[addr]
+		allRecords[addr] = records[addr]
+	}
+	oldAddress, oldRecords := wallet.Address, wallet.records
+	oldHD, oldSeed, oldMnemonic := wallet.hd, wallet.seed, wallet.mnemonic
+	wallet.Address, wallet.records = address, allRecords
+	wallet.hd, wallet.seed, wallet.mnemonic = hd, seed, mnemonic
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		wallet.Address, wallet.records = oldAddress, oldRecords
+		wallet.hd, wallet.seed, wallet.mnemonic = oldHD, oldSeed, oldMnemonic
+		return 0, err
+	}
+	return len(keyPairs), nil
+}
+
+/**
+ * 生成新的助记词作为钱包的HD种子，bits为熵的位数，返回助记词
+ */
+func (wallet *Wallet) NewHDSeed(bits int) (string, error) {
+	mnemonic, err := hdwallet.GenerateMnemonic(bits)
+	if err != nil {
+		return "", err
+	}
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	if wallet.params != nil && wallet.masterKey == nil {
+		return "", ErrWalletLocked
+	}
+	oldHD, oldSeed, oldMnemonic := wallet.hd, wallet.seed, wallet.mnemonic
+	err = wallet.setHDSeed(mnemonic, "")
+	if err != nil {
+		return "", err
+	}
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		wallet.hd, wallet.seed, wallet.mnemonic = oldHD, oldSeed, oldMnemonic
+		return "", err
+	}
+	return mnemonic, nil
+}
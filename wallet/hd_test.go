@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"XianfengChain04/hdwallet"
+	"XianfengChain04/storage"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+/**
+ * 保存数据可以被设置为失败的数据库，用于测试保存失败时钱包的状态
+ */
+type failingDB struct {
+	storage.DB
+	fail bool
+}
+
+func (db *failingDB) Update(fn func(tx storage.Tx) error) error {
+	if db.fail {
+		return errors.New("保存失败")
+	}
+	return db.DB.Update(fn)
+}
+
+/**
+ * 钱包中需要在恢复失败时保持不变的状态
+ */
+type hdState struct {
+	addresses []string
+	mnemonic  string
+	hd        *hdChain
+}
+
+func walletHDState(wallet *Wallet) hdState {
+	addresses := make([]string, 0)
+	for addr := range wallet.Address {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+	return hdState{addresses: addresses, mnemonic: wallet.mnemonic, hd: wallet.hd}
+}
+
+func TestRestore(t *testing.T) {
+	db := &failingDB{DB: storage.NewMemoryDB()}
+	wallet := newTestWallet(t, db)
+	_, err := wallet.NewAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//预先派生出收款地址0、2和找零地址0，作为有交易记录的地址
+	seed, err := hdwallet.NewSeed(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := make(map[string]string)
+	usedAddrs := make(map[string]bool)
+	for _, item := range []struct {
+		change uint32
+		index  uint32
+	}{{0, 0}, {0, 1}, {0, 2}, {1, 0}} {
+		keyPair, path, err := deriveHDKeyPair(wallet.curve, seed, 0, item.change, item.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := GetAddressByPub(keyPair.Pub)
+		expect[addr] = path
+		if item.index != 1 {
+			usedAddrs[addr] = true
+		}
+	}
+	used := func(addr string) (bool, error) {
+		return usedAddrs[addr], nil
+	}
+
+	//查询交易记录失败或者保存失败时，钱包保持原来的状态
+	before := walletHDState(wallet)
+	_, err = wallet.Restore(testMnemonic, "", 5, func(addr string) (bool, error) {
+		return false, errors.New("查询失败")
+	})
+	if err == nil {
+		t.Fatal("查询交易记录失败时应该返回错误")
+	}
+	if !reflect.DeepEqual(walletHDState(wallet), before) {
+		t.Fatal("查询交易记录失败后钱包的状态发生了变化")
+	}
+	db.fail = true
+	_, err = wallet.Restore(testMnemonic, "", 5, used)
+	if err == nil {
+		t.Fatal("保存失败时应该返回错误")
+	}
+	if !reflect.DeepEqual(walletHDState(wallet), before) {
+		t.Fatal("保存失败后钱包的状态发生了变化")
+	}
+	db.fail = false
+
+	//有交易记录的地址以及它们之前的地址都加入钱包
+	count, err := wallet.Restore(testMnemonic, "", 5, used)
+	if err != nil {
+		t.Fatalf("恢复钱包失败：%v", err)
+	}
+	if count != len(expect) {
+		t.Fatalf("期望恢复%d个地址，实际为%d个", len(expect), count)
+	}
+	for addr, path := range expect {
+		if wallet.GetPath(addr) != path {
+			t.Fatalf("地址%s的派生路径期望为%s，实际为%s", addr, path, wallet.GetPath(addr))
+		}
+	}
+	if wallet.hd.NextExternal != 3 || wallet.hd.NextInternal != 1 {
+		t.Fatalf("派生进度不正确：%d %d", wallet.hd.NextExternal, wallet.hd.NextInternal)
+	}
+	mnemonic, err := wallet.GetMnemonic()
+	if err != nil || mnemonic != testMnemonic {
+		t.Fatalf("恢复后的助记词不正确：%s", mnemonic)
+	}
+	//恢复之前的地址仍然保留
+	for _, addr := range before.addresses {
+		if !wallet.CheckAddress(addr) || wallet.Address[addr] == nil {
+			t.Fatalf("恢复之前的地址%s丢失", addr)
+		}
+	}
+
+	//重新加载的钱包与恢复后的钱包一致
+	loaded := newTestWallet(t, db)
+	if !reflect.DeepEqual(walletHDState(loaded), walletHDState(wallet)) {
+		t.Fatal("重新加载的钱包与恢复后的钱包不一致")
+	}
+}
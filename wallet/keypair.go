@@ -1,9 +1,9 @@
 package wallet
 
 import (
+	"XianfengChain04/chaincrypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 )
 
 /**
@@ -15,19 +15,30 @@ type KeyPair struct {
 }
 
 /**
- * 生成一对秘钥对
+ * 在曲线curve上随机生成一对秘钥对
  */
-func NewKeyPair() (*KeyPair, error) {
-	curve := elliptic.P256()
-	pri, err := ecdsa.GenerateKey(curve, rand.Reader)
+func NewKeyPair(curve elliptic.Curve) (*KeyPair, error) {
+	pri, err := chaincrypto.NewPriKey(curve)
 	if err != nil {
 		return nil, err
 	}
-	pub := elliptic.Marshal(curve, pri.X, pri.Y)
+	return newKeyPair(pri), nil
+}
 
+/**
+ * 由私钥得到秘钥对，公钥的编码与曲线有关，见chaincrypto.MarshalPub
+ */
+func newKeyPair(pri *ecdsa.PrivateKey) *KeyPair {
 	keyPair := KeyPair{
 		Priv: pri,
-		Pub:  pub,
+		Pub:  chaincrypto.GetPub(pri),
 	}
-	return &keyPair, nil
+	return &keyPair
+}
+
+/**
+ * 公钥是否使用33字节的压缩格式，导入非压缩格式的WIF私钥得到的公钥是65字节的非压缩格式
+ */
+func (keyPair *KeyPair) Compressed() bool {
+	return len(keyPair.Pub) == 33
 }
@@ -0,0 +1,363 @@
+package wallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"time"
+)
+
+/**
+ * 钱包加密：随机生成的主密钥使用AES-GCM加密每个私钥，
+ * 主密钥本身由口令经过scrypt派生出的密钥加密，修改口令时只需要重新加密主密钥
+ */
+
+const WALLETMETA = "walletmeta"
+const CRYPTOPARAMS = "crypto"
+const CURVE = "curve"
+
+// scrypt的参数
+const (
+	SCRYPTN = 1 << 15
+	SCRYPTR = 8
+	SCRYPTP = 1
+	KEYLEN  = 32
+)
+
+/**
+ * 新生成的加密参数使用的scrypt参数，测试时可以调小以加快速度
+ */
+var scryptN, scryptR, scryptP = SCRYPTN, SCRYPTR, SCRYPTP
+
+var (
+	ErrWalletLocked       = errors.New("钱包已加密并锁定，请先使用walletpassphrase命令解锁")
+	ErrWalletEncrypted    = errors.New("钱包已经加密")
+	ErrWalletNotEncrypted = errors.New("钱包没有加密")
+	ErrWrongPassphrase    = errors.New("钱包口令不正确")
+)
+
+/**
+ * 钱包加密的参数，保存在钱包元数据桶中
+ */
+type cryptoParams struct {
+	Salt        []byte //scrypt的盐
+	N           int
+	R           int
+	P           int
+	MasterKey   []byte //被口令派生出的密钥加密的主密钥
+	MasterNonce []byte
+}
+
+/**
+ * 钱包桶中每个地址的记录：曲线的名称、公钥和私钥D的字节，钱包加密后私钥为密文
+ * 曲线只保存名称，不对曲线对象进行gob编码
+ */
+type keyRecord struct {
+	Curve     string //为空时是旧版本的记录，使用P-256
+	Pub       []byte
+	Priv      []byte
+	Nonce     []byte //加密私钥使用的随机数，钱包未加密时为空
+	Path      string //HD钱包的派生路径，不是从种子派生的秘钥为空
+	Label     string //地址的备注
+	WatchOnly bool   //观察地址，没有私钥
+}
+
+/**
+ * 记录的秘钥所使用的曲线
+ */
+func (record *keyRecord) curve() (elliptic.Curve, error) {
+	if record.Curve == "" {
+		return elliptic.P256(), nil
+	}
+	return chaincrypto.CurveByName(record.Curve)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, data)
+	return data, err
+}
+
+/**
+ * 使用AES-GCM加密数据，additional为参与认证但不加密的数据
+ */
+func seal(key []byte, plaintext []byte, additional []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm.Seal(nil, nonce, plaintext, additional), nonce, nil
+}
+
+/**
+ * 使用AES-GCM解密数据，密钥不正确或者数据被篡改时返回错误
+ */
+func open(key []byte, ciphertext []byte, nonce []byte, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("加密数据的格式不正确")
+	}
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
+
+/**
+ * 生成新的加密参数：随机的盐，用口令派生出的密钥加密主密钥
+ */
+func newCryptoParams(passphrase string, masterKey []byte) (*cryptoParams, error) {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	params := &cryptoParams{
+		Salt: salt,
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+	}
+	key, err := params.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	params.MasterKey, params.MasterNonce, err = seal(key, masterKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func (params *cryptoParams) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), params.Salt, params.N, params.R, params.P, KEYLEN)
+}
+
+/**
+ * 使用口令解密出主密钥，口令不正确时返回ErrWrongPassphrase
+ */
+func (params *cryptoParams) unlock(passphrase string) ([]byte, error) {
+	key, err := params.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := open(key, params.MasterKey, params.MasterNonce, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return masterKey, nil
+}
+
+/**
+ * 钱包是否已经加密
+ */
+func (wallet *Wallet) IsEncrypted() bool {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	return wallet.params != nil
+}
+
+/**
+ * 钱包是否处于锁定状态，没有加密的钱包不会被锁定
+ */
+func (wallet *Wallet) IsLocked() bool {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	return wallet.params != nil && wallet.masterKey == nil
+}
+
+/**
+ * 使用口令加密钱包：生成主密钥加密所有的私钥，加密完成后钱包处于锁定状态
+ */
+func (wallet *Wallet) Encrypt(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("钱包口令不能为空")
+	}
+	wallet.mutex.Lock()
+	if wallet.params != nil {
+		wallet.mutex.Unlock()
+		return ErrWalletEncrypted
+	}
+	masterKey, err := randomBytes(KEYLEN)
+	if err != nil {
+		wallet.mutex.Unlock()
+		return err
+	}
+	params, err := newCryptoParams(passphrase, masterKey)
+	if err != nil {
+		wallet.mutex.Unlock()
+		return err
+	}
+	records := make(map[string]*keyRecord)
+	for addr, record := range wallet.records {
+		if record.WatchOnly {
+			records[addr] = record
+			continue
+		}
+		encrypted := *record
+		encrypted.Priv, encrypted.Nonce, err = seal(masterKey, record.Priv, record.Pub)
+		if err != nil {
+			wallet.mutex.Unlock()
+			return err
+		}
+		records[addr] = &encrypted
+	}
+	var hd *hdChain
+	if wallet.hd != nil {
+		hd, err = wallet.hd.encrypt(masterKey, wallet.mnemonic, wallet.seed)
+		if err != nil {
+			wallet.mutex.Unlock()
+			return err
+		}
+	}
+	oldRecords, oldHD := wallet.records, wallet.hd
+	wallet.records = records
+	wallet.hd = hd
+	wallet.params = params
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		wallet.records = oldRecords
+		wallet.hd = oldHD
+		wallet.params = nil
+		wallet.mutex.Unlock()
+		return err
+	}
+	wallet.lock()
+	wallet.mutex.Unlock()
+	wallet.notifyLock()
+	return nil
+}
+
+/**
+ * 使用口令解锁钱包，timeout之后自动锁定
+ */
+func (wallet *Wallet) Unlock(passphrase string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("解锁时间必须大于0")
+	}
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	if wallet.params == nil {
+		return ErrWalletNotEncrypted
+	}
+	masterKey, err := wallet.params.unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	privKeys := make(map[string]*ecdsa.PrivateKey)
+	for addr, record := range wallet.records {
+		if record.WatchOnly {
+			continue
+		}
+		d, err := open(masterKey, record.Priv, record.Nonce, record.Pub)
+		if err != nil {
+			return errors.New("地址" + addr + "的私钥解密失败")
+		}
+		curve, err := record.curve()
+		if err != nil {
+			return err
+		}
+		privKeys[addr], err = chaincrypto.PrivKeyFromBytes(curve, d)
+		if err != nil {
+			return err
+		}
+	}
+	if wallet.hd != nil {
+		wallet.mnemonic, wallet.seed, err = wallet.hd.decrypt(masterKey)
+		if err != nil {
+			return err
+		}
+	}
+	for addr, priv := range privKeys {
+		wallet.Address[addr].Priv = priv
+	}
+	wallet.masterKey = masterKey
+	if wallet.lockTimer != nil {
+		wallet.lockTimer.Stop()
+	}
+	wallet.lockTimer = time.AfterFunc(timeout, func() {
+		wallet.Lock()
+	})
+	return nil
+}
+
+/**
+ * 锁定钱包：从内存中清除主密钥和所有私钥
+ */
+func (wallet *Wallet) Lock() error {
+	wallet.mutex.Lock()
+	if wallet.params == nil {
+		wallet.mutex.Unlock()
+		return ErrWalletNotEncrypted
+	}
+	wallet.lock()
+	wallet.mutex.Unlock()
+	wallet.notifyLock()
+	return nil
+}
+
+func (wallet *Wallet) lock() {
+	for _, keyPair := range wallet.Address {
+		keyPair.Priv = nil
+	}
+	wallet.masterKey = nil
+	wallet.seed = nil
+	wallet.mnemonic = ""
+	if wallet.lockTimer != nil {
+		wallet.lockTimer.Stop()
+		wallet.lockTimer = nil
+	}
+}
+
+func (wallet *Wallet) notifyLock() {
+	if wallet.OnLock != nil {
+		wallet.OnLock()
+	}
+}
+
+/**
+ * 修改钱包口令：用旧口令解密出主密钥，再用新口令加密，私钥的密文不需要改变
+ */
+func (wallet *Wallet) ChangePassphrase(oldPassphrase string, newPassphrase string) error {
+	if newPassphrase == "" {
+		return errors.New("钱包口令不能为空")
+	}
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	if wallet.params == nil {
+		return ErrWalletNotEncrypted
+	}
+	masterKey, err := wallet.params.unlock(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	params, err := newCryptoParams(newPassphrase, masterKey)
+	if err != nil {
+		return err
+	}
+	oldParams := wallet.params
+	wallet.params = params
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		wallet.params = oldParams
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package wallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/storage"
+	"bytes"
+	"testing"
+	"time"
+)
+
+/**
+ * 创建测试用的钱包，使用较小的scrypt参数加快加密和解锁
+ */
+func newTestWallet(t *testing.T, db storage.DB) *Wallet {
+	oldN, oldR, oldP := scryptN, scryptR, scryptP
+	scryptN, scryptR, scryptP = 1<<4, 1, 1
+	t.Cleanup(func() {
+		scryptN, scryptR, scryptP = oldN, oldR, oldP
+	})
+	wallet, err := LoadAddrAndKeyPairsFromDB(db, chaincrypto.SECP256K1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+/**
+ * 在钱包中生成n个地址，返回地址及其私钥的字节
+ */
+func newTestKeys(t *testing.T, wallet *Wallet, n int) map[string][]byte {
+	keys := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		addr, err := wallet.NewAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, err := wallet.GetPrivKey(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[addr] = chaincrypto.PrivKeyBytes(priv)
+	}
+	return keys
+}
+
+/**
+ * 检查钱包中的私钥与keys一致
+ */
+func checkPrivKeys(t *testing.T, wallet *Wallet, keys map[string][]byte) {
+	for addr, expect := range keys {
+		priv, err := wallet.GetPrivKey(addr)
+		if err != nil {
+			t.Fatalf("获取地址%s的私钥失败：%v", addr, err)
+		}
+		if !bytes.Equal(chaincrypto.PrivKeyBytes(priv), expect) {
+			t.Fatalf("地址%s的私钥不正确", addr)
+		}
+	}
+}
+
+/**
+ * 检查钱包处于锁定状态，内存中没有任何私钥
+ */
+func checkLocked(t *testing.T, wallet *Wallet) {
+	if !wallet.IsLocked() {
+		t.Fatal("钱包应该处于锁定状态")
+	}
+	for addr, keyPair := range wallet.Address {
+		if keyPair.Priv != nil {
+			t.Fatalf("钱包锁定后地址%s的私钥仍然在内存中", addr)
+		}
+		_, err := wallet.GetPrivKey(addr)
+		if err != ErrWalletLocked {
+			t.Fatalf("期望返回%v，实际返回%v", ErrWalletLocked, err)
+		}
+	}
+	if wallet.masterKey != nil || wallet.seed != nil || wallet.mnemonic != "" {
+		t.Fatal("钱包锁定后主密钥和HD种子仍然在内存中")
+	}
+}
+
+func TestEncryptWallet(t *testing.T) {
+	db := storage.NewMemoryDB()
+	wallet := newTestWallet(t, db)
+	keys := newTestKeys(t, wallet, 2)
+	err := wallet.Encrypt("")
+	if err == nil {
+		t.Fatal("口令为空时应该返回错误")
+	}
+	var locked int
+	wallet.OnLock = func() {
+		locked++
+	}
+	err = wallet.Encrypt("passphrase")
+	if err != nil {
+		t.Fatalf("加密钱包失败：%v", err)
+	}
+	if !wallet.IsEncrypted() || locked != 1 {
+		t.Fatal("钱包加密后应该处于锁定状态")
+	}
+	checkLocked(t, wallet)
+	//保存的私钥是密文
+	for addr, priv := range keys {
+		record := wallet.records[addr]
+		if bytes.Equal(record.Priv, priv) || len(record.Nonce) == 0 {
+			t.Fatalf("地址%s的私钥没有加密", addr)
+		}
+	}
+	err = wallet.Encrypt("passphrase")
+	if err != ErrWalletEncrypted {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWalletEncrypted, err)
+	}
+	//锁定时不能生成新地址
+	_, err = wallet.NewAddress()
+	if err != ErrWalletLocked {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWalletLocked, err)
+	}
+
+	//重新加载的钱包处于锁定状态，解锁后可以得到原来的私钥
+	loaded := newTestWallet(t, db)
+	checkLocked(t, loaded)
+	err = loaded.Unlock("passphrase", time.Minute)
+	if err != nil {
+		t.Fatalf("解锁钱包失败：%v", err)
+	}
+	checkPrivKeys(t, loaded, keys)
+	if _, err = loaded.GetMnemonic(); err != nil {
+		t.Fatalf("解锁后应该可以获取助记词：%v", err)
+	}
+}
+
+func TestUnlockWallet(t *testing.T) {
+	wallet := newTestWallet(t, storage.NewMemoryDB())
+	keys := newTestKeys(t, wallet, 1)
+	err := wallet.Unlock("passphrase", time.Minute)
+	if err != ErrWalletNotEncrypted {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWalletNotEncrypted, err)
+	}
+	err = wallet.Encrypt("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wallet.Unlock("wrong", time.Minute)
+	if err != ErrWrongPassphrase {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWrongPassphrase, err)
+	}
+	checkLocked(t, wallet)
+	err = wallet.Unlock("passphrase", 0)
+	if err == nil {
+		t.Fatal("解锁时间为0时应该返回错误")
+	}
+	checkLocked(t, wallet)
+
+	//超时之后自动锁定
+	err = wallet.Unlock("passphrase", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrivKeys(t, wallet, keys)
+	deadline := time.Now().Add(5 * time.Second)
+	for !wallet.IsLocked() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkLocked(t, wallet)
+}
+
+func TestLockWallet(t *testing.T) {
+	wallet := newTestWallet(t, storage.NewMemoryDB())
+	keys := newTestKeys(t, wallet, 2)
+	err := wallet.Lock()
+	if err != ErrWalletNotEncrypted {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWalletNotEncrypted, err)
+	}
+	err = wallet.Encrypt("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wallet.Unlock("passphrase", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrivKeys(t, wallet, keys)
+	//解锁时可以生成新地址，新地址的私钥同样被加密
+	newKeys := newTestKeys(t, wallet, 1)
+	var locked bool
+	wallet.OnLock = func() {
+		locked = true
+	}
+	err = wallet.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("钱包锁定时应该调用OnLock")
+	}
+	checkLocked(t, wallet)
+	if wallet.lockTimer != nil {
+		t.Fatal("钱包锁定后应该停止自动锁定的计时器")
+	}
+	err = wallet.Unlock("passphrase", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrivKeys(t, wallet, newKeys)
+}
+
+func TestChangePassphrase(t *testing.T) {
+	db := storage.NewMemoryDB()
+	wallet := newTestWallet(t, db)
+	keys := newTestKeys(t, wallet, 2)
+	err := wallet.ChangePassphrase("old", "new")
+	if err != ErrWalletNotEncrypted {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWalletNotEncrypted, err)
+	}
+	err = wallet.Encrypt("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts := make(map[string][]byte)
+	for addr := range keys {
+		ciphertexts[addr] = append([]byte{}, wallet.records[addr].Priv...)
+	}
+	hdSeed := append([]byte{}, wallet.hd.Seed...)
+
+	err = wallet.ChangePassphrase("wrong", "new")
+	if err != ErrWrongPassphrase {
+		t.Fatalf("期望返回%v，实际返回%v", ErrWrongPassphrase, err)
+	}
+	err = wallet.ChangePassphrase("old", "")
+	if err == nil {
+		t.Fatal("新口令为空时应该返回错误")
+	}
+	err = wallet.ChangePassphrase("old", "new")
+	if err != nil {
+		t.Fatalf("修改口令失败：%v", err)
+	}
+	checkLocked(t, wallet)
+
+	//只重新加密主密钥，私钥和HD种子的密文不变
+	loaded := newTestWallet(t, db)
+	for addr, ciphertext := range ciphertexts {
+		if !bytes.Equal(loaded.records[addr].Priv, ciphertext) {
+			t.Fatalf("修改口令后地址%s的私钥密文发生了变化", addr)
+		}
+	}
+	if !bytes.Equal(loaded.hd.Seed, hdSeed) {
+		t.Fatal("修改口令后HD种子的密文发生了变化")
+	}
+	err = loaded.Unlock("old", time.Minute)
+	if err != ErrWrongPassphrase {
+		t.Fatalf("修改口令后旧口令期望返回%v，实际返回%v", ErrWrongPassphrase, err)
+	}
+	err = loaded.Unlock("new", time.Minute)
+	if err != nil {
+		t.Fatalf("使用新口令解锁失败：%v", err)
+	}
+	checkPrivKeys(t, loaded, keys)
+}
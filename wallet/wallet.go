@@ -2,64 +2,211 @@ package wallet
 
 import (
 	"BCAddressCode/base58"
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/hdwallet"
+	"XianfengChain04/storage"
 	"XianfengChain04/utils"
 	"bytes"
-	"github.com/bolt"
-	"encoding/gob"
+	"crypto/ecdsa"
 	"crypto/elliptic"
+	"encoding/gob"
+	"errors"
+	"sync"
+	"time"
 )
 
 const KEYSTORE = "keystores"
-const ADDANDPAIR = "addrs_keypairs"
+const ADDANDPAIR = "addrs_keypairs" //旧版本的钱包把所有地址和秘钥对gob编码后保存在这个key下
 
 /**
  * 定义wallet结构体，用于管理地址和对应的秘钥对信息
+ * 钱包加密后私钥以密文保存，钱包锁定时KeyPair中的私钥为nil
+ * 观察地址的KeyPair中私钥总是为nil，只导入了地址时公钥也为nil
  */
 type Wallet struct {
 	Address map[string]*KeyPair
-	Engine  *bolt.DB
+	Engine  storage.DB
+	OnLock  func() //钱包被锁定时调用，用于收回已经交给其他模块(如共识引擎)的私钥
+
+	records   map[string]*keyRecord //地址 -> 保存到文件中的记录
+	params    *cryptoParams         //钱包加密的参数，钱包没有加密时为nil
+	curve     elliptic.Curve        //钱包生成新秘钥时使用的曲线
+	masterKey []byte                //解锁后的主密钥，钱包锁定时为nil
+	hd        *hdChain              //HD钱包的种子和派生进度，钱包还没有种子时为nil
+	seed      []byte                //解锁后的HD种子，钱包锁定时为nil
+	mnemonic  string                //解锁后的助记词
+	lockTimer *time.Timer           //解锁超时后自动锁定钱包
+	mutex     sync.Mutex
 }
 
-//map: key    value
-//    add     秘钥对(私钥、公钥）
+/**
+ * 生成新的收款地址：从HD种子按照BIP44路径派生下一个地址的秘钥对，钱包还没有种子时先生成种子
+ */
 func (wallet *Wallet) NewAddress() (string, error) {
+	return wallet.newHDAddress(hdwallet.EXTERNAL)
+}
+
+/**
+ * 生成新的找零地址：从HD种子的找零路径派生下一个地址
+ */
+func (wallet *Wallet) NewChangeAddress() (string, error) {
+	return wallet.newHDAddress(hdwallet.INTERNAL)
+}
 
-	keyPair, err := NewKeyPair()
+func (wallet *Wallet) newHDAddress(change uint32) (string, error) {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	//钱包加密后需要主密钥加密新的私钥
+	if wallet.params != nil && wallet.masterKey == nil {
+		return "", ErrWalletLocked
+	}
+	if wallet.hd == nil {
+		mnemonic, err := hdwallet.GenerateMnemonic(MNEMONICBITS)
+		if err != nil {
+			return "", err
+		}
+		err = wallet.setHDSeed(mnemonic, "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	index := wallet.hd.nextIndex(change)
+	oldIndex := *index
+	var keyPair *KeyPair
+	var path string
+	for {
+		var err error
+		keyPair, path, err = wallet.deriveKeyPair(change, *index)
+		if err != nil {
+			*index = oldIndex
+			return "", err
+		}
+		*index++
+		//恢复钱包后派生进度可能落后于已经生成过的地址，跳过钱包中已有的地址
+		if wallet.Address[GetAddressByPub(keyPair.Pub)] == nil {
+			break
+		}
+	}
+	address, err := wallet.addKeyPair(keyPair, path)
+	if err != nil {
+		*index = oldIndex
+		return "", err
+	}
+
+	//把更新了地址信息和对应秘钥对的map结构中的数据持久化存到db文件中
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		*index = oldIndex
+		delete(wallet.Address, address)
+		delete(wallet.records, address)
+		return "", err
+	}
+	return address, nil
+}
+
+/**
+ * 把秘钥对加入到钱包中管理起来(仅仅是内存)，path为HD钱包的派生路径，返回秘钥对的地址
+ */
+func (wallet *Wallet) addKeyPair(keyPair *KeyPair, path string) (string, error) {
+	address := GetAddressByPub(keyPair.Pub)
+	record, err := wallet.newRecord(keyPair)
 	if err != nil {
 		return "", err
 	}
+	record.Path = path
+	wallet.Address[address] = keyPair
+	wallet.records[address] = record
+	return address, nil
+}
+
+/**
+ * 根据秘钥对生成保存到文件中的记录，钱包加密时使用主密钥加密私钥
+ */
+func (wallet *Wallet) newRecord(keyPair *KeyPair) (*keyRecord, error) {
+	record := &keyRecord{
+		Curve: keyPair.Priv.Curve.Params().Name,
+		Pub:   keyPair.Pub,
+		Priv:  chaincrypto.PrivKeyBytes(keyPair.Priv),
+	}
+	if wallet.params == nil {
+		return record, nil
+	}
+	var err error
+	record.Priv, record.Nonce, err = seal(wallet.masterKey, record.Priv, record.Pub)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
 
-	//3、对公钥进行sha256哈希
-	pubHash := utils.Hash256(keyPair.Pub)
-	//4、ripemd160计算
-	ripemdPub := utils.HashRipemd160(pubHash)
+/**
+ * 获取地址的私钥，钱包锁定时返回ErrWalletLocked
+ */
+func (wallet *Wallet) GetPrivKey(addr string) (*ecdsa.PrivateKey, error) {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	keyPair := wallet.Address[addr]
+	if keyPair == nil {
+		return nil, errors.New("当前钱包未找到地址" + addr + "的私钥")
+	}
+	if wallet.records[addr].WatchOnly {
+		return nil, ErrWatchOnly
+	}
+	if keyPair.Priv == nil {
+		return nil, ErrWalletLocked
+	}
+	return keyPair.Priv, nil
+}
 
-	//5、添加版本号0x00
-	versionPub := append([]byte{0x00}, ripemdPub...)
+/**
+ * 计算公钥的哈希：先进行sha256哈希，再进行ripemd160哈希
+ */
+func HashPubKey(pub []byte) []byte {
+	pubHash := utils.Hash256(pub)
+	return utils.HashRipemd160(pubHash)
+}
 
-	//6、两次hash(双hash）
+/**
+ * 根据公钥按照比特币地址的生成规则计算得到地址
+ */
+func GetAddressByPub(pub []byte) string {
+	return GetAddressByPubHash(HashPubKey(pub))
+}
+
+/**
+ * 根据公钥哈希计算得到地址
+ */
+func GetAddressByPubHash(pubHash []byte) string {
+	//1、添加版本号0x00
+	versionPub := append([]byte{0x00}, pubHash...)
+
+	//2、两次hash(双hash）
 	firstHash := utils.Hash256(versionPub)
 	secondHash := utils.Hash256(firstHash)
 
-	//7、截取前4个字节作为地址校验位
+	//3、截取前4个字节作为地址校验位
 	check := secondHash[:4]
 
-	//8、拼接到versionPub后面
+	//4、拼接到versionPub后面
 	originAddress := append(versionPub, check...)
 
-	//9、base58编码
-	address, err := base58.Encode(originAddress), nil
-	if err != nil {
-		return "", err
-	}
-
-	//把新生成的地址和对应的秘钥对存入到wallet的map结构中管理起来
-	wallet.Address[address] = keyPair //仅仅是内存
-
-	//把更新了地址信息和对应秘钥对的map结构中的数据持久化存到db文件中
-	wallet.SaveAddrAndKeyPairs2DB()
+	//5、base58编码
+	return base58.Encode(originAddress)
+}
 
-	return address, nil
+/**
+ * 从地址中解析出公钥哈希：base58解码以后，去掉版本号和校验位
+ */
+func GetPubHashByAddress(addr string) ([]byte, error) {
+	if !checkAddress(addr) {
+		return nil, errors.New("地址不符合规范，请检查后重试")
+	}
+	addrBytes := base58.Decode(addr)
+	if len(addrBytes) != 1+20+4 {
+		return nil, errors.New("地址不符合规范，请检查后重试")
+	}
+	return addrBytes[1 : len(addrBytes)-4], nil
 }
 
 /**
@@ -67,6 +214,10 @@ func (wallet *Wallet) NewAddress() (string, error) {
  * 如果不符合地址规范，返回false
  */
 func (wallet *Wallet) CheckAddress(addr string) bool {
+	return checkAddress(addr)
+}
+
+func checkAddress(addr string) bool {
 	//1、使用base58对传入的地址进行解码
 	reAddrBytes := base58.Decode(addr) // versionPubHash + check
 
@@ -91,56 +242,177 @@ func (wallet *Wallet) CheckAddress(addr string) bool {
 }
 
 /**
- * 该方法用于将内存中的map数据中的地址和秘钥对信息保存到持久化文件中
+ * 该方法用于将内存中的地址和秘钥对记录以及钱包加密的参数保存到持久化文件中
+ * 每个地址保存为一条记录，只保存私钥D的字节，钱包加密后为密文
  */
-func (wallet *Wallet) SaveAddrAndKeyPairs2DB() {
-	var err error
-	wallet.Engine.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(KEYSTORE))
-		if bucket == nil {
-			bucket, err = tx.CreateBucket([]byte(KEYSTORE))
+func (wallet *Wallet) SaveAddrAndKeyPairs2DB() error {
+	return wallet.Engine.Update(func(tx storage.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(KEYSTORE))
+		if err != nil {
+			return err
+		}
+		for addr, record := range wallet.records {
+			recordBytes, err := utils.Encode(record)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put([]byte(addr), recordBytes)
 			if err != nil {
 				return err
 			}
 		}
-		//桶keystores已经存在，可以向桶中存放map的数据了
-		//map[key]keypair
-		gob.Register(elliptic.P256())
-		buff := new(bytes.Buffer)
-		encoder := gob.NewEncoder(buff)
-		err = encoder.Encode(wallet.Address)
+		//旧版本格式的数据已经转换为新的记录
+		err = bucket.Delete([]byte(ADDANDPAIR))
 		if err != nil {
 			return err
 		}
-		bucket.Put([]byte(ADDANDPAIR), buff.Bytes())
-		return nil
+		metaBucket, err := tx.CreateBucketIfNotExists([]byte(WALLETMETA))
+		if err != nil {
+			return err
+		}
+		err = metaBucket.Put([]byte(CURVE), []byte(wallet.curve.Params().Name))
+		if err != nil {
+			return err
+		}
+		if wallet.hd != nil {
+			hdBytes, err := utils.Encode(wallet.hd)
+			if err != nil {
+				return err
+			}
+			err = metaBucket.Put([]byte(HDCHAIN), hdBytes)
+			if err != nil {
+				return err
+			}
+		}
+		if wallet.params == nil {
+			return nil
+		}
+		paramsBytes, err := utils.Encode(wallet.params)
+		if err != nil {
+			return err
+		}
+		return metaBucket.Put([]byte(CRYPTOPARAMS), paramsBytes)
 	})
 }
 
 /**
- * 从文件中读取已经存在的地址和对应的秘钥对信息
+ * 从文件中读取已经存在的地址和对应的秘钥对信息，钱包加密时读取后处于锁定状态
+ * curveName为新钱包生成秘钥时使用的曲线，已有秘钥的钱包继续使用原来的曲线
  */
-func LoadAddrAndKeyPairsFromDB(engine *bolt.DB) (*Wallet, error) {
-	address := make(map[string]*KeyPair)
-	var err error
-	engine.View(func(tx *bolt.Tx) error {
+func LoadAddrAndKeyPairsFromDB(engine storage.DB, curveName string) (*Wallet, error) {
+	walet := &Wallet{
+		Address: make(map[string]*KeyPair),
+		Engine:  engine,
+		records: make(map[string]*keyRecord),
+	}
+	var legacyBytes []byte
+	var savedCurve string
+	err := engine.View(func(tx storage.Tx) error {
+		metaBucket := tx.Bucket([]byte(WALLETMETA))
+		if metaBucket != nil {
+			savedCurve = string(metaBucket.Get([]byte(CURVE)))
+			paramsBytes := metaBucket.Get([]byte(CRYPTOPARAMS))
+			if len(paramsBytes) != 0 {
+				walet.params = new(cryptoParams)
+				_, err := utils.Decode(paramsBytes, walet.params)
+				if err != nil {
+					return err
+				}
+			}
+			hdBytes := metaBucket.Get([]byte(HDCHAIN))
+			if len(hdBytes) != 0 {
+				walet.hd = new(hdChain)
+				_, err := utils.Decode(hdBytes, walet.hd)
+				if err != nil {
+					return err
+				}
+			}
+		}
 		bucket := tx.Bucket([]byte(KEYSTORE))
 		if bucket == nil {
 			return nil
 		}
 		//如果有keystore存在，从keystore桶中读取
-		addsAndKeyPairsBytes := bucket.Get([]byte(ADDANDPAIR))
-		gob.Register(elliptic.P256())
-		decoder := gob.NewDecoder(bytes.NewReader(addsAndKeyPairsBytes))
-		err = decoder.Decode(&address)
-		return err
+		return bucket.ForEach(func(k, v []byte) error {
+			if string(k) == ADDANDPAIR {
+				legacyBytes = append([]byte{}, v...)
+				return nil
+			}
+			record := new(keyRecord)
+			_, err := utils.Decode(v, record)
+			if err != nil {
+				return err
+			}
+			walet.records[string(k)] = record
+			return nil
+		})
 	})
 	if err != nil {
 		return nil, err
 	}
-	walet := &Wallet{
-		Address: address,
-		Engine:  engine,
+	//旧版本的钱包没有记录曲线，秘钥都是P-256的
+	if savedCurve == "" && (len(walet.records) != 0 || len(legacyBytes) != 0) {
+		savedCurve = chaincrypto.P256
+	}
+	if savedCurve == "" {
+		savedCurve = curveName
+	}
+	walet.curve, err = chaincrypto.CurveByName(savedCurve)
+	if err != nil {
+		return nil, err
+	}
+	for addr, record := range walet.records {
+		keyPair := &KeyPair{Pub: record.Pub}
+		if walet.params == nil && !record.WatchOnly {
+			curve, err := record.curve()
+			if err != nil {
+				return nil, err
+			}
+			keyPair.Priv, err = chaincrypto.PrivKeyFromBytes(curve, record.Priv)
+			if err != nil {
+				return nil, err
+			}
+		}
+		walet.Address[addr] = keyPair
+	}
+	if walet.hd != nil && walet.params == nil {
+		walet.seed = walet.hd.Seed
+		walet.mnemonic = string(walet.hd.Mnemonic)
+	}
+	if len(legacyBytes) != 0 {
+		err = walet.migrateLegacy(legacyBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return walet, nil
+}
+
+/**
+ * 把旧版本gob编码的地址和秘钥对转换为新的记录格式并保存
+ */
+func (wallet *Wallet) migrateLegacy(data []byte) error {
+	if wallet.params != nil {
+		return errors.New("钱包已经加密，无法转换旧版本的钱包数据")
+	}
+	address := make(map[string]*KeyPair)
+	//旧版本的数据中gob编码了P-256的曲线对象，只有读取旧数据时需要注册
+	gob.Register(elliptic.P256())
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&address)
+	if err != nil {
+		return err
+	}
+	for addr, keyPair := range address {
+		if keyPair == nil || keyPair.Priv == nil {
+			continue
+		}
+		record, err := wallet.newRecord(keyPair)
+		if err != nil {
+			return err
+		}
+		wallet.Address[addr] = keyPair
+		wallet.records[addr] = record
 	}
-	return walet, err
+	return wallet.SaveAddrAndKeyPairs2DB()
 }
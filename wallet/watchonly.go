@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"errors"
+)
+
+/**
+ * 观察地址：钱包中只有地址(或者公钥)而没有私钥的条目，用于在不保存私钥的机器上查看地址的余额和交易
+ * 观察地址可以构建未签名的交易，但是不能签名
+ */
+
+var ErrWatchOnly = errors.New("该地址是观察地址，钱包中没有私钥，无法签名")
+
+/**
+ * 判断地址是否是观察地址
+ */
+func (wallet *Wallet) IsWatchOnly(addr string) bool {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	record := wallet.records[addr]
+	return record != nil && record.WatchOnly
+}
+
+/**
+ * 导入观察地址，label为地址的备注
+ */
+func (wallet *Wallet) ImportAddress(addr string, label string) error {
+	if !checkAddress(addr) {
+		return errors.New("地址不符合规范，请检查后重试")
+	}
+	_, err := GetPubHashByAddress(addr)
+	if err != nil {
+		return err
+	}
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	return wallet.addWatchOnly(addr, nil, label)
+}
+
+/**
+ * 导入公钥作为观察地址，返回公钥对应的地址
+ * 与只导入地址相比，构建未签名的交易时可以在交易输入中填入公钥
+ */
+func (wallet *Wallet) ImportPubKey(pub []byte, label string) (string, error) {
+	_, err := chaincrypto.ParsePub(pub)
+	if err != nil {
+		return "", err
+	}
+	address := GetAddressByPub(pub)
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	//已经导入的观察地址补充公钥
+	record := wallet.records[address]
+	if record != nil && record.WatchOnly && len(record.Pub) == 0 {
+		record.Pub = pub
+		wallet.Address[address].Pub = pub
+		if label != "" {
+			record.Label = label
+		}
+		return address, wallet.SaveAddrAndKeyPairs2DB()
+	}
+	return address, wallet.addWatchOnly(address, pub, label)
+}
+
+/**
+ * 把观察地址加入到钱包中并保存，调用者需要持有锁
+ */
+func (wallet *Wallet) addWatchOnly(addr string, pub []byte, label string) error {
+	if wallet.Address[addr] != nil {
+		return ErrKeyExists
+	}
+	wallet.Address[addr] = &KeyPair{Pub: pub}
+	wallet.records[addr] = &keyRecord{
+		Pub:       pub,
+		Label:     label,
+		WatchOnly: true,
+	}
+	err := wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		delete(wallet.Address, addr)
+		delete(wallet.records, addr)
+		return err
+	}
+	return nil
+}
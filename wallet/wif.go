@@ -0,0 +1,136 @@
+package wallet
+
+import (
+	"BCAddressCode/base58"
+	"XianfengChain04/chaincrypto"
+	"XianfengChain04/utils"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+)
+
+/**
+ * WIF(Wallet Import Format)：比特币钱包导入导出私钥的格式
+ * base58(版本号0x80 || 32字节私钥 || 0x01(公钥使用压缩格式，没有时公钥使用非压缩格式) || 4字节校验位)
+ * WIF只用于secp256k1的私钥，公钥的格式不同时地址也不同，导入非压缩格式的WIF时钱包保存非压缩格式的公钥
+ */
+
+const WIFVERSION = 0x80
+const WIFCOMPRESSED = 0x01
+
+var (
+	ErrInvalidWIF     = errors.New("WIF格式的私钥不正确")
+	ErrWIFUnsupported = errors.New("只有secp256k1的私钥可以使用WIF格式，请使用hex格式")
+	ErrKeyExists      = errors.New("该地址已经在钱包中")
+)
+
+/**
+ * 把secp256k1的私钥编码为WIF格式，compressed表示私钥对应的公钥是否使用压缩格式
+ */
+func EncodeWIF(pri *ecdsa.PrivateKey, compressed bool) (string, error) {
+	if pri.Curve.Params().Name != chaincrypto.SECP256K1 {
+		return "", ErrWIFUnsupported
+	}
+	payload := append([]byte{WIFVERSION}, chaincrypto.PrivKeyBytes(pri)...)
+	if compressed {
+		payload = append(payload, WIFCOMPRESSED)
+	}
+	check := utils.Hash256(utils.Hash256(payload))[:4]
+	return base58.Encode(append(payload, check...)), nil
+}
+
+/**
+ * 解析WIF格式的私钥，同时返回私钥对应的公钥是否使用压缩格式
+ */
+func DecodeWIF(wif string) (*ecdsa.PrivateKey, bool, error) {
+	data := base58.Decode(wif)
+	if len(data) != 1+32+4 && len(data) != 1+32+1+4 {
+		return nil, false, ErrInvalidWIF
+	}
+	payload := data[:len(data)-4]
+	check := utils.Hash256(utils.Hash256(payload))[:4]
+	if !bytes.Equal(check, data[len(data)-4:]) || payload[0] != WIFVERSION {
+		return nil, false, ErrInvalidWIF
+	}
+	compressed := len(payload) == 1+32+1
+	if compressed && payload[33] != WIFCOMPRESSED {
+		return nil, false, ErrInvalidWIF
+	}
+	pri, err := chaincrypto.PrivKeyFromBytes(chaincrypto.S256(), payload[1:33])
+	if err != nil {
+		return nil, false, err
+	}
+	return pri, compressed, nil
+}
+
+/**
+ * 解析用户输入的私钥：WIF格式，或者64个字符的hex格式(使用钱包的曲线，公钥使用默认的格式)
+ * 同时返回私钥对应的公钥是否使用压缩格式
+ */
+func (wallet *Wallet) ParsePrivKey(key string) (*ecdsa.PrivateKey, bool, error) {
+	if len(key) == 64 {
+		d, err := hex.DecodeString(key)
+		if err == nil {
+			pri, err := chaincrypto.PrivKeyFromBytes(wallet.curve, d)
+			return pri, true, err
+		}
+	}
+	return DecodeWIF(key)
+}
+
+/**
+ * 把外部的私钥导入到钱包中，compressed为false时钱包保存secp256k1的非压缩格式的公钥，
+ * 地址由非压缩格式的公钥计算得到，label为地址的备注，返回私钥对应的地址
+ */
+func (wallet *Wallet) ImportPrivKey(pri *ecdsa.PrivateKey, compressed bool, label string) (string, error) {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	//钱包加密后需要主密钥加密导入的私钥
+	if wallet.params != nil && wallet.masterKey == nil {
+		return "", ErrWalletLocked
+	}
+	keyPair := newKeyPair(pri)
+	if !compressed {
+		keyPair.Pub = elliptic.Marshal(pri.Curve, pri.X, pri.Y)
+	}
+	address := GetAddressByPub(keyPair.Pub)
+	//观察地址导入私钥后成为普通地址
+	oldKeyPair, oldRecord := wallet.Address[address], wallet.records[address]
+	if oldRecord != nil && !oldRecord.WatchOnly {
+		return "", ErrKeyExists
+	}
+	if oldRecord != nil && label == "" {
+		label = oldRecord.Label
+	}
+	address, err := wallet.addKeyPair(keyPair, "")
+	if err != nil {
+		return "", err
+	}
+	wallet.records[address].Label = label
+	err = wallet.SaveAddrAndKeyPairs2DB()
+	if err != nil {
+		delete(wallet.Address, address)
+		delete(wallet.records, address)
+		if oldRecord != nil {
+			wallet.Address[address] = oldKeyPair
+			wallet.records[address] = oldRecord
+		}
+		return "", err
+	}
+	return address, nil
+}
+
+/**
+ * 获取地址的备注
+ */
+func (wallet *Wallet) GetLabel(addr string) string {
+	wallet.mutex.Lock()
+	defer wallet.mutex.Unlock()
+	record := wallet.records[addr]
+	if record == nil {
+		return ""
+	}
+	return record.Label
+}
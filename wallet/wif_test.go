@@ -0,0 +1,45 @@
+package wallet
+
+import (
+	"XianfengChain04/chaincrypto"
+	"crypto/elliptic"
+	"encoding/hex"
+	"testing"
+)
+
+func TestWIFVectors(t *testing.T) {
+	tests := []struct {
+		wif        string
+		priv       string
+		compressed bool
+		address    string
+	}{
+		{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ",
+			"0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d", false, "1GAehh7TsJAHuUAeKZcXf5CnwuGuGgyX2S"},
+		{"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617",
+			"0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d", true, "1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK"},
+	}
+	for _, test := range tests {
+		pri, compressed, err := DecodeWIF(test.wif)
+		if err != nil {
+			t.Fatalf("解析%s失败：%v", test.wif, err)
+		}
+		if hex.EncodeToString(chaincrypto.PrivKeyBytes(pri)) != test.priv || compressed != test.compressed {
+			t.Fatalf("解析%s得到的私钥不正确", test.wif)
+		}
+		pub := chaincrypto.GetPub(pri)
+		if !compressed {
+			pub = elliptic.Marshal(pri.Curve, pri.X, pri.Y)
+		}
+		if GetAddressByPub(pub) != test.address {
+			t.Fatalf("%s对应的地址不正确：%s", test.wif, GetAddressByPub(pub))
+		}
+		wif, err := EncodeWIF(pri, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wif != test.wif {
+			t.Fatalf("期望编码为%s，实际为%s", test.wif, wif)
+		}
+	}
+}